@@ -0,0 +1,305 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// Accounts are identified by their account hash ("account-hash-...").
+// The main purse of an account has no sub account, its other purses
+// are sub accounts named after their URef, without access rights,
+// and its stakes are the StakedSubAccount and UnbondingSubAccount
+// sub accounts. Purses of unknown owner are identified by their URef.
+
+const (
+	accountHashPrefix = address.AccountHashPrefix
+	urefPrefix        = address.URefPrefix
+)
+
+// MainAccount returns the *RosettaTypes.AccountIdentifier
+// of the main purse of an account hash.
+func MainAccount(accountHash string) *RosettaTypes.AccountIdentifier {
+	return &RosettaTypes.AccountIdentifier{
+		Address: accountHash,
+	}
+}
+
+// PurseAccount returns the *RosettaTypes.AccountIdentifier of
+// a purse of an account hash, other than its main purse.
+func PurseAccount(accountHash string, purse string) *RosettaTypes.AccountIdentifier {
+	return &RosettaTypes.AccountIdentifier{
+		Address: accountHash,
+		SubAccount: &RosettaTypes.SubAccountIdentifier{
+			Address: purseAddress(purse),
+		},
+	}
+}
+
+// purseAddress returns a purse URef without its access rights.
+func purseAddress(purse string) string {
+	purse = strings.ToLower(purse)
+	if strings.Count(purse, "-") < 2 { // nolint:gomnd
+		return purse
+	}
+
+	return PurseWithoutIndex(purse)
+}
+
+// accountHash returns the account hash of an address, an
+// account hash or a public key.
+func accountHash(addr string) (string, error) {
+	parsed, err := address.Parse(addr)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := parsed.Account()
+	if err != nil {
+		return "", err
+	}
+
+	return hash.String(), nil
+}
+
+// publicKeyAccount returns the account hash of a public key
+// read from the node, or the public key itself if it cannot
+// be parsed.
+func publicKeyAccount(publicKey string) string {
+	hash, err := AccountHashFromPublicKey(publicKey)
+	if err != nil {
+		return publicKey
+	}
+
+	return hash
+}
+
+// mainPurseCache caches the main purses of accounts,
+// which never change once an account is created.
+type mainPurseCache struct {
+	mu     sync.Mutex
+	purses map[string]string
+}
+
+func newMainPurseCache() *mainPurseCache {
+	return &mainPurseCache{purses: map[string]string{}}
+}
+
+func (c *mainPurseCache) get(accountHash string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purse, ok := c.purses[accountHash]
+	return purse, ok
+}
+
+func (c *mainPurseCache) set(accountHash string, purse string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.purses[accountHash] = purse
+}
+
+// accountMainPurse returns the main purse of an account hash,
+// read from the provided global state on first use.
+func (ec *Client) accountMainPurse(ctx context.Context, stateRootHash string, accountHash string) (string, error) {
+	if purse, ok := ec.mainPurses.get(accountHash); ok {
+		return purse, nil
+	}
+
+	item, err := ec.node.GetStateItem(ctx, stateRootHash, accountHash, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: could not get account %s", err, accountHash)
+	}
+	if item.Account == nil {
+		return "", fmt.Errorf("%s is not an account", accountHash)
+	}
+	ec.mainPurses.set(accountHash, item.Account.MainPurse)
+
+	return item.Account.MainPurse, nil
+}
+
+// checkAccountPurse returns an error wrapping address.ErrInvalidAddress
+// unless purse is the main purse of the account of addr, an account
+// hash or a public key, or one of its named keys in the global state
+// stateRootHash.
+func (ec *Client) checkAccountPurse(ctx context.Context, stateRootHash string, addr string, purse string) error {
+	hash, err := accountHash(addr)
+	if err != nil {
+		return err
+	}
+
+	owned, _, err := ec.accountPurse(ctx, stateRootHash, hash, purse)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return fmt.Errorf("%w: %s is not a purse of %s", address.ErrInvalidAddress, purseAddress(purse), hash)
+	}
+
+	return nil
+}
+
+// accountPurse tells whether purse is the main purse or a named
+// key of the account accountHash in the global state stateRootHash.
+func (ec *Client) accountPurse(
+	ctx context.Context,
+	stateRootHash string,
+	accountHash string,
+	purse string,
+) (owned bool, main bool, err error) {
+	item, err := ec.node.GetStateItem(ctx, stateRootHash, accountHash, nil)
+	if rpc.IsNotFound(err) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("%w: could not get account %s", err, accountHash)
+	}
+	if item.Account == nil {
+		return false, false, nil
+	}
+
+	purse = purseAddress(purse)
+	if purseAddress(item.Account.MainPurse) == purse {
+		return true, true, nil
+	}
+	for _, namedKey := range item.Account.NamedKeys {
+		if strings.HasPrefix(namedKey.Key, urefPrefix) && purseAddress(namedKey.Key) == purse {
+			return true, false, nil
+		}
+	}
+
+	return false, false, nil
+}
+
+// purseOwners maps purses, without access rights, to the
+// account they belong to. Purses not resolved from the
+// transaction are resolved with resolvePurseOwners.
+type purseOwners struct {
+	accounts map[string]*RosettaTypes.AccountIdentifier
+}
+
+func newPurseOwners() *purseOwners {
+	return &purseOwners{
+		accounts: map[string]*RosettaTypes.AccountIdentifier{},
+	}
+}
+
+// accountHashes returns the account hashes owning
+// the purses of o, in lexicographic order.
+func (o *purseOwners) accountHashes() []string {
+	seen := map[string]bool{}
+	hashes := []string{}
+	for _, account := range o.accounts {
+		if !strings.HasPrefix(account.Address, accountHashPrefix) || seen[account.Address] {
+			continue
+		}
+		seen[account.Address] = true
+		hashes = append(hashes, account.Address)
+	}
+	sort.Strings(hashes)
+
+	return hashes
+}
+
+// account returns the *RosettaTypes.AccountIdentifier of a purse,
+// the purse itself if its owner is unknown.
+func (o *purseOwners) account(purse string) *RosettaTypes.AccountIdentifier {
+	if account, ok := o.accounts[purseAddress(purse)]; ok {
+		return account
+	}
+
+	return &RosettaTypes.AccountIdentifier{Address: purseAddress(purse)}
+}
+
+// addPurse records purse as owned by the account of owner,
+// an account hash or a public key, as its main purse or as
+// one of its other purses.
+func (ec *Client) addPurse(
+	ctx context.Context,
+	owners *purseOwners,
+	stateRootHash string,
+	owner string,
+	purse string,
+) error {
+	if _, ok := owners.accounts[purseAddress(purse)]; ok {
+		return nil
+	}
+
+	hash, err := accountHash(owner)
+	if err != nil {
+		return err
+	}
+
+	mainPurse, err := ec.accountMainPurse(ctx, stateRootHash, hash)
+	if err != nil {
+		return err
+	}
+
+	if purseAddress(mainPurse) == purseAddress(purse) {
+		owners.accounts[purseAddress(purse)] = MainAccount(hash)
+	} else {
+		owners.accounts[purseAddress(purse)] = PurseAccount(hash, purse)
+	}
+
+	return nil
+}
+
+// transactionPurseOwners returns the owners of the purses moved by
+// a transaction: the main purses of its initiator and of the block
+// proposer, and the source and target purses of its transfers.
+func (ec *Client) transactionPurseOwners(
+	ctx context.Context,
+	block *rpc.Block,
+	initiator string,
+	signerMainPurse string,
+	validatorMainPurse string,
+	transfers []*rpc.Transfer,
+) (*purseOwners, error) {
+	stateRootHash := block.Header.StateRootHash
+	owners := newPurseOwners()
+	if err := ec.addPurse(ctx, owners, stateRootHash, initiator, signerMainPurse); err != nil {
+		return nil, err
+	}
+	if len(validatorMainPurse) > 0 {
+		if err := ec.addPurse(ctx, owners, stateRootHash, block.Body.Proposer, validatorMainPurse); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, transfer := range transfers {
+		if len(transfer.From) > 0 {
+			if err := ec.addPurse(ctx, owners, stateRootHash, transfer.From, transfer.Source); err != nil {
+				return nil, err
+			}
+		}
+		if transfer.To != nil && len(*transfer.To) > 0 {
+			if err := ec.addPurse(ctx, owners, stateRootHash, *transfer.To, transfer.Target); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return owners, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+func TestBalancePurseSubAccount(t *testing.T) {
+	owner := testPublicKey(0xa1)
+	mainPurse, namedPurse, foreignPurse := testPurse(0xc1), testPurse(0xc2), testPurse(0xc3)
+	block := testBlock(10, "1.4.0", testPublicKey(0xa0))
+
+	node := newFakeNode()
+	node.addBlock(block)
+	node.addAccount(block.Header.StateRootHash, owner, mainPurse, rpc.NamedKey{Name: "savings", Key: namedPurse})
+	node.addAccount(block.Header.StateRootHash, testPublicKey(0xa2), foreignPurse)
+	node.setBalance(block.Header.StateRootHash, mainPurse, 100)
+	node.setBalance(block.Header.StateRootHash, namedPurse, 200)
+	node.setBalance(block.Header.StateRootHash, foreignPurse, 300)
+
+	tests := map[string]struct {
+		purse string
+		want  string
+		err   error
+	}{
+		"main purse": {
+			purse: mainPurse,
+			want:  "100",
+		},
+		"named key purse": {
+			purse: PurseWithoutIndex(namedPurse),
+			want:  "200",
+		},
+		"purse of another account": {
+			purse: foreignPurse,
+			err:   address.ErrInvalidAddress,
+		},
+		"invalid sub account": {
+			purse: "savings",
+			err:   address.ErrInvalidAddress,
+		},
+	}
+
+	client := newTestClient(t, node, nil)
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			response, err := client.Balance(context.Background(), &RosettaTypes.AccountIdentifier{
+				Address:    testAccountHash(owner),
+				SubAccount: &RosettaTypes.SubAccountIdentifier{Address: test.purse},
+			}, nil)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value := response.Balances[0].Value; value != test.want {
+				t.Fatalf("balance %s, want %s", value, test.want)
+			}
+		})
+	}
+}
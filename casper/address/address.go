@@ -0,0 +1,308 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package address parses and formats the addresses of casper-node:
+// public keys, account hashes and URefs.
+package address
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrInvalidAddress is returned when an address
+// cannot be parsed.
+var ErrInvalidAddress = errors.New("invalid address")
+
+const (
+	// ED25519Tag is the tag of ed25519 public keys.
+	ED25519Tag = byte(0x01)
+
+	// SECP256K1Tag is the tag of secp256k1 public keys.
+	SECP256K1Tag = byte(0x02)
+
+	// ED25519Length is the length of ed25519 public keys.
+	ED25519Length = 32
+
+	// SECP256K1Length is the length of compressed
+	// secp256k1 public keys.
+	SECP256K1Length = 33
+
+	// secp256k1EvenPrefix and secp256k1OddPrefix prefix
+	// compressed secp256k1 public keys, by parity of y.
+	secp256k1EvenPrefix = byte(0x02)
+	secp256k1OddPrefix  = byte(0x03)
+
+	// HashLength is the length of account hashes
+	// and of URef addresses.
+	HashLength = 32
+
+	// AccountHashPrefix prefixes formatted account hashes.
+	AccountHashPrefix = "account-hash-"
+
+	// URefPrefix prefixes formatted URefs.
+	URefPrefix = "uref-"
+
+	// AccessRightsReadAddWrite are the access
+	// rights of purses owned by an account.
+	AccessRightsReadAddWrite = uint8(7) // nolint:gomnd
+
+	maxAccessRights = uint8(7) // nolint:gomnd
+)
+
+// algorithms are the names of the public key algorithms,
+// by tag, as hashed into account hashes.
+var algorithms = map[byte]string{
+	ED25519Tag:   "ed25519",
+	SECP256K1Tag: "secp256k1",
+}
+
+// PublicKey is an ed25519 or secp256k1 public key.
+type PublicKey struct {
+	Tag   byte
+	Bytes []byte
+}
+
+// NewPublicKey returns the PublicKey of the provided tag and key
+// bytes, checking the length of the key and, for secp256k1, its
+// compression prefix.
+func NewPublicKey(tag byte, bytes []byte) (*PublicKey, error) {
+	var length int
+	switch tag {
+	case ED25519Tag:
+		length = ED25519Length
+	case SECP256K1Tag:
+		length = SECP256K1Length
+	default:
+		return nil, fmt.Errorf("%w: unsupported public key tag %02x", ErrInvalidAddress, tag)
+	}
+
+	if len(bytes) != length {
+		return nil, fmt.Errorf(
+			"%w: %s public keys are %d bytes long, got %d",
+			ErrInvalidAddress,
+			algorithms[tag],
+			length,
+			len(bytes),
+		)
+	}
+	if tag == SECP256K1Tag && bytes[0] != secp256k1EvenPrefix && bytes[0] != secp256k1OddPrefix {
+		return nil, fmt.Errorf("%w: secp256k1 public key is not compressed, prefix %02x", ErrInvalidAddress, bytes[0])
+	}
+
+	return &PublicKey{Tag: tag, Bytes: bytes}, nil
+}
+
+// ParsePublicKey parses the tagged hex of a public key.
+// The tag and the key are checksummed independently.
+func ParsePublicKey(s string) (*PublicKey, error) {
+	if len(s) < 2 { // nolint:gomnd
+		return nil, fmt.Errorf("%w: public key %q is too short", ErrInvalidAddress, s)
+	}
+
+	tag, err := DecodeHex(s[:2])
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := DecodeHex(s[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPublicKey(tag[0], bytes)
+}
+
+// String returns the lowercase tagged hex of the public key,
+// as served by casper-node.
+func (k *PublicKey) String() string {
+	return hex.EncodeToString([]byte{k.Tag}) + hex.EncodeToString(k.Bytes)
+}
+
+// Checksummed returns the tagged hex of the public key,
+// with the key CEP-57 checksummed.
+func (k *PublicKey) Checksummed() string {
+	return hex.EncodeToString([]byte{k.Tag}) + EncodeHex(k.Bytes)
+}
+
+// AccountHash returns the account hash of the public key, the blake2b
+// hash of the algorithm name, a zero byte and the key bytes.
+func (k *PublicKey) AccountHash() AccountHash {
+	preimage := append([]byte(algorithms[k.Tag]), 0)
+	preimage = append(preimage, k.Bytes...)
+
+	return AccountHash(blake2b.Sum256(preimage))
+}
+
+// AccountHash is the hash identifying an account.
+type AccountHash [HashLength]byte
+
+// ParseAccountHash parses a formatted account
+// hash ("account-hash-...").
+func ParseAccountHash(s string) (AccountHash, error) {
+	var hash AccountHash
+	if !strings.HasPrefix(s, AccountHashPrefix) {
+		return hash, fmt.Errorf("%w: %s is not an account hash", ErrInvalidAddress, s)
+	}
+
+	bytes, err := DecodeHex(strings.TrimPrefix(s, AccountHashPrefix))
+	if err != nil {
+		return hash, err
+	}
+	if len(bytes) != HashLength {
+		return hash, fmt.Errorf("%w: account hashes are %d bytes long, got %d", ErrInvalidAddress, HashLength, len(bytes))
+	}
+	copy(hash[:], bytes)
+
+	return hash, nil
+}
+
+// String returns the formatted account hash, lowercase.
+func (h AccountHash) String() string {
+	return AccountHashPrefix + hex.EncodeToString(h[:])
+}
+
+// Checksummed returns the formatted account hash,
+// CEP-57 checksummed.
+func (h AccountHash) Checksummed() string {
+	return AccountHashPrefix + EncodeHex(h[:])
+}
+
+// URef is an unforgeable reference to a value of the
+// global state, such as a purse, with its access rights.
+type URef struct {
+	Addr         [HashLength]byte
+	AccessRights uint8
+}
+
+// ParseURef parses a formatted URef ("uref-<addr>-<access rights>").
+func ParseURef(s string) (*URef, error) {
+	if strings.Count(s, "-") != 2 { // nolint:gomnd
+		return nil, fmt.Errorf("%w: %s is not a uref with access rights", ErrInvalidAddress, s)
+	}
+
+	return ParsePurse(s)
+}
+
+// ParsePurse parses a formatted URef, with or without its access
+// rights. URefs without access rights are given read, add and
+// write rights, those of purses owned by an account.
+func ParsePurse(s string) (*URef, error) {
+	if !strings.HasPrefix(s, URefPrefix) {
+		return nil, fmt.Errorf("%w: %s is not a uref", ErrInvalidAddress, s)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(s, URefPrefix), "-")
+	if len(parts) > 2 { // nolint:gomnd
+		return nil, fmt.Errorf("%w: %s is not a uref", ErrInvalidAddress, s)
+	}
+
+	uref := &URef{AccessRights: AccessRightsReadAddWrite}
+	addr, err := DecodeHex(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(addr) != HashLength {
+		return nil, fmt.Errorf("%w: uref addresses are %d bytes long, got %d", ErrInvalidAddress, HashLength, len(addr))
+	}
+	copy(uref.Addr[:], addr)
+
+	if len(parts) == 2 { // nolint:gomnd
+		if len(parts[1]) != 3 { // nolint:gomnd
+			return nil, fmt.Errorf("%w: invalid access rights of %s", ErrInvalidAddress, s)
+		}
+		rights, err := strconv.ParseUint(parts[1], 8, 8) // nolint:gomnd
+		if err != nil || uint8(rights) > maxAccessRights {
+			return nil, fmt.Errorf("%w: invalid access rights of %s", ErrInvalidAddress, s)
+		}
+		uref.AccessRights = uint8(rights)
+	}
+
+	return uref, nil
+}
+
+// String returns the formatted URef, with its access rights.
+func (u *URef) String() string {
+	return fmt.Sprintf("%s-%03o", u.Purse(), u.AccessRights)
+}
+
+// Purse returns the formatted URef, without its access rights.
+func (u *URef) Purse() string {
+	return URefPrefix + hex.EncodeToString(u.Addr[:])
+}
+
+// Address is a public key, an account hash or a URef.
+// Exactly one of its fields is set.
+type Address struct {
+	PublicKey   *PublicKey
+	AccountHash *AccountHash
+	URef        *URef
+}
+
+// Parse parses a public key, an account hash or a URef,
+// with or without access rights.
+func Parse(s string) (*Address, error) {
+	switch {
+	case strings.HasPrefix(s, AccountHashPrefix):
+		hash, err := ParseAccountHash(s)
+		if err != nil {
+			return nil, err
+		}
+		return &Address{AccountHash: &hash}, nil
+	case strings.HasPrefix(s, URefPrefix):
+		uref, err := ParsePurse(s)
+		if err != nil {
+			return nil, err
+		}
+		return &Address{URef: uref}, nil
+	}
+
+	publicKey, err := ParsePublicKey(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Address{PublicKey: publicKey}, nil
+}
+
+// Account returns the account hash of a public key or an account
+// hash address. It returns ErrInvalidAddress for URefs.
+func (a *Address) Account() (AccountHash, error) {
+	switch {
+	case a.AccountHash != nil:
+		return *a.AccountHash, nil
+	case a.PublicKey != nil:
+		return a.PublicKey.AccountHash(), nil
+	}
+
+	return AccountHash{}, fmt.Errorf("%w: %s is not an account", ErrInvalidAddress, a.String())
+}
+
+// String returns the lowercase formatted address.
+func (a *Address) String() string {
+	switch {
+	case a.PublicKey != nil:
+		return a.PublicKey.String()
+	case a.AccountHash != nil:
+		return a.AccountHash.String()
+	case a.URef != nil:
+		return a.URef.String()
+	}
+
+	return ""
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package address
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParsePublicKey(t *testing.T) {
+	tests := map[string]struct {
+		publicKey string
+		invalid   bool
+	}{
+		"ed25519": {
+			publicKey: "01" + strings.Repeat("ab", ED25519Length),
+		},
+		"secp256k1 even": {
+			publicKey: "02" + "02" + strings.Repeat("ab", SECP256K1Length-1),
+		},
+		"secp256k1 odd": {
+			publicKey: "02" + "03" + strings.Repeat("ab", SECP256K1Length-1),
+		},
+		"uncompressed secp256k1 prefix": {
+			publicKey: "02" + "04" + strings.Repeat("ab", SECP256K1Length-1),
+			invalid:   true,
+		},
+		"secp256k1 without prefix": {
+			publicKey: "02" + strings.Repeat("ab", SECP256K1Length),
+			invalid:   true,
+		},
+		"short ed25519": {
+			publicKey: "01" + strings.Repeat("ab", ED25519Length-1),
+			invalid:   true,
+		},
+		"unknown tag": {
+			publicKey: "03" + strings.Repeat("ab", ED25519Length),
+			invalid:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			publicKey, err := ParsePublicKey(test.publicKey)
+			if test.invalid {
+				if !errors.Is(err, ErrInvalidAddress) {
+					t.Fatalf("error %v, want %v", err, ErrInvalidAddress)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if publicKey.String() != test.publicKey {
+				t.Fatalf("public key %s, want %s", publicKey, test.publicKey)
+			}
+		})
+	}
+}
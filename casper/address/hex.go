@@ -0,0 +1,81 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package address
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// maxChecksummedBytes is the length above which hex strings
+// are not checksummed, as defined by CEP-57.
+const maxChecksummedBytes = 75
+
+const (
+	lowerHexChars = "0123456789abcdef"
+	upperHexChars = "0123456789ABCDEF"
+)
+
+// EncodeHex returns the CEP-57 checksummed hex representation
+// of b: the case of each letter is given by a bit of the blake2b
+// hash of b. Inputs longer than 75 bytes are encoded lowercase.
+func EncodeHex(b []byte) string {
+	if len(b) > maxChecksummedBytes {
+		return hex.EncodeToString(b)
+	}
+
+	hash := blake2b.Sum256(b)
+	bit := 0
+	nextBit := func() bool {
+		value := hash[(bit/8)%len(hash)]>>(bit%8)&1 == 1 // nolint:gomnd
+		bit++
+		return value
+	}
+
+	var encoded strings.Builder
+	for _, value := range b {
+		for _, nibble := range []byte{value >> 4, value & 0x0f} { // nolint:gomnd
+			if nibble >= 10 && nextBit() { // nolint:gomnd
+				encoded.WriteByte(upperHexChars[nibble])
+				continue
+			}
+			encoded.WriteByte(lowerHexChars[nibble])
+		}
+	}
+
+	return encoded.String()
+}
+
+// DecodeHex decodes a hex string. Mixed case strings must
+// carry a valid CEP-57 checksum, single case strings are
+// accepted as is.
+func DecodeHex(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not hex encoded", ErrInvalidAddress, s)
+	}
+
+	if len(b) > maxChecksummedBytes || s == strings.ToLower(s) || s == strings.ToUpper(s) {
+		return b, nil
+	}
+	if EncodeHex(b) != s {
+		return nil, fmt.Errorf("%w: invalid checksum of %s", ErrInvalidAddress, s)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+)
+
+const (
+	// ProposerMetadataKey, StateRootHashMetadataKey and the following
+	// keys hold the fields of a block header in the block metadata,
+	// along with EraIDMetadataKey.
+	ProposerMetadataKey        = "proposer"
+	StateRootHashMetadataKey   = "state_root_hash"
+	AccumulatedSeedMetadataKey = "accumulated_seed"
+	ProtocolVersionMetadataKey = "protocol_version"
+	RandomBitMetadataKey       = "random_bit"
+
+	// EraEndMetadataKey holds the era report and the validator
+	// weights of the next era, set for switch blocks only.
+	EraEndMetadataKey = "era_end"
+)
+
+// blockMetadata returns the metadata of block.
+func blockMetadata(block *rpc.Block) map[string]interface{} {
+	metadata := map[string]interface{}{
+		EraIDMetadataKey:           block.Header.EraID,
+		ProposerMetadataKey:        block.Body.Proposer,
+		StateRootHashMetadataKey:   block.Header.StateRootHash,
+		AccumulatedSeedMetadataKey: block.Header.AccumulatedSeed,
+		ProtocolVersionMetadataKey: block.Header.ProtocolVersion,
+		RandomBitMetadataKey:       block.Header.RandomBit,
+	}
+	if block.Header.EraEnd != nil {
+		metadata[EraEndMetadataKey] = block.Header.EraEnd
+	}
+
+	return metadata
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// switchBlockV1 is a chain_get_block result of a 1.x switch
+// block, whose reward amounts are numbers.
+const switchBlockV1 = `{
+  "api_version": "1.4.15",
+  "block": {
+    "hash": "1f5b1ba4c1c5e0e0d6a8c7e3b6f7e5d8c2a1b0f9e8d7c6b5a4f3e2d1c0b9a8f7",
+    "header": {
+      "parent_hash": "0e4b0a93b0b4d0d0c597b6d2a5e6d4c7b190af8d7c6b5a4938e2d1c0b9a8f7e6",
+      "state_root_hash": "9a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9",
+      "body_hash": "5f0d0a4c1b2a3e4d5c6b7a8f9e0d1c2b3a4f5e6d7c8b9a0f1e2d3c4b5a6f7e8d",
+      "random_bit": true,
+      "accumulated_seed": "3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b",
+      "era_end": {
+        "era_report": {
+          "equivocators": [],
+          "rewards": [
+            {"validator": "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c", "amount": 1202458594726},
+            {"validator": "0203d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c", "amount": 98765432109876543210}
+          ],
+          "inactive_validators": ["0203d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c"]
+        },
+        "next_era_validator_weights": [
+          {"validator": "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c", "weight": "11000000000000000"}
+        ]
+      },
+      "timestamp": "2022-06-01T12:00:00.000Z",
+      "era_id": 5000,
+      "height": 800000,
+      "protocol_version": "1.4.15"
+    },
+    "body": {
+      "proposer": "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c",
+      "deploy_hashes": [],
+      "transfer_hashes": []
+    },
+    "proofs": []
+  }
+}`
+
+// switchBlockV2 is a chain_get_block result of a 2.0 switch block,
+// rewarding a validator with several amounts.
+const switchBlockV2 = `{
+  "api_version": "2.0.0",
+  "block_with_signatures": {
+    "block": {
+      "Version2": {
+        "hash": "2a6c2cb5d2d6f1f1e7b9d8f4c7a8f6e9d3b2c1a0f9e8d7c6b5a4f3e2d1c0b9a8",
+        "header": {
+          "parent_hash": "1f5b1ba4c1c5e0e0d6a8c7e3b6f7e5d8c2a1b0f9e8d7c6b5a4f3e2d1c0b9a8f7",
+          "state_root_hash": "ab2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90a",
+          "body_hash": "6a1e1b5d2c3b4f5e6d7c8b9a0f1e2d3c4b5a6f7e8d9c0b1a2f3e4d5c6b7a8f9e",
+          "random_bit": false,
+          "accumulated_seed": "4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+          "era_end": {
+            "equivocators": [],
+            "inactive_validators": [],
+            "next_era_validator_weights": [
+              {"validator": "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c", "weight": "12000000000000000"}
+            ],
+            "rewards": {
+              "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c": ["1000000000", "234"],
+              "0203d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c": "5"
+            },
+            "next_era_gas_price": 1
+          },
+          "timestamp": "2024-10-09T12:00:00.000Z",
+          "era_id": 15000,
+          "height": 4000000,
+          "protocol_version": "2.0.0",
+          "proposer": "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c",
+          "current_gas_price": 1,
+          "last_switch_block_hash": "0e4b0a93b0b4d0d0c597b6d2a5e6d4c7b190af8d7c6b5a4938e2d1c0b9a8f7e6"
+        },
+        "body": {
+          "transactions": {"0": [], "1": [], "2": [], "3": []},
+          "rewarded_signatures": []
+        }
+      }
+    },
+    "proofs": []
+  }
+}`
+
+// getBlockFixture returns the block of a chain_get_block
+// result, decoded by the node client.
+func getBlockFixture(t *testing.T, result string) *rpc.Block {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid request: %s", err)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":%s}`, request.ID, result)
+	}))
+	defer server.Close()
+
+	node, err := rpc.NewClient([]string{server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := node.GetBlock(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+func TestBlockMetadata(t *testing.T) {
+	const (
+		validator = "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c"
+		inactive  = "0203d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c"
+	)
+
+	tests := map[string]struct {
+		result string
+		want   map[string]interface{}
+	}{
+		"1.x switch block": {
+			result: switchBlockV1,
+			want: map[string]interface{}{
+				EraIDMetadataKey:           uint64(5000),
+				ProposerMetadataKey:        validator,
+				StateRootHashMetadataKey:   "9a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9",
+				AccumulatedSeedMetadataKey: "3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b",
+				ProtocolVersionMetadataKey: "1.4.15",
+				RandomBitMetadataKey:       true,
+				EraEndMetadataKey: &rpc.EraEnd{
+					EraReport: rpc.EraReport{
+						Equivocators: []string{},
+						Rewards: []rpc.EraReward{
+							{Validator: validator, Amount: "1202458594726"},
+							{Validator: inactive, Amount: "98765432109876543210"},
+						},
+						InactiveValidators: []string{inactive},
+					},
+					NextEraValidatorWeights: []rpc.ValidatorWeight{
+						{Validator: validator, Weight: "11000000000000000"},
+					},
+				},
+			},
+		},
+		"2.0 switch block": {
+			result: switchBlockV2,
+			want: map[string]interface{}{
+				EraIDMetadataKey:           uint64(15000),
+				ProposerMetadataKey:        validator,
+				StateRootHashMetadataKey:   "ab2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90a",
+				AccumulatedSeedMetadataKey: "4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c",
+				ProtocolVersionMetadataKey: "2.0.0",
+				RandomBitMetadataKey:       false,
+				EraEndMetadataKey: &rpc.EraEnd{
+					EraReport: rpc.EraReport{
+						Equivocators: []string{},
+						Rewards: []rpc.EraReward{
+							{Validator: validator, Amount: "1000000234"},
+							{Validator: inactive, Amount: "5"},
+						},
+						InactiveValidators: []string{},
+					},
+					NextEraValidatorWeights: []rpc.ValidatorWeight{
+						{Validator: validator, Weight: "12000000000000000"},
+					},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			block := getBlockFixture(t, test.result)
+
+			metadata := blockMetadata(block)
+			if !reflect.DeepEqual(metadata, test.want) {
+				t.Fatalf("metadata %s, want %s", RosettaTypes.PrintStruct(metadata), RosettaTypes.PrintStruct(test.want))
+			}
+
+			// Blocks other than switch blocks have no era end.
+			block.Header.EraEnd = nil
+			if _, ok := blockMetadata(block)[EraEndMetadataKey]; ok {
+				t.Fatal("era end of a block which is not a switch block")
+			}
+		})
+	}
+}
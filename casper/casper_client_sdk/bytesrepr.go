@@ -0,0 +1,83 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper_client_sdk
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/clvalue"
+)
+
+// Tags of the executable deploy items.
+const (
+	moduleBytesTag = byte(0)
+	transferTag    = byte(5)
+)
+
+// Types of the runtime arguments of native transfers.
+var (
+	amountCLType      = clvalue.U512Type
+	accountHashCLType = clvalue.ByteArrayType(address.HashLength)
+	idCLType          = clvalue.OptionType(clvalue.U64Type)
+)
+
+// isTargetCLType tells whether t is the type of a public
+// key or of an account hash, the types of transfer targets.
+func isTargetCLType(t *clvalue.CLType) bool {
+	if t == nil {
+		return false
+	}
+
+	return t.Tag == clvalue.PublicKeyTag || (t.Tag == clvalue.ByteArrayTag && t.Size == address.HashLength)
+}
+
+// u512Value returns the U512 CLValue of a decimal amount.
+func u512Value(amount string) (*clvalue.CLValue, error) {
+	value, ok := new(big.Int).SetString(amount, 10) // nolint:gomnd
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid U512 %s", clvalue.ErrInvalidCLValue, amount)
+	}
+
+	return clvalue.New(amountCLType, value)
+}
+
+// runtimeArg returns the runtime argument name
+// of the hex bytes of a value of type clType.
+func runtimeArg(name string, clType *clvalue.CLType, bytesHex string) (clvalue.NamedArg, error) {
+	b, err := hex.DecodeString(bytesHex)
+	if err != nil {
+		return clvalue.NamedArg{}, fmt.Errorf("%w: invalid bytes of argument %s", err, name)
+	}
+
+	value, err := clvalue.NewFromBytes(clType, b)
+	if err != nil {
+		return clvalue.NamedArg{}, fmt.Errorf("%w: invalid argument %s", err, name)
+	}
+
+	return clvalue.NamedArg{Name: name, Value: value}, nil
+}
+
+// moduleBytes returns the length prefixed bytes of a module.
+func moduleBytes(module []byte) ([]byte, error) {
+	values := make([]interface{}, len(module))
+	for i, value := range module {
+		values[i] = value
+	}
+
+	return clvalue.Encode(clvalue.ListType(clvalue.U8Type), values)
+}
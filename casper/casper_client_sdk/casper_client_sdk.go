@@ -1,22 +1,93 @@
 package casper_client_sdk
 
-import "time"
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
 
-// "context"
-// "fmt"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/clvalue"
 
-// NewDeployHeader creates a new instance of a DeployHeader.
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// DefaultPaymentAmount is the standard payment
+	// of a native transfer, in motes.
+	DefaultPaymentAmount = "100000000"
+
+	// DefaultTTL is the time to live of deploys.
+	DefaultTTL = "30m"
+
+	// DefaultGasPrice is the gas price of deploys.
+	DefaultGasPrice = uint64(1)
+)
+
+// NewDeploy creates a native transfer deploy from deployParams,
+// hashed as by casper-client make-transfer. SrcAccount must be
+// a public key and TargetAccount a public key or an account hash.
 func NewDeploy(
 	deployParams DeployParams,
-) *Deploy {
-	// payment := NewPayment(paymentAmount)
-	// session := NewSession(transferAmount, targetAccount, transferID)
+) (*Deploy, error) {
+	account, err := address.ParsePublicKey(deployParams.SrcAccount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid source account", err)
+	}
 
-	return &Deploy{
-		// ModuleBytes: moduleBytes,
+	paymentAmount := deployParams.PaymentAmount
+	if len(paymentAmount) == 0 {
+		paymentAmount = DefaultPaymentAmount
+	}
+	payment, err := NewPayment(paymentAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := NewSession(deployParams.TransferAmount, deployParams.TargetAccount, deployParams.TransferID)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentBytes, err := payment.Bytes()
+	if err != nil {
+		return nil, err
 	}
+	sessionBytes, err := session.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	bodyHash := blake2b.Sum256(append(paymentBytes, sessionBytes...))
+
+	header := NewDeployHeader(account.String(), deployParams.ChainName, hex.EncodeToString(bodyHash[:]))
+	if len(deployParams.GasPrice) > 0 {
+		header.GasPrice, err = strconv.ParseUint(deployParams.GasPrice, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid gas price %s", err, deployParams.GasPrice)
+		}
+	}
+	if !deployParams.Timestamp.IsZero() {
+		header.Timestamp = deployParams.Timestamp.UTC().Truncate(time.Millisecond)
+	}
+
+	headerBytes, err := header.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	hash := blake2b.Sum256(headerBytes)
+
+	return &Deploy{
+		Hash:      hex.EncodeToString(hash[:]),
+		Header:    *header,
+		Payment:   *payment,
+		Session:   *session,
+		Approvals: []Approval{},
+	}, nil
 }
 
+// DeployParams are the parameters of a native transfer deploy.
+// PaymentAmount, GasPrice and Timestamp are optional.
 type DeployParams struct {
 	ChainName      string
 	TransferAmount string
@@ -25,6 +96,7 @@ type DeployParams struct {
 	SrcAccount     string
 	GasPrice       string
 	TransferID     int64
+	Timestamp      time.Time
 }
 
 // NewDeployHeader creates a new instance of a DeployHeader.
@@ -34,50 +106,95 @@ func NewDeployHeader(
 	bodyHash string,
 ) *DeployHeader {
 	return &DeployHeader{
-		Account:      account,
-		Timestamp:    time.Now(),
-		TTL:          "30m",
-		GasPrice:     1,
+		Account: account,
+		// Deploy timestamps have a millisecond precision.
+		Timestamp:    time.Now().UTC().Truncate(time.Millisecond),
+		TTL:          DefaultTTL,
+		GasPrice:     DefaultGasPrice,
 		BodyHash:     bodyHash,
-		Dependencies: nil,
+		Dependencies: []string{},
 		ChainName:    chainName,
 	}
 }
 
-// NewPayment creates a new instance of a Payment.
+// NewPayment creates a new instance of a standard Payment.
 func NewPayment(
 	paymentAmount string,
-) *Payment {
+) (*Payment, error) {
+	amount, err := u512Value(paymentAmount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid payment amount", err)
+	}
+
 	var moduleBytes ModuleBytes
 	moduleBytes.Module_Bytes = ""
 	moduleBytes.Args.Amount.CLType = "U512"
-	// moduleBytes.Args.Amount.AmountBytes = paymentAmount
+	moduleBytes.Args.Amount.AmountBytes = hex.EncodeToString(amount.Bytes)
 	moduleBytes.Args.Amount.Amount = paymentAmount
 
 	return &Payment{
 		ModuleBytes: moduleBytes,
-	}
+	}, nil
 }
 
-// NewSession creates a new instance of a Session.
+// NewSession creates a new instance of a native transfer
+// Session. targetAccount is a public key or an account hash.
 func NewSession(
 	transferAmount string,
 	targetAccount string,
 	transferID int64,
-) *Session {
+) (*Session, error) {
+	amount, err := u512Value(transferAmount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid transfer amount", err)
+	}
+
+	targetAddress, err := address.Parse(targetAccount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid target account", err)
+	}
+
+	// Public keys are kept as such, as by casper-client, the
+	// mint transferring to the account of the public key.
+	var target *clvalue.CLValue
+	var parsedTarget string
+	if targetAddress.PublicKey != nil {
+		target, err = clvalue.New(clvalue.PublicKeyType, targetAddress.PublicKey)
+		parsedTarget = targetAddress.PublicKey.String()
+	} else {
+		targetHash, hashErr := targetAddress.Account()
+		if hashErr != nil {
+			return nil, fmt.Errorf("%w: invalid target account", hashErr)
+		}
+		target, err = clvalue.New(accountHashCLType, targetHash[:])
+		parsedTarget = hex.EncodeToString(targetHash[:])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if transferID < 0 {
+		return nil, fmt.Errorf("invalid transfer id %d", transferID)
+	}
+	id, err := clvalue.New(idCLType, &clvalue.Option{Value: uint64(transferID)})
+	if err != nil {
+		return nil, err
+	}
+
 	var transfer Transfer
 	transfer.Args.Amount.CLType = "U512"
-	// transfer.Args.Amount.AmountBytes = transferAmount
+	transfer.Args.Amount.AmountBytes = hex.EncodeToString(amount.Bytes)
 	transfer.Args.Amount.Amount = transferAmount
-	transfer.Args.Target.CLType.ByteArray = 32
-	// transfer.Args.Target.AccountBytes =
-	transfer.Args.Target.Account = targetAccount
-	// transfer.Args.ID.ID_Bytes =
+	transfer.Args.Target.CLType = target.Type
+	transfer.Args.Target.AccountBytes = hex.EncodeToString(target.Bytes)
+	transfer.Args.Target.Account = parsedTarget
+	transfer.Args.ID.CLType.Option = "U64"
+	transfer.Args.ID.ID_Bytes = hex.EncodeToString(id.Bytes)
 	transfer.Args.ID.ID = transferID
 
 	return &Session{
 		Transfer: transfer,
-	}
+	}, nil
 }
 
 // NewDeployHeader creates a new instance of a DeployHeader.
@@ -101,16 +218,91 @@ type DeployHeader struct {
 	Account      string    `json:"account"`
 	Timestamp    time.Time `json:"timestamp"`
 	TTL          string    `json:"ttl"`
-	GasPrice     int       `json:"gas_price"`
+	GasPrice     uint64    `json:"gas_price"`
 	BodyHash     string    `json:"body_hash"`
 	Dependencies []string  `json:"dependencies"`
 	ChainName    string    `json:"chain_name"`
 }
 
+// Bytes returns the bytesrepr serialization of the header,
+// whose blake2b hash is the deploy hash. The TTL must be
+// a Go duration, such as DefaultTTL.
+func (h *DeployHeader) Bytes() ([]byte, error) {
+	account, err := address.ParsePublicKey(h.Account)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid deploy account", err)
+	}
+
+	ttl, err := time.ParseDuration(h.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ttl %s", err, h.TTL)
+	}
+
+	bodyHash, err := hex.DecodeString(h.BodyHash)
+	if err != nil || len(bodyHash) != blake2b.Size256 {
+		return nil, fmt.Errorf("invalid body hash %s", h.BodyHash)
+	}
+
+	dependencies := make([]interface{}, len(h.Dependencies))
+	for i, dependency := range h.Dependencies {
+		hash, err := hex.DecodeString(dependency)
+		if err != nil || len(hash) != blake2b.Size256 {
+			return nil, fmt.Errorf("invalid dependency %s", dependency)
+		}
+		dependencies[i] = hash
+	}
+
+	hashCLType := clvalue.ByteArrayType(blake2b.Size256)
+	fields := []struct {
+		clType *clvalue.CLType
+		value  interface{}
+	}{
+		{clvalue.PublicKeyType, account},
+		{clvalue.U64Type, uint64(h.Timestamp.UnixNano() / int64(time.Millisecond))},
+		{clvalue.U64Type, uint64(ttl / time.Millisecond)},
+		{clvalue.U64Type, h.GasPrice},
+		{hashCLType, bodyHash},
+		{clvalue.ListType(hashCLType), dependencies},
+		{clvalue.StringType, h.ChainName},
+	}
+
+	var b []byte
+	for _, field := range fields {
+		fieldBytes, err := clvalue.Encode(field.clType, field.value)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, fieldBytes...)
+	}
+
+	return b, nil
+}
+
 type Payment struct {
 	ModuleBytes ModuleBytes `json:"ModuleBytes"`
 }
 
+// Bytes returns the bytesrepr serialization of the payment.
+func (p *Payment) Bytes() ([]byte, error) {
+	module, err := hex.DecodeString(p.ModuleBytes.Module_Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid module bytes", err)
+	}
+
+	encodedModule, err := moduleBytes(module)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := runtimeArg("amount", amountCLType, p.ModuleBytes.Args.Amount.AmountBytes)
+	if err != nil {
+		return nil, err
+	}
+	args := clvalue.RuntimeArgs{amount}
+
+	return append(append([]byte{moduleBytesTag}, encodedModule...), args.Bytes()...), nil
+}
+
 type ModuleBytes struct {
 	Module_Bytes string      `json:"module_bytes"`
 	Args         PaymentArgs `json:"args"`
@@ -120,6 +312,22 @@ type PaymentArgs struct {
 	Amount StandardAmount `json:"amount"`
 }
 
+// MarshalJSON encodes the arguments as
+// a list of [name, value] pairs.
+func (a PaymentArgs) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]namedArg{{"amount", a.Amount}})
+}
+
+// UnmarshalJSON decodes a list of [name, value] pairs.
+func (a *PaymentArgs) UnmarshalJSON(data []byte) error {
+	args, err := unmarshalNamedArgs(data)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalArg(args, "amount", &a.Amount)
+}
+
 type StandardAmount struct {
 	CLType      string `json:"cl_type"`
 	AmountBytes string `json:"bytes"`
@@ -130,6 +338,29 @@ type Session struct {
 	Transfer Transfer `json:"Transfer"`
 }
 
+// Bytes returns the bytesrepr serialization of the session.
+func (s *Session) Bytes() ([]byte, error) {
+	amount, err := runtimeArg("amount", amountCLType, s.Transfer.Args.Amount.AmountBytes)
+	if err != nil {
+		return nil, err
+	}
+	targetType := s.Transfer.Args.Target.CLType
+	if !isTargetCLType(targetType) {
+		return nil, fmt.Errorf("%w: invalid type of argument target", clvalue.ErrInvalidCLValue)
+	}
+	target, err := runtimeArg("target", targetType, s.Transfer.Args.Target.AccountBytes)
+	if err != nil {
+		return nil, err
+	}
+	id, err := runtimeArg("id", idCLType, s.Transfer.Args.ID.ID_Bytes)
+	if err != nil {
+		return nil, err
+	}
+	args := clvalue.RuntimeArgs{amount, target, id}
+
+	return append([]byte{transferTag}, args.Bytes()...), nil
+}
+
 type Transfer struct {
 	Args TransferArgs `json:"args"`
 }
@@ -140,10 +371,39 @@ type TransferArgs struct {
 	ID     TransferID     `json:"id"`
 }
 
+// MarshalJSON encodes the arguments as
+// a list of [name, value] pairs.
+func (a TransferArgs) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]namedArg{
+		{"amount", a.Amount},
+		{"target", a.Target},
+		{"id", a.ID},
+	})
+}
+
+// UnmarshalJSON decodes a list of [name, value] pairs.
+func (a *TransferArgs) UnmarshalJSON(data []byte) error {
+	args, err := unmarshalNamedArgs(data)
+	if err != nil {
+		return err
+	}
+
+	if err := unmarshalArg(args, "amount", &a.Amount); err != nil {
+		return err
+	}
+	if err := unmarshalArg(args, "target", &a.Target); err != nil {
+		return err
+	}
+
+	return unmarshalArg(args, "id", &a.ID)
+}
+
+// TargetAccount is the target of a transfer, a PublicKey
+// or the ByteArray of an account hash.
 type TargetAccount struct {
-	CLType       AccountCLType `json:"cl_type"`
-	AccountBytes string        `json:"bytes"`
-	Account      string        `json:"parsed"`
+	CLType       *clvalue.CLType `json:"cl_type"`
+	AccountBytes string          `json:"bytes"`
+	Account      string          `json:"parsed"`
 }
 
 type TransferID struct {
@@ -152,10 +412,6 @@ type TransferID struct {
 	ID       int64     `json:"parsed"`
 }
 
-type AccountCLType struct {
-	ByteArray uint `json:"ByteArray"`
-}
-
 type ID_CLType struct {
 	Option string `json:"Option"`
 }
@@ -164,3 +420,46 @@ type Approval struct {
 	Signer    string `json:"signer"`
 	Signature string `json:"signature"`
 }
+
+// namedArg is a runtime argument, encoded
+// by the node as a [name, value] pair.
+type namedArg struct {
+	name  string
+	value interface{}
+}
+
+func (a namedArg) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{a.name, a.value})
+}
+
+// unmarshalNamedArgs decodes a list of [name, value]
+// pairs into the values by name.
+func unmarshalNamedArgs(data []byte) (map[string]json.RawMessage, error) {
+	var pairs [][2]json.RawMessage
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, fmt.Errorf("%w: invalid runtime args", err)
+	}
+
+	args := make(map[string]json.RawMessage, len(pairs))
+	for _, pair := range pairs {
+		var name string
+		if err := json.Unmarshal(pair[0], &name); err != nil {
+			return nil, fmt.Errorf("%w: invalid runtime arg name", err)
+		}
+		args[name] = pair[1]
+	}
+
+	return args, nil
+}
+
+func unmarshalArg(args map[string]json.RawMessage, name string, value interface{}) error {
+	arg, ok := args[name]
+	if !ok {
+		return fmt.Errorf("missing argument %s", name)
+	}
+	if err := json.Unmarshal(arg, value); err != nil {
+		return fmt.Errorf("%w: invalid argument %s", err, name)
+	}
+
+	return nil
+}
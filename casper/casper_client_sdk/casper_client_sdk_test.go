@@ -0,0 +1,127 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper_client_sdk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The hashes below are the blake2b hashes of the bytesrepr
+// serialization of the deploy, as defined by casper-types.
+func TestNewDeploy(t *testing.T) {
+	tests := map[string]struct {
+		target     string
+		clType     string
+		parsed     string
+		bodyHash   string
+		deployHash string
+	}{
+		"secp256k1 public key": {
+			target:     "02" + "02" + strings.Repeat("bb", 32),
+			clType:     `"PublicKey"`,
+			parsed:     "02" + "02" + strings.Repeat("bb", 32),
+			bodyHash:   "0008517b4d0e1abde9f9427d495110076a09af6fa14a1ff0a7b8bc09fffe5a4d",
+			deployHash: "f8c9d357906390cc837edc231fd59a6f9be0025fc2ab36f37857e5c5b19f3631",
+		},
+		"ed25519 public key": {
+			target:     "01" + strings.Repeat("dd", 32),
+			clType:     `"PublicKey"`,
+			parsed:     "01" + strings.Repeat("dd", 32),
+			bodyHash:   "95afef9052b36ae3bf3f7049e4a8b465daa46eaccbfb464c1de05071e8d64932",
+			deployHash: "cbd2d47471e4214db43ee7b5c4cb0fb815b49d974b5dcfbc0535bd95cb322a3e",
+		},
+		"account hash": {
+			target:     "account-hash-" + strings.Repeat("cc", 32),
+			clType:     `{"ByteArray":32}`,
+			parsed:     strings.Repeat("cc", 32),
+			bodyHash:   "1d6fe5ac28977bdd596857e68f3b81b55bd5ca2fa5592abe19a8a71b163c552d",
+			deployHash: "bc1e5362e042dbbe5033b8e22b4ad2f210b73e00691c9558c330e76b3a6ca207",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deploy, err := NewDeploy(DeployParams{
+				ChainName:      "casper-test",
+				TransferAmount: "2500000000",
+				TargetAccount:  test.target,
+				SrcAccount:     "01" + strings.Repeat("aa", 32),
+				TransferID:     7,
+				Timestamp:      time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deploy.Header.BodyHash != test.bodyHash {
+				t.Fatalf("body hash %s, want %s", deploy.Header.BodyHash, test.bodyHash)
+			}
+			if deploy.Hash != test.deployHash {
+				t.Fatalf("deploy hash %s, want %s", deploy.Hash, test.deployHash)
+			}
+
+			clType, err := json.Marshal(deploy.Session.Transfer.Args.Target.CLType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(clType) != test.clType || deploy.Session.Transfer.Args.Target.Account != test.parsed {
+				t.Fatalf("target %s %s, want %s %s", clType, deploy.Session.Transfer.Args.Target.Account, test.clType, test.parsed)
+			}
+
+			// The unsigned deploy is passed around as JSON.
+			data, err := json.Marshal(deploy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded Deploy
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			sessionBytes, err := decoded.Session.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantBytes, err := deploy.Session.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(sessionBytes) != string(wantBytes) {
+				t.Fatalf("session %x, want %x", sessionBytes, wantBytes)
+			}
+		})
+	}
+}
+
+func TestNewDeployInvalidTarget(t *testing.T) {
+	for name, target := range map[string]string{
+		"purse":            "uref-" + strings.Repeat("cc", 32) + "-007",
+		"short hash":       "account-hash-" + strings.Repeat("cc", 31),
+		"uncompressed key": "02" + "04" + strings.Repeat("bb", 32),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewDeploy(DeployParams{
+				ChainName:      "casper-test",
+				TransferAmount: "2500000000",
+				TargetAccount:  target,
+				SrcAccount:     "01" + strings.Repeat("aa", 32),
+			})
+			if err == nil {
+				t.Fatalf("deploy to %s", target)
+			}
+		})
+	}
+}
@@ -16,36 +16,172 @@ package casper
 
 import (
 	"context"
-	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"math/big"
 	"strings"
-	"time"
+	"sync"
 
-	CasperSDK "github.com/casper-ecosystem/casper-golang-sdk/sdk"
-	"golang.org/x/crypto/blake2b"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 
 	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
 )
 
 const (
-	gethHTTPTimeout = 120 * time.Second
+	// DefaultMaxConcurrency is the default maximum number of
+	// deploys fetched concurrently when assembling blocks.
+	DefaultMaxConcurrency = int64(16) // nolint:gomnd
+
+	semaphoreDeployWeight = int64(1) // nolint:gomnd
+	ED25519               = "ed25519"
+	SECP256K1             = "secp256k1"
 
-	maxTraceConcurrency  = int64(16) // nolint:gomnd
-	semaphoreTraceWeight = int64(1)  // nolint:gomnd
-	ED25519              = "ed25519"
-	SECP256K1            = "secp256k1"
+	// systemPublicKey is the proposer of the genesis block
+	// and of the switch blocks created by protocol upgrades.
+	systemPublicKey = "00"
 )
 
+// NodeClient is the casper-node RPC API used by Client.
+// It is implemented by *rpc.Client.
+type NodeClient interface {
+	GetStatus(ctx context.Context) (*rpc.StatusResult, error)
+	GetPeers(ctx context.Context) ([]rpc.Peer, error)
+	GetBlock(ctx context.Context, blockIdentifier *rpc.BlockIdentifier) (*rpc.Block, error)
+	GetBlockTransfers(ctx context.Context, blockIdentifier *rpc.BlockIdentifier) ([]*rpc.Transfer, error)
+	GetDeploy(ctx context.Context, hash string) (*rpc.DeployResult, error)
+	GetTransaction(ctx context.Context, hash rpc.TransactionHash) (*rpc.TransactionResult, error)
+	GetStateItem(ctx context.Context, stateRootHash string, key string, path []string) (*rpc.StoredValue, error)
+	QueryGlobalState(
+		ctx context.Context,
+		stateIdentifier *rpc.StateIdentifier,
+		key string,
+		path []string,
+	) (*rpc.StoredValue, error)
+	GetBalance(ctx context.Context, stateRootHash string, purseURef string) (*big.Int, error)
+	QueryBalance(
+		ctx context.Context,
+		stateIdentifier *rpc.StateIdentifier,
+		purseIdentifier *rpc.PurseIdentifier,
+	) (*big.Int, error)
+	PutDeploy(ctx context.Context, deploy json.RawMessage) (string, error)
+	GetAuctionInfo(ctx context.Context, blockIdentifier *rpc.BlockIdentifier) (*rpc.AuctionState, error)
+	GetEraInfoBySwitchBlock(ctx context.Context, blockIdentifier *rpc.BlockIdentifier) (*rpc.EraSummary, error)
+	GetEraSummary(ctx context.Context, blockIdentifier *rpc.BlockIdentifier) (*rpc.EraSummary, error)
+	GetChainspec(ctx context.Context) (*rpc.ChainspecRawBytes, error)
+}
+
+// ClientOptions are the settings of a Client.
+type ClientOptions struct {
+	// MaxConcurrency is the maximum number of deploys
+	// fetched concurrently, across all requests.
+	MaxConcurrency int64
+
+	// OperationBuilder selects how the operations of deploys
+	// are built, TransfersOperationBuilder by default.
+	OperationBuilder string
+
+	// GenesisAccountsFile is the path of the accounts.toml file
+	// of the chainspec. The genesis accounts are read from the
+	// node if it is empty.
+	GenesisAccountsFile string
+
+	// PurseIndexFile is the path of the index mapping purses
+	// to their owner accounts. The index is kept in memory
+	// only if it is empty.
+	PurseIndexFile string
+
+	// FinalityMode selects the blocks served as current,
+	// LatestBlockMode by default.
+	FinalityMode string
+
+	// FinalityThreshold is the share of the era validator
+	// weight that must sign a block in FinalizedBlockMode,
+	// DefaultFinalityThreshold by default.
+	FinalityThreshold *big.Rat
+
+	// EventStreamURL is the url of the node event stream
+	// streaming finality signatures, if any.
+	EventStreamURL string
+}
+
 type Client struct {
-	RpcClient *CasperSDK.RpcClient
+	node NodeClient
+
+	deploySemaphore  *semaphore.Weighted
+	mainPurses       *mainPurseCache
+	purseIndex       *purseIndex
+	finality         *finalityTracker
+	operationBuilder string
+
+	genesisAccountsFile string
+	genesisMu           sync.Mutex
+	genesisTransaction  *RosettaTypes.Transaction
+
+	auctionMu        sync.Mutex
+	auctionContracts map[string]*auctionContract
+
+	unbondingDelayMu sync.Mutex
+	unbondingDelay   *uint64
+}
+
+// NewClient creates a Client from the provided node urls, ordered
+// by priority. Requests fail over to the next url when an endpoint
+// is unreachable or behind the others.
+func NewClient(urls []string, opts *ClientOptions) (*Client, error) {
+	node, err := rpc.NewClient(urls)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid node endpoints", err)
+	}
+
+	return NewClientWithNode(node, opts)
+}
+
+// NewClientWithNode creates a Client using the provided NodeClient.
+func NewClientWithNode(node NodeClient, opts *ClientOptions) (*Client, error) {
+	maxConcurrency := DefaultMaxConcurrency
+	if opts != nil && opts.MaxConcurrency > 0 {
+		maxConcurrency = opts.MaxConcurrency
+	}
+
+	operationBuilder := TransfersOperationBuilder
+	if opts != nil && len(opts.OperationBuilder) > 0 {
+		operationBuilder = opts.OperationBuilder
+	}
+
+	genesisAccountsFile := ""
+	purseIndexFile := ""
+	finality := newFinalityTracker(LatestBlockMode, nil, "")
+	if opts != nil {
+		genesisAccountsFile = opts.GenesisAccountsFile
+		purseIndexFile = opts.PurseIndexFile
+		finality = newFinalityTracker(opts.FinalityMode, opts.FinalityThreshold, opts.EventStreamURL)
+	}
+
+	purseIndex, err := openPurseIndex(purseIndexFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		node:                node,
+		deploySemaphore:     semaphore.NewWeighted(maxConcurrency),
+		mainPurses:          newMainPurseCache(),
+		purseIndex:          purseIndex,
+		finality:            finality,
+		operationBuilder:    operationBuilder,
+		genesisAccountsFile: genesisAccountsFile,
+		auctionContracts:    map[string]*auctionContract{},
+	}, nil
 }
 
-// NewClient creates a Client that from the provided url and params.
-func NewClient() (*Client, error) {
-	RpcClient := CasperSDK.NewRpcClient("http://45.32.28.180:7777/rpc")
-	return &Client{RpcClient}, nil
+// Close closes the purse index of the client.
+func (ec *Client) Close() error {
+	return ec.purseIndex.close()
 }
 
 // Status returns status information
@@ -56,22 +192,22 @@ func (ec *Client) Status(ctx context.Context) (
 	[]*RosettaTypes.Peer,
 	error,
 ) {
-	blockres, err := ec.RpcClient.GetLatestBlock()
+	blockres, err := ec.latestBlock(ctx)
 	if err != nil {
 		return nil, -1, nil, err
 	}
 
-	casper_peers, err := ec.RpcClient.GetPeers()
+	casper_peers, err := ec.node.GetPeers(ctx)
 	if err != nil {
 		return nil, -1, nil, err
 	}
 
-	rosetta_peers := make([]*RosettaTypes.Peer, len(casper_peers.Peers))
-	for i, peerInfo := range casper_peers.Peers {
+	rosetta_peers := make([]*RosettaTypes.Peer, len(casper_peers))
+	for i, peerInfo := range casper_peers {
 		rosetta_peers[i] = &RosettaTypes.Peer{
 			PeerID: peerInfo.Address,
 			Metadata: map[string]interface{}{
-				"Node ID": peerInfo.NodeId,
+				"Node ID": peerInfo.NodeID,
 			},
 		}
 	}
@@ -86,25 +222,26 @@ func (ec *Client) Status(ctx context.Context) (
 }
 
 func (ec *Client) GetBlockResponse(
+	ctx context.Context,
 	blockIdentifier *RosettaTypes.PartialBlockIdentifier,
-) (*CasperSDK.BlockResponse, error) {
+) (*rpc.Block, error) {
 	if blockIdentifier.Hash != nil {
-		block, err := ec.RpcClient.GetBlockByHash(*blockIdentifier.Hash)
+		block, err := ec.node.GetBlock(ctx, rpc.BlockByHash(*blockIdentifier.Hash))
 		if err != nil {
 			return nil, fmt.Errorf("%w: could not get block by hash", err)
 		}
 
-		return &block, err
+		return block, err
 	}
 	if blockIdentifier.Index != nil {
 		var index uint64
 		index = uint64(*blockIdentifier.Index)
-		block, err := ec.RpcClient.GetBlockByHeight(index)
+		block, err := ec.node.GetBlock(ctx, rpc.BlockByHeight(index))
 		if err != nil {
 			return nil, fmt.Errorf("%w: could not get block by height", err)
 		}
 
-		return &block, err
+		return block, err
 	}
 	return nil, fmt.Errorf("invalid block identifier")
 }
@@ -116,18 +253,21 @@ func (ec *Client) Block(
 	ctx context.Context,
 	blockIdentifier *RosettaTypes.PartialBlockIdentifier,
 ) (*RosettaTypes.Block, error) {
-	var block CasperSDK.BlockResponse
+	var block *rpc.Block
 	var err error
-	var block_transfers []CasperSDK.TransferResponse
+	var block_transfers []*rpc.Transfer
 
 	if blockIdentifier != nil {
 		if blockIdentifier.Hash != nil {
-			block, err = ec.RpcClient.GetBlockByHash(*blockIdentifier.Hash)
+			block, err = ec.node.GetBlock(ctx, rpc.BlockByHash(*blockIdentifier.Hash))
 			if err != nil {
 				return nil, fmt.Errorf("%w: could not get block by hash", err)
 			}
+			if err := ec.checkFinalized(ctx, block); err != nil {
+				return nil, err
+			}
 
-			block_transfers, err = ec.RpcClient.GetBlockTransfersByHash(*blockIdentifier.Hash)
+			block_transfers, err = ec.node.GetBlockTransfers(ctx, rpc.BlockByHash(*blockIdentifier.Hash))
 			if err != nil {
 				return nil, fmt.Errorf("%w: could not get block transfer by hash", err)
 			}
@@ -135,24 +275,27 @@ func (ec *Client) Block(
 		if blockIdentifier.Index != nil {
 			var index uint64
 			index = uint64(*blockIdentifier.Index)
-			block, err = ec.RpcClient.GetBlockByHeight(index)
+			block, err = ec.node.GetBlock(ctx, rpc.BlockByHeight(index))
 			if err != nil {
 				return nil, fmt.Errorf("%w: could not get block by height", err)
 			}
+			if err := ec.checkFinalized(ctx, block); err != nil {
+				return nil, err
+			}
 
-			block_transfers, err = ec.RpcClient.GetBlockTransfersByHeight(uint64(*blockIdentifier.Index))
+			block_transfers, err = ec.node.GetBlockTransfers(ctx, rpc.BlockByHeight(index))
 			if err != nil {
 				return nil, fmt.Errorf("%w: could not get block transfer by height", err)
 			}
 		}
 	}
 	if blockIdentifier == nil {
-		block, err = ec.RpcClient.GetLatestBlock()
+		block, err = ec.latestBlock(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("%w: could not get block", err)
 		}
 
-		block_transfers, err = ec.RpcClient.GetLatestBlockTransfers()
+		block_transfers, err = ec.node.GetBlockTransfers(ctx, rpc.BlockByHash(block.Hash))
 		if err != nil {
 			return nil, fmt.Errorf("%w: could not get block", err)
 		}
@@ -170,41 +313,68 @@ func (ec *Client) Block(
 		}
 	}
 
-	//reading deploy hash list
-	var deployToTransferMap = make(map[string][]*CasperSDK.TransferResponse)
-	for _, trs := range block_transfers {
-		if _, ok := deployToTransferMap[trs.DeployHash]; !ok {
-			deployToTransferMap[trs.DeployHash] = []*CasperSDK.TransferResponse{}
-		}
-		deployToTransferMap[trs.DeployHash] = append(deployToTransferMap[trs.DeployHash], &trs)
-	}
-
-	alldeployHashes := block.Body.DeployHashes
-	for _, deployHash := range alldeployHashes {
-		if _, ok := deployToTransferMap[deployHash]; !ok {
-			deployToTransferMap[deployHash] = []*CasperSDK.TransferResponse{}
-		}
-	}
+	deployToTransferMap := blockDeployTransfers(block, block_transfers)
 	Transactions := make(
 		[]*RosettaTypes.Transaction,
 		len(deployToTransferMap),
 	)
 
-	validator := block.Body.Proposer
-	validatorMainPurse, err := ec.GetMainPurseFromPublicKey(validator, block.Header.StateRootHash)
+	validatorMainPurse, err := ec.proposerMainPurse(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+
+	deployHashes := orderedDeployHashes(block, block_transfers, deployToTransferMap)
+	deploys, err := ec.fetchTransactions(ctx, deployHashes)
+	if err != nil {
+		return nil, err
+	}
+	// Purses created by a deploy may be used by the following
+	// ones, they are indexed before the deploys are hydrated.
+	purses, err := ec.indexBlockPurses(ctx, block, deploys)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get validator purse")
+		return nil, err
 	}
 
-	var i = 0
-	for deployHash, transfers := range deployToTransferMap {
-		log.Printf("%s %d %s", deployHash, len(transfers), block.Hash)
-		transaction, err := ec.CreateRosTransaction(deployHash, transfers, &block, validatorMainPurse)
+	if ec.operationBuilder == EffectsOperationBuilder {
+		Transactions, err = ec.createEffectsTransactions(ctx, deploys, block, validatorMainPurse, purses)
 		if err != nil {
-			return nil, fmt.Errorf("%w: Failed to create rosetta transaction for deploy "+deployHash, err)
+			return nil, err
 		}
-		Transactions[i] = transaction
-		i++
+	} else if err := ec.createRosTransactions(
+		ctx,
+		deploys,
+		deployToTransferMap,
+		block,
+		validatorMainPurse,
+		purses,
+		Transactions,
+	); err != nil {
+		return nil, err
+	}
+
+	genesisTransaction, err := ec.createGenesisTransaction(ctx, block)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not create genesis transaction", err)
+	}
+	if genesisTransaction != nil {
+		Transactions = append([]*RosettaTypes.Transaction{genesisTransaction}, Transactions...)
+	}
+
+	rewardsTransaction, err := ec.createEraRewardsTransaction(ctx, block)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not create era rewards transaction", err)
+	}
+	if rewardsTransaction != nil {
+		Transactions = append(Transactions, rewardsTransaction)
+	}
+
+	payoutsTransaction, err := ec.createUnbondPayoutsTransaction(ctx, block)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not create unbond payouts transaction", err)
+	}
+	if payoutsTransaction != nil {
+		Transactions = append(Transactions, payoutsTransaction)
 	}
 
 	return &RosettaTypes.Block{
@@ -212,72 +382,248 @@ func (ec *Client) Block(
 		ParentBlockIdentifier: ParentBlockIdentifier,
 		Timestamp:             block.Header.Timestamp.UnixNano() / 1e6,
 		Transactions:          Transactions,
+		Metadata:              blockMetadata(block),
 	}, nil
 }
 
+// blockDeployTransfers returns the transfers of the block by transaction
+// hash, with an entry for every transaction of the block.
+func blockDeployTransfers(block *rpc.Block, blockTransfers []*rpc.Transfer) map[string][]*rpc.Transfer {
+	deployToTransferMap := make(map[string][]*rpc.Transfer)
+	for _, trs := range blockTransfers {
+		transactionHash := TransactionHash(trs.TransactionHash)
+		deployToTransferMap[transactionHash] = append(deployToTransferMap[transactionHash], trs)
+	}
+
+	// Native transfers are listed under transfer_hashes, every
+	// deploy of both lists is a transaction of its own.
+	for _, deployHash := range blockTransactionHashes(block) {
+		if _, ok := deployToTransferMap[deployHash]; !ok {
+			deployToTransferMap[deployHash] = []*rpc.Transfer{}
+		}
+	}
+
+	return deployToTransferMap
+}
+
+// orderedDeployHashes returns the transactions of deployToTransferMap in
+// the canonical order of the block, see blockTransactionHashes. Transactions
+// not listed by the block come last, in the order of the block transfers.
+func orderedDeployHashes(
+	block *rpc.Block,
+	blockTransfers []*rpc.Transfer,
+	deployToTransferMap map[string][]*rpc.Transfer,
+) []string {
+	deployHashes := make([]string, 0, len(deployToTransferMap))
+	seen := make(map[string]bool, len(deployToTransferMap))
+	add := func(deployHash string) {
+		if _, ok := deployToTransferMap[deployHash]; !ok || seen[deployHash] {
+			return
+		}
+		seen[deployHash] = true
+		deployHashes = append(deployHashes, deployHash)
+	}
+
+	for _, deployHash := range blockTransactionHashes(block) {
+		add(deployHash)
+	}
+	for _, transfer := range blockTransfers {
+		add(TransactionHash(transfer.TransactionHash))
+	}
+
+	return deployHashes
+}
+
+// createRosTransactions hydrates the provided deploys concurrently,
+// bounded by the client deploy semaphore, and stores each transaction
+// at the index of its deploy. The first error cancels the remaining
+// deploys.
+func (ec *Client) createRosTransactions(
+	ctx context.Context,
+	deploys []*executedTransaction,
+	deployToTransferMap map[string][]*rpc.Transfer,
+	block *rpc.Block,
+	validatorMainPurse string,
+	purses blockPurses,
+	transactions []*RosettaTypes.Transaction,
+) error {
+	g, gctx := errgroup.WithContext(ctx)
+	for i, deploy := range deploys {
+		if err := ec.deploySemaphore.Acquire(gctx, semaphoreDeployWeight); err != nil {
+			// The group context is only done if a deploy failed
+			// or if ctx is done, report the root cause.
+			if waitErr := g.Wait(); waitErr != nil {
+				return waitErr
+			}
+			return fmt.Errorf("%w: could not fetch deploys", err)
+		}
+
+		i, deploy := i, deploy
+		g.Go(func() error {
+			defer ec.deploySemaphore.Release(semaphoreDeployWeight)
+
+			transfers := deployToTransferMap[deploy.hash]
+			log.Printf("%s %d %s", deploy.hash, len(transfers), block.Hash)
+			transaction, err := ec.createRosTransaction(gctx, deploy, transfers, block, validatorMainPurse, purses)
+			if err != nil {
+				return fmt.Errorf("%w: Failed to create rosetta transaction for deploy "+deploy.hash, err)
+			}
+			transactions[i] = transaction
+
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
 func (ec *Client) BlockTransaction(
 	ctx context.Context,
 	blockIdentifier *RosettaTypes.BlockIdentifier,
 	transactionIdentifier *RosettaTypes.TransactionIdentifier,
 ) (*RosettaTypes.Transaction, error) {
-	if transactionIdentifier == nil {
+	if blockIdentifier == nil || transactionIdentifier == nil {
 		return nil, fmt.Errorf("null pointer input")
 	}
-	// var block_transfers []CasperSDK.TransferResponse
-	// var err error
-	// if blockIdentifier != nil {
-	// 	if blockIdentifier.Hash != "" {
-	// 		block_transfers, err = ec.RpcClient.GetBlockTransfersByHash(blockIdentifier.Hash)
-	// 		if err != nil {
-	// 			return nil, fmt.Errorf("%w: could not get block", err)
-	// 		}
-	// 	}
-	// 	if blockIdentifier.Index != 0 {
-	// 		block_transfers, err = ec.RpcClient.GetBlockTransfersByHeight(uint64(blockIdentifier.Index))
-	// 		if err != nil {
-	// 			return nil, fmt.Errorf("%w: could not get block", err)
-	// 		}
-	// 	}
-	// }
-	// if blockIdentifier == nil {
-	// 	block_transfers, err = ec.RpcClient.GetLatestBlockTransfers()
-	// 	if err != nil {
-	// 		return nil, fmt.Errorf("%w: could not get block", err)
-	// 	}
-	// }
-	deploy, err := ec.RpcClient.GetDeploy(transactionIdentifier.Hash)
+
+	block, err := ec.node.GetBlock(ctx, rpc.BlockByHash(blockIdentifier.Hash))
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not get deploy", err)
+		return nil, fmt.Errorf("%w: could not get block", err)
+	}
+	if int64(block.Header.Height) != blockIdentifier.Index {
+		return nil, fmt.Errorf(
+			"%w: block %s is at height %d, not %d",
+			ErrTransactionNotInBlock,
+			block.Hash,
+			block.Header.Height,
+			blockIdentifier.Index,
+		)
+	}
+	if err := ec.checkFinalized(ctx, block); err != nil {
+		return nil, err
+	}
+
+	notInBlock := fmt.Errorf(
+		"%w: transaction %s, block %s",
+		ErrTransactionNotInBlock,
+		transactionIdentifier.Hash,
+		block.Hash,
+	)
+	if isEraRewardsTransactionHash(transactionIdentifier.Hash) {
+		if EraRewardsTransactionHash(block.Hash) != transactionIdentifier.Hash {
+			return nil, notInBlock
+		}
+
+		transaction, err := ec.createEraRewardsTransaction(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		if transaction == nil {
+			// Only switch blocks have an era rewards transaction.
+			return nil, notInBlock
+		}
+
+		return transaction, nil
+	}
+	if isGenesisTransactionHash(transactionIdentifier.Hash) {
+		transaction, err := ec.createGenesisTransaction(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		if transaction == nil || transaction.TransactionIdentifier.Hash != transactionIdentifier.Hash {
+			return nil, notInBlock
+		}
+
+		return transaction, nil
 	}
-	if len(deploy.ExecutionResults) == 0 {
-		return nil, fmt.Errorf("invalid deploy")
+	if isUnbondPayoutsTransactionHash(transactionIdentifier.Hash) {
+		transaction, err := ec.createUnbondPayoutsTransaction(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		if transaction == nil || transaction.TransactionIdentifier.Hash != transactionIdentifier.Hash {
+			return nil, notInBlock
+		}
+
+		return transaction, nil
 	}
 
-	blkIdentifier := &RosettaTypes.PartialBlockIdentifier{Hash: &deploy.ExecutionResults[0].BlockHash}
-	block, err := ec.GetBlockResponse(blkIdentifier)
+	hash, err := parseTransactionHash(transactionIdentifier.Hash)
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not get deploy block", err)
+		return nil, err
 	}
+	deployHash := TransactionHash(hash)
 
-	block_transfers, err := ec.RpcClient.GetBlockTransfersByHash(blockIdentifier.Hash)
+	// Transactions are hydrated as by Block, with the
+	// transfers recorded by the block.
+	block_transfers, err := ec.node.GetBlockTransfers(ctx, rpc.BlockByHash(block.Hash))
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not get block", err)
+		return nil, fmt.Errorf("%w: could not get block transfers", err)
+	}
+	deployToTransferMap := blockDeployTransfers(block, block_transfers)
+	transfers, ok := deployToTransferMap[deployHash]
+	if !ok {
+		return nil, notInBlock
 	}
 
-	var transfers []*CasperSDK.TransferResponse
-	for i := 0; i < len(block_transfers); i++ {
-		if block_transfers[i].DeployHash == deploy.Deploy.Hash {
-			transfers = append(transfers, &block_transfers[i])
+	deploy, err := ec.getTransaction(ctx, deployHash)
+	if err != nil {
+		return nil, err
+	}
+	// The transaction is rendered with the outcome of
+	// its execution in the requested block.
+	if _, err := deploy.executionResult(block.Hash); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotInBlock, err.Error())
+	}
+
+	if ec.operationBuilder == EffectsOperationBuilder {
+		// The operations of a deploy depend on the
+		// deploys executed before it in the block.
+		rosBlock, err := ec.Block(ctx, &RosettaTypes.PartialBlockIdentifier{Hash: &block.Hash})
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not get deploy block", err)
+		}
+		for _, transaction := range rosBlock.Transactions {
+			if transaction.TransactionIdentifier.Hash == deploy.hash {
+				return transaction, nil
+			}
 		}
+
+		return nil, notInBlock
 	}
 
-	validator := block.Body.Proposer
-	validatorMainPurse, err := ec.GetMainPurseFromPublicKey(validator, block.Header.StateRootHash)
+	validatorMainPurse, err := ec.proposerMainPurse(ctx, block)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get validator purse BlockTransaction")
+		return nil, err
+	}
+	// The accounts of the deploy may own purses created
+	// by any deploy of the block, as rendered by Block.
+	deploys, err := ec.fetchTransactions(ctx, orderedDeployHashes(block, block_transfers, deployToTransferMap))
+	if err != nil {
+		return nil, err
+	}
+	purses, err := ec.indexBlockPurses(ctx, block, deploys)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec.createRosTransaction(ctx, deploy, transfers, block, validatorMainPurse, purses)
+}
+
+// readPaymentAmount returns the amount argument
+// of a standard payment, "0" if it is missing.
+func readPaymentAmount(deploy *rpc.Deploy) (string, error) {
+	value, ok := deploy.Payment.Args().Get("amount")
+	if !ok {
+		return "0", nil
 	}
 
-	return ec.CreateRosTransaction(deploy.Deploy.Hash, transfers, block, validatorMainPurse)
+	var amount string
+	if err := json.Unmarshal(value.Parsed, &amount); err != nil {
+		return "0", fmt.Errorf("%w: failed to unmarshal payment amount", err)
+	}
+
+	return amount, nil
 }
 
 func PurseWithoutIndex(purse string) string {
@@ -285,152 +631,154 @@ func PurseWithoutIndex(purse string) string {
 	return purse[:lastIndex]
 }
 
-func (ec *Client) CreateRosTransaction(deployHash string, transfers []*CasperSDK.TransferResponse, block *CasperSDK.BlockResponse, validatorMainPurse string) (*RosettaTypes.Transaction, error) {
-	//read deploy
-	deploy, err := ec.RpcClient.GetDeploy(deployHash)
+// createRosTransaction returns the transaction of a deploy executed
+// in block, whose purses are resolved with the purses of the block.
+func (ec *Client) createRosTransaction(
+	ctx context.Context,
+	deploy *executedTransaction,
+	transfers []*rpc.Transfer,
+	block *rpc.Block,
+	validatorMainPurse string,
+	purses blockPurses,
+) (*RosettaTypes.Transaction, error) {
+	deployHash := deploy.hash
+	executionResult, err := deploy.executionResult(block.Hash)
 	if err != nil {
-		return nil, fmt.Errorf("%w: could not get deploy", err)
+		return nil, err
 	}
 
-	if len(deploy.ExecutionResults) == 0 {
-		return nil, fmt.Errorf("invalid deploy")
+	var rosOperations []*RosettaTypes.Operation
+	signerMainPurse, err := ec.initiatorMainPurse(ctx, deploy.initiator, block.Header.StateRootHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signer purse " + deploy.initiator)
 	}
+	log.Printf("%s %s", validatorMainPurse, signerMainPurse)
 
-	var rosOperations []*RosettaTypes.Operation
-	signerMainPurse, err := ec.GetMainPurseFromPublicKey(deploy.Deploy.Header.Account, block.Header.StateRootHash)
+	strategy, err := strategyFor(block.Header.ProtocolVersion)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get signer purse " + deploy.Deploy.Header.Account)
+		return nil, err
 	}
-	var paymentAmount string = "0"
-	if len(deploy.Deploy.Payment.ModuleBytes.Args) != 0 {
-		paymentAmount, err = ec.RpcClient.ReadPaymentAmount(&deploy.Deploy)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get read payment amount")
+
+	outcome, err := executionResult.Outcome()
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid execution result of deploy %s", err, deployHash)
+	}
+
+	var stakingCall *stakingCall
+	if executionResult.Failure != nil {
+		// Transfers of failed deploys are reverted,
+		// only the fee is charged.
+		transfers = nil
+	} else {
+		if len(transfers) == 0 {
+			transfers, err = strategy.deployTransfers(ctx, ec, outcome, block)
+			if err != nil {
+				return nil, fmt.Errorf("%w: could not get transfers of deploy %s", err, deployHash)
+			}
+		}
+		if deploy.deploy != nil {
+			stakingCall, err = ec.deployStakingCall(ctx, deploy.deploy, outcome, block)
+			if err != nil {
+				return nil, fmt.Errorf("%w: could not parse staking call of deploy %s", err, deployHash)
+			}
 		}
 	}
-	log.Printf("%s %s %s", validatorMainPurse, signerMainPurse, paymentAmount)
 
-	if deploy.ExecutionResults[0].Result.Failure != nil {
-		txCost := deploy.ExecutionResults[0].Result.Failure.Cost
-		Neg_Amount := "-" + txCost
-		//transaction error, tx cost is moved from sender to validator
-		rosOperations = []*RosettaTypes.Operation{
-			{
-				OperationIdentifier: &RosettaTypes.OperationIdentifier{
-					Index: 0,
-				},
-				Type:   FeeOpType,
-				Status: RosettaTypes.String(FailureStatus),
-				Account: &RosettaTypes.AccountIdentifier{
-					Address: PurseWithoutIndex(signerMainPurse),
-				},
-				Amount: &RosettaTypes.Amount{
-					Value:    Neg_Amount,
-					Currency: Currency,
-				},
-			},
+	// The fee is paid by the payment code, which is not
+	// necessarily the standard payment from the signer.
+	paymentAmount := func() (string, error) {
+		if executionResult.Failure != nil {
+			return outcome.Cost, nil
+		}
 
-			{
-				OperationIdentifier: &RosettaTypes.OperationIdentifier{
-					Index: 1,
-				},
-				RelatedOperations: []*RosettaTypes.OperationIdentifier{
-					{
-						Index: 0,
-					},
-				},
-				Type:   FeeOpType,
-				Status: RosettaTypes.String(FailureStatus),
-				Account: &RosettaTypes.AccountIdentifier{
-					Address: PurseWithoutIndex(validatorMainPurse),
-				},
-				Amount: &RosettaTypes.Amount{
-					Value:    txCost,
-					Currency: Currency,
-				},
-			},
+		amount, err := deploy.paymentAmount()
+		if err != nil {
+			return "", fmt.Errorf("%w: could not read payment amount", err)
 		}
-	} else {
-		txCost := deploy.ExecutionResults[0].Result.Success.Cost
-		if paymentAmount == "0" {
-			paymentAmount = txCost
+		if amount == "0" {
+			return outcome.Cost, nil
 		}
-		Neg_Amount := "-" + paymentAmount
-		//transaction error, tx cost is moved from sender to validator
-		rosOperations = []*RosettaTypes.Operation{
-			{
-				OperationIdentifier: &RosettaTypes.OperationIdentifier{
-					Index: 0,
-				},
-				Type:   FeeOpType,
-				Status: RosettaTypes.String(SuccessStatus),
-				Account: &RosettaTypes.AccountIdentifier{
-					Address: PurseWithoutIndex(signerMainPurse),
-				},
-				Amount: &RosettaTypes.Amount{
-					Value:    Neg_Amount,
-					Currency: Currency,
-				},
-			},
 
-			{
-				OperationIdentifier: &RosettaTypes.OperationIdentifier{
-					Index: 1,
-				},
-				RelatedOperations: []*RosettaTypes.OperationIdentifier{
-					{
-						Index: 0,
-					},
-				},
-				Type:   FeeOpType,
-				Status: RosettaTypes.String(SuccessStatus),
-				Account: &RosettaTypes.AccountIdentifier{
-					Address: PurseWithoutIndex(validatorMainPurse),
-				},
-				Amount: &RosettaTypes.Amount{
-					Value:    paymentAmount,
-					Currency: Currency,
-				},
+		return amount, nil
+	}
+	fee, err := strategy.deployFee(outcome, transfers, signerMainPurse, validatorMainPurse, paymentAmount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not read fee of deploy %s", err, deployHash)
+	}
+
+	if stakingCall != nil {
+		transfers = stakingCall.filterTransfers(transfers, signerMainPurse)
+	}
+
+	owners, err := ec.transactionPurseOwners(
+		ctx,
+		block,
+		deploy.initiator,
+		signerMainPurse,
+		validatorMainPurse,
+		transfers,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get accounts of deploy %s", err, deployHash)
+	}
+	moved := []string{}
+	if fee != nil {
+		moved = append(moved, fee.purses()...)
+	}
+	for _, transfer := range transfers {
+		moved = append(moved, transfer.Source, transfer.Target)
+	}
+	if err := ec.resolvePurseOwners(ctx, owners, block, purses, moved); err != nil {
+		return nil, fmt.Errorf("%w: could not get accounts of deploy %s", err, deployHash)
+	}
+	if fee != nil {
+		rosOperations = fee.operations(owners)
+	}
+	for i := 0; i < len(transfers); i++ {
+		tx := transfers[i]
+		transferAmount := tx.Amount
+		Neg_Amount := "-" + transferAmount
+		index := int64(len(rosOperations))
+		rosOp := &RosettaTypes.Operation{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: index,
+			},
+			Type:    TransferOpType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: owners.account(tx.Source),
+			Amount: &RosettaTypes.Amount{
+				Value:    Neg_Amount,
+				Currency: Currency,
 			},
 		}
-		for i := 0; i < len(transfers); i++ {
-			tx := transfers[i]
-			transferAmount := tx.Amount
-			Neg_Amount := "-" + transferAmount
-			rosOp := &RosettaTypes.Operation{
-				OperationIdentifier: &RosettaTypes.OperationIdentifier{
-					Index: int64(2*i + 2),
-				},
-				Type:   TransferOpType,
-				Status: RosettaTypes.String(SuccessStatus),
-				Account: &RosettaTypes.AccountIdentifier{
-					Address: PurseWithoutIndex(tx.Source),
-				},
-				Amount: &RosettaTypes.Amount{
-					Value:    Neg_Amount,
-					Currency: Currency,
-				},
-			}
-
-			rosOperations = append(rosOperations, rosOp)
 
-			rosOp2 := &RosettaTypes.Operation{
-				OperationIdentifier: &RosettaTypes.OperationIdentifier{
-					Index: int64(2*i + 1 + 2),
-				},
-				Type:   TransferOpType,
-				Status: RosettaTypes.String(SuccessStatus),
-				Account: &RosettaTypes.AccountIdentifier{
-					Address: PurseWithoutIndex(tx.Target),
-				},
-				Amount: &RosettaTypes.Amount{
-					Value:    transferAmount,
-					Currency: Currency,
-				},
-			}
+		rosOperations = append(rosOperations, rosOp)
 
-			rosOperations = append(rosOperations, rosOp2)
+		rosOp2 := &RosettaTypes.Operation{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: index + 1,
+			},
+			Type:    TransferOpType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: owners.account(tx.Target),
+			Amount: &RosettaTypes.Amount{
+				Value:    transferAmount,
+				Currency: Currency,
+			},
 		}
+
+		rosOperations = append(rosOperations, rosOp2)
+	}
+	if stakingCall != nil {
+		rosOperations = append(
+			rosOperations,
+			stakingCall.operations(int64(len(rosOperations)))...,
+		)
+	}
+
+	metadata, err := deploy.metadata(outcome)
+	if err != nil {
+		return nil, err
 	}
 
 	transaction := &RosettaTypes.Transaction{
@@ -438,31 +786,59 @@ func (ec *Client) CreateRosTransaction(deployHash string, transfers []*CasperSDK
 			Hash: deployHash,
 		},
 		Operations: rosOperations,
-		Metadata:   map[string]interface{}{},
+		Metadata:   metadata,
 	}
 
 	return transaction, nil
 
 }
 
-func (ec *Client) CreateOperation(tx CasperSDK.TransferResponse) ([]*RosettaTypes.Operation, error) {
+// getDeployTransfers reads the transfer records listed in a
+// successful execution result from the global state of block.
+// It is used when chain_get_block_transfers does not
+// return the transfers of a deploy.
+func (ec *Client) getDeployTransfers(
+	ctx context.Context,
+	outcome *rpc.ExecutionOutcome,
+	block *rpc.Block,
+) ([]*rpc.Transfer, error) {
+	transfers := make([]*rpc.Transfer, 0, len(outcome.Transfers))
+	for _, key := range outcome.Transfers {
+		item, err := ec.node.GetStateItem(ctx, block.Header.StateRootHash, key, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not get transfer %s", err, key)
+		}
+		if item.Transfer == nil {
+			return nil, fmt.Errorf("%s is not a transfer", key)
+		}
+
+		transfers = append(transfers, item.Transfer)
+	}
+
+	return transfers, nil
+}
+
+func (ec *Client) CreateOperation(ctx context.Context, tx rpc.Transfer) ([]*RosettaTypes.Operation, error) {
 	if tx.From == "" {
 		tx.From = "account-hash-0000000000000000000000000000000000000000000000000000000000000000"
 	}
-	if tx.To == "" {
-		tx.To = "account-hash-0000000000000000000000000000000000000000000000000000000000000000"
+	if tx.To == nil {
+		to := "account-hash-0000000000000000000000000000000000000000000000000000000000000000"
+		tx.To = &to
 	}
 	Neg_Amount := "-" + tx.Amount
 	// Neg_Amount = fmt.Sprintf("-%s", tx.Amount)
 	var OpStatus string
-	deploy, err := ec.RpcClient.GetDeploy(tx.DeployHash)
+	deploy, err := ec.node.GetDeploy(ctx, tx.DeployHash)
 	if err != nil {
 		return nil, fmt.Errorf("%w: could not get deploy", err)
 	}
 	len := len(deploy.ExecutionResults)
 	for i := 0; i < len; i++ {
 		var k = []string{}
-		k = deploy.ExecutionResults[i].Result.Success.Transfers
+		if deploy.ExecutionResults[i].Result.Success != nil {
+			k = deploy.ExecutionResults[i].Result.Success.Transfers
+		}
 		if k == nil {
 			OpStatus = FailureStatus
 		} else {
@@ -498,7 +874,7 @@ func (ec *Client) CreateOperation(tx CasperSDK.TransferResponse) ([]*RosettaType
 			Type:   TransferOpType,
 			Status: RosettaTypes.String(OpStatus),
 			Account: &RosettaTypes.AccountIdentifier{
-				Address: tx.To,
+				Address: *tx.To,
 			},
 			Amount: &RosettaTypes.Amount{
 				Value:    tx.Amount,
@@ -521,63 +897,98 @@ func (ec *Client) Balance(
 	account *RosettaTypes.AccountIdentifier,
 	block *RosettaTypes.PartialBlockIdentifier,
 ) (*RosettaTypes.AccountBalanceResponse, error) {
-	var blockres CasperSDK.BlockResponse
+	var blockres *rpc.Block
 	var err error
-	var balance big.Int
+	var balance *big.Int
 	if block != nil {
 		if block.Hash != nil {
-			blockres, err = ec.RpcClient.GetBlockByHash(*block.Hash)
+			blockres, err = ec.node.GetBlock(ctx, rpc.BlockByHash(*block.Hash))
 			if err != nil {
 				return nil, fmt.Errorf("%w: could not get block", err)
 			}
 		}
 		if block.Index != nil {
-			blockres, err = ec.RpcClient.GetBlockByHeight(uint64(*block.Index))
+			blockres, err = ec.node.GetBlock(ctx, rpc.BlockByHeight(uint64(*block.Index)))
 			if err != nil {
 				return nil, fmt.Errorf("%w: could not get block", err)
 			}
 		}
 	}
-	if block == nil {
-		blockres, err = ec.RpcClient.GetLatestBlock()
+	if blockres == nil {
+		blockres, err = ec.latestBlock(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("%w: could not get block", err)
 		}
 	}
-	stateRootHash := blockres.Header.StateRootHash
-	var balanceUref string
-	if strings.Contains(account.Address, "account-hash") {
-		var path []string
-		item, err := ec.RpcClient.GetStateItem(stateRootHash, account.Address, path)
-		if err != nil {
-			return nil, fmt.Errorf("%w: could not get state item", err)
+	strategy, err := strategyFor(blockres.Header.ProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.SubAccount != nil {
+		switch {
+		case account.SubAccount.Address == StakedSubAccount:
+			balance, err = ec.stakedBalance(ctx, account, blockres)
+		case account.SubAccount.Address == UnbondingSubAccount:
+			balance, err = ec.unbondingBalance(ctx, account, blockres)
+		case strings.HasPrefix(account.SubAccount.Address, urefPrefix):
+			// Purses other than the main purse of the account.
+			err = ec.checkAccountPurse(ctx, blockres.Header.StateRootHash, account.Address, account.SubAccount.Address)
+			if err == nil {
+				balance, err = strategy.accountBalance(ctx, ec, blockres, account.SubAccount.Address)
+			}
+		default:
+			return nil, fmt.Errorf("%w: invalid sub account %s", address.ErrInvalidAddress, account.SubAccount.Address)
 		}
-		balanceUref = item.Account.MainPurse
-	} else if strings.Contains(account.Address, "uref") {
-		if 1 == strings.Count(account.Address, "-") {
-			balanceUref = account.Address + "-001" //first uref
-		} else {
-			balanceUref = account.Address
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't get %s balance", err, account.SubAccount.Address)
 		}
-	} else if account.Address[0:2] == "01" {
-		balanceUref, err = ec.GetMainPurseFromPublicKey(account.Address, stateRootHash)
+
+		return balanceResponse(balance, blockres), nil
+	}
+
+	balance, err = strategy.accountBalance(ctx, ec, blockres, account.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	return balanceResponse(balance, blockres), nil
+}
+
+// legacyAccountBalance returns the balance of the main purse of an
+// account hash or public key, or of a purse, read with state_get_balance.
+func (ec *Client) legacyAccountBalance(ctx context.Context, stateRootHash string, addr string) (*big.Int, error) {
+	parsed, err := address.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var purse string
+	if parsed.URef != nil {
+		purse = parsed.URef.String()
+	} else {
+		hash, err := parsed.Account()
 		if err != nil {
-			return nil, fmt.Errorf("%w: can't get account purse 01", err)
+			return nil, err
 		}
-	} else if account.Address[0:2] == "02" {
-		balanceUref, err = ec.GetMainPurseFromPublicKey(account.Address, stateRootHash)
+
+		purse, err = ec.accountMainPurse(ctx, stateRootHash, hash.String())
 		if err != nil {
-			return nil, fmt.Errorf("%w: can't get account purse 02", err)
+			return nil, fmt.Errorf("%w: can't get account purse", err)
 		}
-	} else {
-		return nil, fmt.Errorf("Invalid input account")
 	}
 
-	balance, err = ec.RpcClient.GetAccountBalance(stateRootHash, balanceUref)
+	balance, err := ec.node.GetBalance(ctx, stateRootHash, purse)
 	if err != nil {
 		return nil, fmt.Errorf("%w: can't get account balance", err)
 	}
 
+	return balance, nil
+}
+
+// balanceResponse returns the *RosettaTypes.AccountBalanceResponse
+// of balance at block.
+func balanceResponse(balance *big.Int, block *rpc.Block) *RosettaTypes.AccountBalanceResponse {
 	return &RosettaTypes.AccountBalanceResponse{
 		Balances: []*RosettaTypes.Amount{
 			{
@@ -586,32 +997,35 @@ func (ec *Client) Balance(
 			},
 		},
 		BlockIdentifier: &RosettaTypes.BlockIdentifier{
-			Hash:  blockres.Hash,
-			Index: int64(blockres.Header.Height),
+			Hash:  block.Hash,
+			Index: int64(block.Header.Height),
 		},
 		Metadata: map[string]interface{}{},
-	}, nil
+	}
+}
+
+// proposerMainPurse returns the main purse of the proposer of
+// block, or an empty string if the system proposed it.
+func (ec *Client) proposerMainPurse(ctx context.Context, block *rpc.Block) (string, error) {
+	if block.Body.Proposer == systemPublicKey {
+		return "", nil
+	}
+
+	purse, err := ec.GetMainPurseFromPublicKey(ctx, block.Body.Proposer, block.Header.StateRootHash)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to get validator purse", err)
+	}
+
+	return purse, nil
 }
-func (ec *Client) GetMainPurseFromPublicKey(accountAddr string, stateroothash string) (string, error) {
-	hashtype := SECP256K1
-	if accountAddr[0:2] == "01" {
-		hashtype = ED25519
-	}
-	account := accountAddr[2:]
-	pubbyte, _ := hex.DecodeString(account)
-	name := hashtype
-	sep := "00"
-	decoded_sep, _ := hex.DecodeString(sep)
-	buffer := append([]byte(name), decoded_sep...)
-	buffer = append(buffer, pubbyte...)
-
-	hash := blake2b.Sum256(buffer)
-	resHash := fmt.Sprintf("account-hash-%s", hex.EncodeToString(hash[:]))
-	var path []string
-	item, err := ec.RpcClient.GetStateItem(stateroothash, resHash, path)
+
+// GetMainPurseFromPublicKey returns the main purse of the
+// account of a public key in the provided global state.
+func (ec *Client) GetMainPurseFromPublicKey(ctx context.Context, publicKey string, stateRootHash string) (string, error) {
+	hash, err := AccountHashFromPublicKey(publicKey)
 	if err != nil {
-		return "", fmt.Errorf("could not get state item : ----" + err.Error() + "---")
+		return "", err
 	}
-	balanceUref := item.Account.MainPurse
-	return balanceUref, nil
+
+	return ec.accountMainPurse(ctx, stateRootHash, hash)
 }
@@ -0,0 +1,227 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// deployHash returns the transaction hash of a legacy deploy.
+func deployHash(b byte) string {
+	return TransactionHash(rpc.DeployHash(testHash(b)))
+}
+
+// transferRecord returns a transfer record of deploy.
+func transferRecord(deploy string) *rpc.Transfer {
+	return &rpc.Transfer{
+		DeployHash:      deploy,
+		TransactionHash: rpc.DeployHash(deploy),
+		Amount:          "1",
+	}
+}
+
+func TestOrderedDeployHashes(t *testing.T) {
+	tests := map[string]struct {
+		body      rpc.BlockBody
+		transfers []*rpc.Transfer
+		want      []string
+	}{
+		"deploys then transfers": {
+			body: rpc.BlockBody{
+				DeployHashes:   []string{testHash(3), testHash(1)},
+				TransferHashes: []string{testHash(4), testHash(2)},
+			},
+			want: []string{deployHash(3), deployHash(1), deployHash(4), deployHash(2)},
+		},
+		"transfer records in another order": {
+			body: rpc.BlockBody{
+				DeployHashes:   []string{testHash(3), testHash(1)},
+				TransferHashes: []string{testHash(2)},
+			},
+			transfers: []*rpc.Transfer{
+				transferRecord(testHash(2)),
+				transferRecord(testHash(1)),
+				transferRecord(testHash(1)),
+				transferRecord(testHash(3)),
+			},
+			want: []string{deployHash(3), deployHash(1), deployHash(2)},
+		},
+		"unlisted transfer records last": {
+			body: rpc.BlockBody{
+				DeployHashes: []string{testHash(1)},
+			},
+			transfers: []*rpc.Transfer{
+				transferRecord(testHash(9)),
+				transferRecord(testHash(1)),
+				transferRecord(testHash(8)),
+			},
+			want: []string{deployHash(1), deployHash(9), deployHash(8)},
+		},
+		"version 2 transactions": {
+			body: rpc.BlockBody{
+				Transactions: []rpc.TransactionHash{
+					rpc.Version1Hash(testHash(5)),
+					rpc.DeployHash(testHash(1)),
+					rpc.Version1Hash(testHash(2)),
+				},
+			},
+			want: []string{
+				TransactionHash(rpc.Version1Hash(testHash(5))),
+				deployHash(1),
+				TransactionHash(rpc.Version1Hash(testHash(2))),
+			},
+		},
+		"empty block": {
+			want: []string{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			block := &rpc.Block{Body: test.body}
+			transfers := blockDeployTransfers(block, test.transfers)
+
+			// Map iteration order is random, the order
+			// must not depend on it.
+			for i := 0; i < 20; i++ {
+				got := orderedDeployHashes(block, test.transfers, transfers)
+				if !reflect.DeepEqual(got, test.want) {
+					t.Fatalf("got %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBlockTransactionsOrder(t *testing.T) {
+	proposer := testPublicKey(0xa0)
+	signer := testPublicKey(0xa1)
+	block := testBlock(10, "1.4.0", proposer)
+	block.Body.DeployHashes = []string{testHash(7), testHash(3), testHash(5)}
+	block.Body.TransferHashes = []string{testHash(6), testHash(1), testHash(4), testHash(2)}
+
+	node := newFakeNode()
+	node.addBlock(block)
+	node.addAccount(block.Header.StateRootHash, proposer, testPurse(0xc0))
+	node.addAccount(block.Header.StateRootHash, signer, testPurse(0xc1))
+	for _, hash := range append(block.Body.DeployHashes, block.Body.TransferHashes...) {
+		node.addDeploy(transferDeploy(hash, signer), block, rpc.ExecutionResult{
+			Success: &rpc.ExecutionOutcome{Cost: "100000000"},
+		})
+	}
+
+	want := []string{
+		deployHash(7), deployHash(3), deployHash(5),
+		deployHash(6), deployHash(1), deployHash(4), deployHash(2),
+	}
+	client := newTestClient(t, node, &ClientOptions{MaxConcurrency: 4})
+	for i := 0; i < 20; i++ {
+		rosBlock, err := client.Block(context.Background(), &RosettaTypes.PartialBlockIdentifier{Hash: &block.Hash})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]string, len(rosBlock.Transactions))
+		for j, transaction := range rosBlock.Transactions {
+			got[j] = transaction.TransactionIdentifier.Hash
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBlockTransactionEraRewardsNotInBlock(t *testing.T) {
+	block := testBlock(10, "1.4.0", testPublicKey(0xa0))
+	node := newFakeNode()
+	node.addBlock(block)
+
+	client := newTestClient(t, node, nil)
+	_, err := client.BlockTransaction(
+		context.Background(),
+		&RosettaTypes.BlockIdentifier{Index: int64(block.Header.Height), Hash: block.Hash},
+		&RosettaTypes.TransactionIdentifier{Hash: EraRewardsTransactionHash(block.Hash)},
+	)
+	if !errors.Is(err, ErrTransactionNotInBlock) {
+		t.Fatalf("error %v, want %v", err, ErrTransactionNotInBlock)
+	}
+}
+
+func TestTransferHashesDeployWithoutTransferRecord(t *testing.T) {
+	proposer, sender, recipient := testPublicKey(0xa0), testPublicKey(0xa1), testPublicKey(0xa2)
+	block := testBlock(10, "1.4.0", proposer)
+	block.Body.DeployHashes = []string{testHash(1)}
+	block.Body.TransferHashes = []string{testHash(2)}
+
+	// chain_get_block_transfers does not return the transfer,
+	// which is only read from the execution result.
+	transferKey := "transfer-" + testHash(0xf2)
+	to := testAccountHash(recipient)
+	node := newFakeNode()
+	node.addBlock(testBlock(9, "1.4.0", proposer))
+	node.addBlock(block)
+	node.addAccount(block.Header.StateRootHash, proposer, testPurse(0xc0))
+	node.addAccount(block.Header.StateRootHash, sender, testPurse(0xc1))
+	node.addAccount(block.Header.StateRootHash, recipient, testPurse(0xc2))
+	node.setItem(block.Header.StateRootHash, transferKey, &rpc.StoredValue{Transfer: &rpc.Transfer{
+		DeployHash:      testHash(2),
+		TransactionHash: rpc.DeployHash(testHash(2)),
+		From:            testAccountHash(sender),
+		To:              &to,
+		Source:          testPurse(0xc1),
+		Target:          testPurse(0xc2),
+		Amount:          "2500000000",
+	}})
+	node.addDeploy(transferDeploy(testHash(1), sender), block, rpc.ExecutionResult{
+		Success: &rpc.ExecutionOutcome{Cost: "100000000"},
+	})
+	node.addDeploy(transferDeploy(testHash(2), sender), block, rpc.ExecutionResult{
+		Success: &rpc.ExecutionOutcome{Transfers: []string{transferKey}, Cost: "100000000"},
+	})
+
+	client := newTestClient(t, node, nil)
+	rosBlock, err := client.Block(context.Background(), &RosettaTypes.PartialBlockIdentifier{Hash: &block.Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rosBlock.Transactions) != 2 {
+		t.Fatalf("%d transactions, want 2", len(rosBlock.Transactions))
+	}
+
+	transaction := rosBlock.Transactions[1]
+	if transaction.TransactionIdentifier.Hash != deployHash(2) {
+		t.Fatalf("transaction %s, want %s", transaction.TransactionIdentifier.Hash, deployHash(2))
+	}
+	got := []string{}
+	for _, operation := range transaction.Operations {
+		got = append(got, operation.Type+" "+operation.Account.Address+" "+operation.Amount.Value)
+	}
+	want := []string{
+		FeeOpType + " " + testAccountHash(sender) + " -100000000",
+		FeeOpType + " " + testAccountHash(proposer) + " 100000000",
+		TransferOpType + " " + testAccountHash(sender) + " -2500000000",
+		TransferOpType + " " + testAccountHash(recipient) + " 2500000000",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got operations %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clvalue
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+func appendU32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendU64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendString appends the length prefixed UTF-8 bytes of s.
+func appendString(b []byte, s string) []byte {
+	return append(appendU32(b, uint32(len(s))), s...)
+}
+
+func readByte(b []byte) (byte, []byte, error) {
+	if len(b) < 1 {
+		return 0, nil, fmt.Errorf("%w: unexpected end of bytes", ErrInvalidCLValue)
+	}
+
+	return b[0], b[1:], nil
+}
+
+// readBytes returns the n bytes at the start of b.
+func readBytes(b []byte, n int) ([]byte, []byte, error) {
+	if n < 0 || len(b) < n {
+		return nil, nil, fmt.Errorf("%w: unexpected end of bytes", ErrInvalidCLValue)
+	}
+
+	return b[:n], b[n:], nil
+}
+
+func readU32(b []byte) (uint32, []byte, error) {
+	v, b, err := readBytes(b, 4) // nolint:gomnd
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return binary.LittleEndian.Uint32(v), b, nil
+}
+
+func readU64(b []byte) (uint64, []byte, error) {
+	v, b, err := readBytes(b, 8) // nolint:gomnd
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return binary.LittleEndian.Uint64(v), b, nil
+}
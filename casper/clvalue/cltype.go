@@ -0,0 +1,373 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clvalue encodes and decodes the typed values of casper-node
+// (CLValues) to and from their bytesrepr and JSON representations.
+package clvalue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidCLValue is returned when a CLType or
+// a CLValue cannot be encoded or decoded.
+var ErrInvalidCLValue = errors.New("invalid cl value")
+
+// CLType tags, as serialized by casper-node.
+const (
+	BoolTag = byte(iota)
+	I32Tag
+	I64Tag
+	U8Tag
+	U32Tag
+	U64Tag
+	U128Tag
+	U256Tag
+	U512Tag
+	UnitTag
+	StringTag
+	KeyTag
+	URefTag
+	OptionTag
+	ListTag
+	ByteArrayTag
+	ResultTag
+	MapTag
+	Tuple1Tag
+	Tuple2Tag
+	Tuple3Tag
+	AnyTag
+	PublicKeyTag
+)
+
+// maxTypeDepth is the maximum nesting of CLTypes,
+// as enforced by casper-node.
+const maxTypeDepth = 50
+
+// names are the names of the CLTypes, by tag.
+var names = map[byte]string{
+	BoolTag:      "Bool",
+	I32Tag:       "I32",
+	I64Tag:       "I64",
+	U8Tag:        "U8",
+	U32Tag:       "U32",
+	U64Tag:       "U64",
+	U128Tag:      "U128",
+	U256Tag:      "U256",
+	U512Tag:      "U512",
+	UnitTag:      "Unit",
+	StringTag:    "String",
+	KeyTag:       "Key",
+	URefTag:      "URef",
+	OptionTag:    "Option",
+	ListTag:      "List",
+	ByteArrayTag: "ByteArray",
+	ResultTag:    "Result",
+	MapTag:       "Map",
+	Tuple1Tag:    "Tuple1",
+	Tuple2Tag:    "Tuple2",
+	Tuple3Tag:    "Tuple3",
+	AnyTag:       "Any",
+	PublicKeyTag: "PublicKey",
+}
+
+// innerTypes are the number of inner types
+// of the composite CLTypes, by tag.
+var innerTypes = map[byte]int{
+	OptionTag: 1,
+	ListTag:   1,
+	ResultTag: 2, // nolint:gomnd
+	MapTag:    2, // nolint:gomnd
+	Tuple1Tag: 1,
+	Tuple2Tag: 2, // nolint:gomnd
+	Tuple3Tag: 3, // nolint:gomnd
+}
+
+// CLType is the type of a CLValue.
+type CLType struct {
+	Tag byte
+
+	// Inner are the types of the elements of Option, List and
+	// Tuple types, the ok and err types of Result types and the
+	// key and value types of Map types.
+	Inner []*CLType
+
+	// Size is the length of ByteArray types.
+	Size uint32
+}
+
+// The CLTypes without inner types.
+var (
+	BoolType      = &CLType{Tag: BoolTag}
+	I32Type       = &CLType{Tag: I32Tag}
+	I64Type       = &CLType{Tag: I64Tag}
+	U8Type        = &CLType{Tag: U8Tag}
+	U32Type       = &CLType{Tag: U32Tag}
+	U64Type       = &CLType{Tag: U64Tag}
+	U128Type      = &CLType{Tag: U128Tag}
+	U256Type      = &CLType{Tag: U256Tag}
+	U512Type      = &CLType{Tag: U512Tag}
+	UnitType      = &CLType{Tag: UnitTag}
+	StringType    = &CLType{Tag: StringTag}
+	KeyType       = &CLType{Tag: KeyTag}
+	URefType      = &CLType{Tag: URefTag}
+	AnyType       = &CLType{Tag: AnyTag}
+	PublicKeyType = &CLType{Tag: PublicKeyTag}
+)
+
+// OptionType returns the type of optional values of type t.
+func OptionType(t *CLType) *CLType {
+	return &CLType{Tag: OptionTag, Inner: []*CLType{t}}
+}
+
+// ListType returns the type of lists of values of type t.
+func ListType(t *CLType) *CLType {
+	return &CLType{Tag: ListTag, Inner: []*CLType{t}}
+}
+
+// ByteArrayType returns the type of byte arrays of length size.
+func ByteArrayType(size uint32) *CLType {
+	return &CLType{Tag: ByteArrayTag, Size: size}
+}
+
+// ResultType returns the type of results of type ok or err.
+func ResultType(ok *CLType, err *CLType) *CLType {
+	return &CLType{Tag: ResultTag, Inner: []*CLType{ok, err}}
+}
+
+// MapType returns the type of maps from key to value types.
+func MapType(key *CLType, value *CLType) *CLType {
+	return &CLType{Tag: MapTag, Inner: []*CLType{key, value}}
+}
+
+// Tuple1Type returns the type of 1-tuples.
+func Tuple1Type(t0 *CLType) *CLType {
+	return &CLType{Tag: Tuple1Tag, Inner: []*CLType{t0}}
+}
+
+// Tuple2Type returns the type of 2-tuples.
+func Tuple2Type(t0 *CLType, t1 *CLType) *CLType {
+	return &CLType{Tag: Tuple2Tag, Inner: []*CLType{t0, t1}}
+}
+
+// Tuple3Type returns the type of 3-tuples.
+func Tuple3Type(t0 *CLType, t1 *CLType, t2 *CLType) *CLType {
+	return &CLType{Tag: Tuple3Tag, Inner: []*CLType{t0, t1, t2}}
+}
+
+// validate checks the tag and the number of inner types of t.
+func (t *CLType) validate(depth int) error {
+	if t == nil {
+		return fmt.Errorf("%w: missing type", ErrInvalidCLValue)
+	}
+	if depth > maxTypeDepth {
+		return fmt.Errorf("%w: types are nested more than %d times", ErrInvalidCLValue, maxTypeDepth)
+	}
+	if _, ok := names[t.Tag]; !ok {
+		return fmt.Errorf("%w: unknown type tag %d", ErrInvalidCLValue, t.Tag)
+	}
+	if len(t.Inner) != innerTypes[t.Tag] {
+		return fmt.Errorf("%w: %s types have %d inner types, got %d", ErrInvalidCLValue, names[t.Tag], innerTypes[t.Tag], len(t.Inner))
+	}
+
+	for _, inner := range t.Inner {
+		if err := inner.validate(depth + 1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// String returns the name of t, as in casper-node
+// error messages, e.g. Option(List(U8)).
+func (t *CLType) String() string {
+	switch {
+	case t == nil:
+		return "<nil>"
+	case t.Tag == ByteArrayTag:
+		return fmt.Sprintf("ByteArray(%d)", t.Size)
+	case len(t.Inner) == 0:
+		return names[t.Tag]
+	}
+
+	s := names[t.Tag] + "("
+	for i, inner := range t.Inner {
+		if i > 0 {
+			s += ", "
+		}
+		s += inner.String()
+	}
+
+	return s + ")"
+}
+
+// Bytes returns the bytesrepr serialization of t.
+func (t *CLType) Bytes() []byte {
+	return t.appendBytes(nil)
+}
+
+func (t *CLType) appendBytes(b []byte) []byte {
+	b = append(b, t.Tag)
+	if t.Tag == ByteArrayTag {
+		return appendU32(b, t.Size)
+	}
+
+	for _, inner := range t.Inner {
+		b = inner.appendBytes(b)
+	}
+
+	return b
+}
+
+// ParseCLType decodes the bytesrepr serialization of a CLType
+// at the start of b. It returns the bytes following the type.
+func ParseCLType(b []byte) (*CLType, []byte, error) {
+	return parseCLType(b, 0)
+}
+
+func parseCLType(b []byte, depth int) (*CLType, []byte, error) {
+	if depth > maxTypeDepth {
+		return nil, nil, fmt.Errorf("%w: types are nested more than %d times", ErrInvalidCLValue, maxTypeDepth)
+	}
+
+	tag, b, err := readByte(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := names[tag]; !ok {
+		return nil, nil, fmt.Errorf("%w: unknown type tag %d", ErrInvalidCLValue, tag)
+	}
+
+	t := &CLType{Tag: tag}
+	if tag == ByteArrayTag {
+		if t.Size, b, err = readU32(b); err != nil {
+			return nil, nil, err
+		}
+		return t, b, nil
+	}
+
+	for i := 0; i < innerTypes[tag]; i++ {
+		var inner *CLType
+		if inner, b, err = parseCLType(b, depth+1); err != nil {
+			return nil, nil, err
+		}
+		t.Inner = append(t.Inner, inner)
+	}
+
+	return t, b, nil
+}
+
+// MarshalJSON encodes t as casper-node does: the name of
+// types without inner types, an object otherwise, e.g.
+// {"Option": "U64"} or {"ByteArray": 32}.
+func (t *CLType) MarshalJSON() ([]byte, error) {
+	if err := t.validate(0); err != nil {
+		return nil, err
+	}
+
+	switch t.Tag {
+	case ByteArrayTag:
+		return json.Marshal(map[string]uint32{names[t.Tag]: t.Size})
+	case OptionTag, ListTag:
+		return json.Marshal(map[string]*CLType{names[t.Tag]: t.Inner[0]})
+	case ResultTag:
+		return json.Marshal(map[string]map[string]*CLType{
+			names[t.Tag]: {"ok": t.Inner[0], "err": t.Inner[1]},
+		})
+	case MapTag:
+		return json.Marshal(map[string]map[string]*CLType{
+			names[t.Tag]: {"key": t.Inner[0], "value": t.Inner[1]},
+		})
+	case Tuple1Tag, Tuple2Tag, Tuple3Tag:
+		return json.Marshal(map[string][]*CLType{names[t.Tag]: t.Inner})
+	}
+
+	return json.Marshal(names[t.Tag])
+}
+
+// UnmarshalJSON decodes a CLType encoded as by MarshalJSON.
+func (t *CLType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		tag, ok := tagByName(name)
+		if !ok || innerTypes[tag] > 0 || tag == ByteArrayTag {
+			return fmt.Errorf("%w: unknown type %s", ErrInvalidCLValue, name)
+		}
+		*t = CLType{Tag: tag}
+		return nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidCLValue, err.Error())
+	}
+	if len(object) != 1 {
+		return fmt.Errorf("%w: invalid type %s", ErrInvalidCLValue, string(data))
+	}
+
+	for name, inner := range object {
+		tag, ok := tagByName(name)
+		if !ok || (innerTypes[tag] == 0 && tag != ByteArrayTag) {
+			return fmt.Errorf("%w: unknown type %s", ErrInvalidCLValue, name)
+		}
+
+		parsed := CLType{Tag: tag}
+		var err error
+		switch tag {
+		case ByteArrayTag:
+			err = json.Unmarshal(inner, &parsed.Size)
+		case OptionTag, ListTag:
+			parsed.Inner = make([]*CLType, 1)
+			err = json.Unmarshal(inner, &parsed.Inner[0])
+		case ResultTag:
+			var result struct {
+				Ok  *CLType `json:"ok"`
+				Err *CLType `json:"err"`
+			}
+			err = json.Unmarshal(inner, &result)
+			parsed.Inner = []*CLType{result.Ok, result.Err}
+		case MapTag:
+			var m struct {
+				Key   *CLType `json:"key"`
+				Value *CLType `json:"value"`
+			}
+			err = json.Unmarshal(inner, &m)
+			parsed.Inner = []*CLType{m.Key, m.Value}
+		default:
+			err = json.Unmarshal(inner, &parsed.Inner)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: invalid %s type: %s", ErrInvalidCLValue, name, err.Error())
+		}
+		if err := parsed.validate(0); err != nil {
+			return err
+		}
+		*t = parsed
+	}
+
+	return nil
+}
+
+func tagByName(name string) (byte, bool) {
+	for tag, tagName := range names {
+		if tagName == name {
+			return tag, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clvalue
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// CLValue is a serialized value with its type.
+type CLValue struct {
+	Type  *CLType
+	Bytes []byte
+}
+
+// New returns the CLValue of value, of type t.
+func New(t *CLType, value interface{}) (*CLValue, error) {
+	b, err := Encode(t, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CLValue{Type: t, Bytes: b}, nil
+}
+
+// NewFromBytes returns the CLValue of the bytesrepr
+// serialization b of a value of type t.
+func NewFromBytes(t *CLType, b []byte) (*CLValue, error) {
+	if _, err := Decode(t, b); err != nil {
+		return nil, err
+	}
+
+	return &CLValue{Type: t, Bytes: b}, nil
+}
+
+// Value decodes the value of v.
+func (v *CLValue) Value() (interface{}, error) {
+	return Decode(v.Type, v.Bytes)
+}
+
+// ToBytes returns the bytesrepr serialization of v:
+// its length prefixed bytes followed by its type.
+func (v *CLValue) ToBytes() []byte {
+	b := append(appendU32(nil, uint32(len(v.Bytes))), v.Bytes...)
+	return v.Type.appendBytes(b)
+}
+
+// FromBytes decodes the bytesrepr serialization of a CLValue at
+// the start of b. It returns the bytes following the CLValue.
+func FromBytes(b []byte) (*CLValue, []byte, error) {
+	length, b, err := readU32(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	valueBytes, b, err := readBytes(b, int(length))
+	if err != nil {
+		return nil, nil, err
+	}
+	t, b, err := ParseCLType(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, err := NewFromBytes(t, append([]byte{}, valueBytes...))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return v, b, nil
+}
+
+type clValueJSON struct {
+	CLType *CLType         `json:"cl_type"`
+	Bytes  *string         `json:"bytes"`
+	Parsed json.RawMessage `json:"parsed"`
+}
+
+// MarshalJSON encodes v as casper-node does, as its type,
+// its hex bytes and its parsed value.
+func (v *CLValue) MarshalJSON() ([]byte, error) {
+	value, err := v.Value()
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ValueToJSON(v.Type, value)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes := hex.EncodeToString(v.Bytes)
+	return json.Marshal(clValueJSON{
+		CLType: v.Type,
+		Bytes:  &bytes,
+		Parsed: parsed,
+	})
+}
+
+// UnmarshalJSON decodes a CLValue encoded as by MarshalJSON.
+// The bytes are authoritative, the parsed value is only
+// decoded when the bytes are missing.
+func (v *CLValue) UnmarshalJSON(data []byte) error {
+	var encoded clValueJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidCLValue, err.Error())
+	}
+	if encoded.CLType == nil {
+		return fmt.Errorf("%w: missing cl_type", ErrInvalidCLValue)
+	}
+
+	var decoded *CLValue
+	if encoded.Bytes != nil {
+		b, err := hex.DecodeString(*encoded.Bytes)
+		if err != nil {
+			return fmt.Errorf("%w: %s is not hex encoded", ErrInvalidCLValue, *encoded.Bytes)
+		}
+		if decoded, err = NewFromBytes(encoded.CLType, b); err != nil {
+			return err
+		}
+	} else {
+		value, err := ValueFromJSON(encoded.CLType, encoded.Parsed)
+		if err != nil {
+			return err
+		}
+		if decoded, err = New(encoded.CLType, value); err != nil {
+			return err
+		}
+	}
+	*v = *decoded
+
+	return nil
+}
+
+// NamedArg is a named runtime argument of a deploy.
+type NamedArg struct {
+	Name  string
+	Value *CLValue
+}
+
+// RuntimeArgs are the runtime arguments of a deploy, in order.
+type RuntimeArgs []NamedArg
+
+// Bytes returns the bytesrepr serialization of a.
+func (a RuntimeArgs) Bytes() []byte {
+	b := appendU32(nil, uint32(len(a)))
+	for _, arg := range a {
+		b = append(appendString(b, arg.Name), arg.Value.ToBytes()...)
+	}
+
+	return b
+}
+
+// Get returns the value of the argument named name, if any.
+func (a RuntimeArgs) Get(name string) (*CLValue, bool) {
+	for _, arg := range a {
+		if arg.Name == name {
+			return arg.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// MarshalJSON encodes a as casper-node does,
+// as a list of [name, value] pairs.
+func (a RuntimeArgs) MarshalJSON() ([]byte, error) {
+	pairs := make([][2]interface{}, len(a))
+	for i, arg := range a {
+		pairs[i] = [2]interface{}{arg.Name, arg.Value}
+	}
+
+	return json.Marshal(pairs)
+}
+
+// UnmarshalJSON decodes a list of [name, value] pairs.
+func (a *RuntimeArgs) UnmarshalJSON(data []byte) error {
+	var pairs [][2]json.RawMessage
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return fmt.Errorf("%w: invalid runtime args: %s", ErrInvalidCLValue, err.Error())
+	}
+
+	args := make(RuntimeArgs, len(pairs))
+	for i, pair := range pairs {
+		if err := json.Unmarshal(pair[0], &args[i].Name); err != nil {
+			return fmt.Errorf("%w: invalid runtime arg name: %s", ErrInvalidCLValue, err.Error())
+		}
+		args[i].Value = new(CLValue)
+		if err := json.Unmarshal(pair[1], args[i].Value); err != nil {
+			return err
+		}
+	}
+	*a = args
+
+	return nil
+}
@@ -0,0 +1,531 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clvalue
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+)
+
+// testHash is the hex of a 32 bytes address.
+var testHash = strings.Repeat("2a", address.HashLength)
+
+// zeroHash is the hex of the address of singleton keys.
+var zeroHash = strings.Repeat("00", address.HashLength)
+
+func mustBigInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic(s)
+	}
+
+	return v
+}
+
+func mustKey(s string) *Key {
+	key, err := ParseKey(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+func mustURef(s string) *address.URef {
+	uref, err := address.ParseURef(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return uref
+}
+
+func mustPublicKey(s string) *address.PublicKey {
+	publicKey, err := address.ParsePublicKey(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return publicKey
+}
+
+// maxU512 is the largest U512 value.
+var maxU512 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 512), big.NewInt(1))
+
+// vector is a value of type clType with its bytesrepr
+// serialization, as hex, and its JSON representation.
+type vector struct {
+	clType *CLType
+	value  interface{}
+	bytes  string
+	json   string
+}
+
+// vectors are bytesrepr and JSON vectors of casper-types,
+// covering every CLType.
+func vectors() map[string]vector {
+	return map[string]vector{
+		"bool":   {BoolType, true, "01", `true`},
+		"i32":    {I32Type, int32(-1), "ffffffff", `-1`},
+		"i64":    {I64Type, int64(-2), "feffffffffffffff", `-2`},
+		"u8":     {U8Type, uint8(7), "07", `7`},
+		"u32":    {U32Type, uint32(1024), "00040000", `1024`},
+		"u64":    {U64Type, uint64(1609459200000), "00703ebb76010000", `1609459200000`},
+		"u128":   {U128Type, mustBigInt("340282366920938463463374607431768211455"), "10" + strings.Repeat("ff", 16), `"340282366920938463463374607431768211455"`},
+		"u256":   {U256Type, big.NewInt(256), "020001", `"256"`},
+		"u512":   {U512Type, mustBigInt("12345678901234567890"), "08d20a1feb8ca954ab", `"12345678901234567890"`},
+		"unit":   {UnitType, Unit{}, "", `null`},
+		"string": {StringType, "hello", "0500000068656c6c6f", `"hello"`},
+		"key":    {KeyType, mustKey("account-hash-" + testHash), "00" + testHash, `{"Account":"account-hash-` + testHash + `"}`},
+		"uref":   {URefType, mustURef("uref-" + testHash + "-007"), testHash + "07", `"uref-` + testHash + `-007"`},
+		"none":   {OptionType(U64Type), nil, "00", `null`},
+		"some":   {OptionType(U64Type), &Option{Value: uint64(5)}, "010500000000000000", `5`},
+		"list": {
+			ListType(U8Type),
+			[]interface{}{uint8(1), uint8(2)},
+			"020000000102",
+			`[1,2]`,
+		},
+		"empty list": {ListType(StringType), []interface{}{}, "00000000", `[]`},
+		"byte array": {ByteArrayType(4), []byte{0xde, 0xad, 0xbe, 0xef}, "deadbeef", `"deadbeef"`},
+		"ok": {
+			ResultType(U8Type, StringType),
+			&Result{Ok: true, Value: uint8(1)},
+			"0101",
+			`{"Ok":1}`,
+		},
+		"err": {
+			ResultType(U8Type, StringType),
+			&Result{Value: "e"},
+			"000100000065",
+			`{"Err":"e"}`,
+		},
+		"map": {
+			MapType(StringType, U8Type),
+			[]MapEntry{{Key: "a", Value: uint8(1)}, {Key: "b", Value: uint8(2)}},
+			"02000000" + "0100000061" + "01" + "0100000062" + "02",
+			`[{"key":"a","value":1},{"key":"b","value":2}]`,
+		},
+		"tuple1": {Tuple1Type(U8Type), []interface{}{uint8(1)}, "01", `[1]`},
+		"tuple2": {
+			Tuple2Type(U8Type, StringType),
+			[]interface{}{uint8(1), "a"},
+			"010100000061",
+			`[1,"a"]`,
+		},
+		"tuple3": {
+			Tuple3Type(BoolType, U8Type, U32Type),
+			[]interface{}{true, uint8(2), uint32(3)},
+			"010203000000",
+			`[true,2,3]`,
+		},
+		"any": {AnyType, []byte{1, 2}, "0102", `null`},
+		"ed25519 public key": {
+			PublicKeyType,
+			mustPublicKey("01" + testHash),
+			"01" + testHash,
+			`"01` + testHash + `"`,
+		},
+		"secp256k1 public key": {
+			PublicKeyType,
+			mustPublicKey("0203" + testHash),
+			"0203" + testHash,
+			`"0203` + testHash + `"`,
+		},
+		"nested": {
+			OptionType(ListType(MapType(StringType, ResultType(U8Type, StringType)))),
+			&Option{Value: []interface{}{
+				[]MapEntry{
+					{Key: "a", Value: &Result{Ok: true, Value: uint8(1)}},
+					{Key: "b", Value: &Result{Value: "x"}},
+				},
+			}},
+			"01" + "01000000" + "02000000" + "0100000061" + "0101" + "0100000062" + "00" + "0100000078",
+			`[[{"key":"a","value":{"Ok":1}},{"key":"b","value":{"Err":"x"}}]]`,
+		},
+		"option of option": {
+			OptionType(OptionType(U8Type)),
+			&Option{Value: nil},
+			"0100",
+			`null`,
+		},
+		"list of byte arrays": {
+			ListType(ByteArrayType(address.HashLength)),
+			[]interface{}{mustBytes(testHash)},
+			"01000000" + testHash,
+			`["` + testHash + `"]`,
+		},
+	}
+}
+
+func mustBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func TestVectors(t *testing.T) {
+	for name, test := range vectors() {
+		t.Run(name, func(t *testing.T) {
+			b, err := Encode(test.clType, test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(b) != test.bytes {
+				t.Fatalf("bytes %x, want %s", b, test.bytes)
+			}
+
+			decoded, err := Decode(test.clType, mustBytes(test.bytes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, test.value) {
+				t.Fatalf("decoded %#v, want %#v", decoded, test.value)
+			}
+
+			parsed, err := ValueToJSON(test.clType, test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(parsed) != test.json {
+				t.Fatalf("json %s, want %s", parsed, test.json)
+			}
+
+			if test.clType.Tag == AnyTag {
+				return
+			}
+			// Option(Option(U8)) Some(None) and None are both
+			// null in JSON, JSON round trips are ambiguous.
+			if name == "option of option" {
+				return
+			}
+			fromJSON, err := ValueFromJSON(test.clType, []byte(test.json))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fromJSON, test.value) {
+				t.Fatalf("decoded %#v from json, want %#v", fromJSON, test.value)
+			}
+		})
+	}
+}
+
+func TestCLValueRoundTrip(t *testing.T) {
+	for name, test := range vectors() {
+		t.Run(name, func(t *testing.T) {
+			value, err := New(test.clType, test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// bytesrepr of the CLValue, with its type.
+			decoded, rest, err := FromBytes(append(value.ToBytes(), 0xff))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(rest, []byte{0xff}) {
+				t.Fatalf("rest %x", rest)
+			}
+			if !reflect.DeepEqual(decoded.Type, value.Type) || !bytes.Equal(decoded.Bytes, value.Bytes) {
+				t.Fatalf("decoded %#v, want %#v", decoded, value)
+			}
+
+			// JSON of the CLValue, as served by casper-node.
+			data, err := json.Marshal(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fromJSON CLValue
+			if err := json.Unmarshal(data, &fromJSON); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fromJSON.Type, value.Type) || !bytes.Equal(fromJSON.Bytes, value.Bytes) {
+				t.Fatalf("decoded %#v from %s, want %#v", fromJSON, data, value)
+			}
+		})
+	}
+}
+
+func TestCLTypes(t *testing.T) {
+	tests := map[string]struct {
+		clType *CLType
+		bytes  string
+		json   string
+	}{
+		"bool":       {BoolType, "00", `"Bool"`},
+		"i32":        {I32Type, "01", `"I32"`},
+		"i64":        {I64Type, "02", `"I64"`},
+		"u8":         {U8Type, "03", `"U8"`},
+		"u32":        {U32Type, "04", `"U32"`},
+		"u64":        {U64Type, "05", `"U64"`},
+		"u128":       {U128Type, "06", `"U128"`},
+		"u256":       {U256Type, "07", `"U256"`},
+		"u512":       {U512Type, "08", `"U512"`},
+		"unit":       {UnitType, "09", `"Unit"`},
+		"string":     {StringType, "0a", `"String"`},
+		"key":        {KeyType, "0b", `"Key"`},
+		"uref":       {URefType, "0c", `"URef"`},
+		"option":     {OptionType(U64Type), "0d05", `{"Option":"U64"}`},
+		"list":       {ListType(U8Type), "0e03", `{"List":"U8"}`},
+		"byte array": {ByteArrayType(32), "0f20000000", `{"ByteArray":32}`},
+		"result":     {ResultType(U8Type, StringType), "10030a", `{"Result":{"err":"String","ok":"U8"}}`},
+		"map":        {MapType(StringType, U8Type), "110a03", `{"Map":{"key":"String","value":"U8"}}`},
+		"tuple1":     {Tuple1Type(U8Type), "1203", `{"Tuple1":["U8"]}`},
+		"tuple2":     {Tuple2Type(U8Type, StringType), "13030a", `{"Tuple2":["U8","String"]}`},
+		"tuple3":     {Tuple3Type(BoolType, U8Type, U32Type), "14000304", `{"Tuple3":["Bool","U8","U32"]}`},
+		"any":        {AnyType, "15", `"Any"`},
+		"public key": {PublicKeyType, "16", `"PublicKey"`},
+		"nested": {
+			OptionType(ListType(MapType(StringType, ResultType(U8Type, StringType)))),
+			"0d0e110a10030a",
+			`{"Option":{"List":{"Map":{"key":"String","value":{"Result":{"err":"String","ok":"U8"}}}}}}`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if b := hex.EncodeToString(test.clType.Bytes()); b != test.bytes {
+				t.Fatalf("bytes %s, want %s", b, test.bytes)
+			}
+			parsed, rest, err := ParseCLType(mustBytes(test.bytes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rest) > 0 || !reflect.DeepEqual(parsed, test.clType) {
+				t.Fatalf("parsed %s, rest %x", parsed, rest)
+			}
+
+			data, err := json.Marshal(test.clType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.json {
+				t.Fatalf("json %s, want %s", data, test.json)
+			}
+			var fromJSON CLType
+			if err := json.Unmarshal(data, &fromJSON); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&fromJSON, test.clType) {
+				t.Fatalf("decoded %s from json, want %s", &fromJSON, test.clType)
+			}
+		})
+	}
+}
+
+func TestU512(t *testing.T) {
+	tests := map[string]struct {
+		value *big.Int
+		bytes string
+	}{
+		"zero":              {big.NewInt(0), "00"},
+		"one":               {big.NewInt(1), "0101"},
+		"largest one byte":  {big.NewInt(255), "01ff"},
+		"smallest two byte": {big.NewInt(256), "020001"},
+		"2^64":              {new(big.Int).Lsh(big.NewInt(1), 64), "09" + "0000000000000000" + "01"},
+		"largest":           {maxU512, "40" + strings.Repeat("ff", 64)},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := Encode(U512Type, test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(b) != test.bytes {
+				t.Fatalf("bytes %x, want %s", b, test.bytes)
+			}
+
+			decoded, err := Decode(U512Type, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.(*big.Int).Cmp(test.value) != 0 {
+				t.Fatalf("decoded %s, want %s", decoded, test.value)
+			}
+
+			// Amounts are numbers or strings of numbers in JSON.
+			for _, data := range []string{test.value.String(), `"` + test.value.String() + `"`} {
+				fromJSON, err := ValueFromJSON(U512Type, []byte(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fromJSON.(*big.Int).Cmp(test.value) != 0 {
+					t.Fatalf("decoded %s from %s", fromJSON, data)
+				}
+			}
+		})
+	}
+
+	tooLarge := new(big.Int).Add(maxU512, big.NewInt(1))
+	for name, value := range map[string]*big.Int{"too large": tooLarge, "negative": big.NewInt(-1)} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Encode(U512Type, value); !errors.Is(err, ErrInvalidCLValue) {
+				t.Fatalf("error %v encoding %s", err, value)
+			}
+			if _, err := ValueFromJSON(U512Type, []byte(`"`+value.String()+`"`)); !errors.Is(err, ErrInvalidCLValue) {
+				t.Fatalf("error %v decoding %s", err, value)
+			}
+		})
+	}
+	for name, b := range map[string]string{
+		"longer than 64 bytes": "41" + strings.Repeat("ff", 65),
+		"truncated":            "02ff",
+		"empty":                "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode(U512Type, mustBytes(b)); err == nil {
+				t.Fatalf("decoded %s", b)
+			}
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	tests := map[string]struct {
+		key   string
+		bytes string
+		json  string
+	}{
+		"account":                  {"account-hash-" + testHash, "00" + testHash, "Account"},
+		"hash":                     {"hash-" + testHash, "01" + testHash, "Hash"},
+		"uref":                     {"uref-" + testHash + "-007", "02" + testHash + "07", "URef"},
+		"transfer":                 {"transfer-" + testHash, "03" + testHash, "Transfer"},
+		"deploy info":              {"deploy-" + testHash, "04" + testHash, "DeployInfo"},
+		"era info":                 {"era-42", "05" + "2a00000000000000", "EraInfo"},
+		"balance":                  {"balance-" + testHash, "06" + testHash, "Balance"},
+		"bid":                      {"bid-" + testHash, "07" + testHash, "Bid"},
+		"withdraw":                 {"withdraw-" + testHash, "08" + testHash, "Withdraw"},
+		"dictionary":               {"dictionary-" + testHash, "09" + testHash, "Dictionary"},
+		"system contract registry": {"system-contract-registry-" + zeroHash, "0a" + zeroHash, "SystemContractRegistry"},
+		"era summary":              {"era-summary-" + zeroHash, "0b" + zeroHash, "EraSummary"},
+		"unbond":                   {"unbond-" + testHash, "0c" + testHash, "Unbond"},
+		"chainspec registry":       {"chainspec-registry-" + zeroHash, "0d" + zeroHash, "ChainspecRegistry"},
+		"checksum registry":        {"checksum-registry-" + zeroHash, "0e" + zeroHash, "ChecksumRegistry"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := ParseKey(test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.String() != test.key {
+				t.Fatalf("key %s, want %s", key, test.key)
+			}
+
+			b, err := Encode(KeyType, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(b) != test.bytes {
+				t.Fatalf("bytes %x, want %s", b, test.bytes)
+			}
+			decoded, err := Decode(KeyType, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, key) {
+				t.Fatalf("decoded %s, want %s", decoded, key)
+			}
+
+			data, err := json.Marshal(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `{"` + test.json + `":"` + test.key + `"}`; string(data) != want {
+				t.Fatalf("json %s, want %s", data, want)
+			}
+
+			// casper-node 2.x formats keys as strings.
+			for _, data := range [][]byte{data, []byte(`"` + test.key + `"`)} {
+				var fromJSON Key
+				if err := json.Unmarshal(data, &fromJSON); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(&fromJSON, key) {
+					t.Fatalf("decoded %s from %s", &fromJSON, data)
+				}
+			}
+		})
+	}
+}
+
+func TestMapEntriesAreSortedByKey(t *testing.T) {
+	mapType := MapType(U8Type, StringType)
+	sorted := []MapEntry{{Key: uint8(1), Value: "a"}, {Key: uint8(2), Value: "b"}, {Key: uint8(3), Value: "c"}}
+	unsorted := []MapEntry{sorted[2], sorted[0], sorted[1]}
+
+	want, err := Encode(mapType, sorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Encode(mapType, unsorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("bytes %x, want %x", got, want)
+	}
+
+	decoded, err := Decode(mapType, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, sorted) {
+		t.Fatalf("decoded %#v, want %#v", decoded, sorted)
+	}
+
+	duplicate := append(unsorted, MapEntry{Key: uint8(2), Value: "d"})
+	if _, err := Encode(mapType, duplicate); !errors.Is(err, ErrInvalidCLValue) {
+		t.Fatalf("error %v encoding a duplicate key", err)
+	}
+}
+
+func TestInvalidBytes(t *testing.T) {
+	tests := map[string]struct {
+		clType *CLType
+		bytes  string
+	}{
+		"bool":               {BoolType, "02"},
+		"option tag":         {OptionType(U8Type), "0201"},
+		"result tag":         {ResultType(U8Type, U8Type), "0201"},
+		"trailing bytes":     {U8Type, "0102"},
+		"uref access rights": {URefType, testHash + "08"},
+		"public key tag":     {PublicKeyType, "03" + testHash},
+		"key tag":            {KeyType, "0f" + testHash},
+		"truncated list":     {ListType(U32Type), "0200000001000000"},
+		"invalid utf-8":      {StringType, "01000000ff"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode(test.clType, mustBytes(test.bytes)); err == nil {
+				t.Fatalf("decoded %s", test.bytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clvalue
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+)
+
+// ValueToJSON returns the JSON representation of value, of type t,
+// as in the "parsed" field of the CLValues served by casper-node.
+// Values of type Any are represented as null.
+func ValueToJSON(t *CLType, value interface{}) (json.RawMessage, error) {
+	// Encoding checks that value is of type t.
+	if _, err := Encode(t, value); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jsonValue(t, value))
+}
+
+// jsonValue returns the JSON-marshalable representation
+// of value, which must be a valid value of type t.
+func jsonValue(t *CLType, value interface{}) interface{} {
+	switch t.Tag {
+	case U128Tag, U256Tag, U512Tag:
+		return value.(*big.Int).String()
+	case UnitTag, AnyTag:
+		return nil
+	case URefTag:
+		return value.(*address.URef).String()
+	case PublicKeyTag:
+		return value.(*address.PublicKey).String()
+	case OptionTag:
+		v, _ := value.(*Option)
+		if v == nil {
+			return nil
+		}
+		return jsonValue(t.Inner[0], v.Value)
+	case ListTag:
+		values := []interface{}{}
+		for _, v := range value.([]interface{}) {
+			values = append(values, jsonValue(t.Inner[0], v))
+		}
+		return values
+	case ByteArrayTag:
+		return hex.EncodeToString(value.([]byte))
+	case ResultTag:
+		v := value.(*Result)
+		if v.Ok {
+			return map[string]interface{}{"Ok": jsonValue(t.Inner[0], v.Value)}
+		}
+		return map[string]interface{}{"Err": jsonValue(t.Inner[1], v.Value)}
+	case MapTag:
+		entries := []interface{}{}
+		for _, entry := range value.([]MapEntry) {
+			entries = append(entries, map[string]interface{}{
+				"key":   jsonValue(t.Inner[0], entry.Key),
+				"value": jsonValue(t.Inner[1], entry.Value),
+			})
+		}
+		return entries
+	case Tuple1Tag, Tuple2Tag, Tuple3Tag:
+		values := value.([]interface{})
+		tuple := make([]interface{}, len(values))
+		for i, inner := range t.Inner {
+			tuple[i] = jsonValue(inner, values[i])
+		}
+		return tuple
+	}
+
+	// Bool, integers, String and Key values
+	// marshal as casper-node represents them.
+	return value
+}
+
+// ValueFromJSON decodes the JSON representation of a value of type t,
+// as returned by ValueToJSON. Values of type Any cannot be decoded.
+func ValueFromJSON(t *CLType, data []byte) (interface{}, error) {
+	if err := t.validate(0); err != nil {
+		return nil, err
+	}
+
+	return fromJSON(t, data)
+}
+
+func fromJSON(t *CLType, data []byte) (interface{}, error) {
+	invalid := func(err error) error {
+		return fmt.Errorf("%w: invalid %s value %s: %s", ErrInvalidCLValue, t, string(data), err.Error())
+	}
+
+	switch t.Tag {
+	case BoolTag:
+		var v bool
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, invalid(err)
+		}
+		return v, nil
+	case I32Tag, I64Tag:
+		number, err := jsonNumber(data)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		v, err := strconv.ParseInt(number, 10, 8*intSize(t.Tag)) // nolint:gomnd
+		if err != nil {
+			return nil, invalid(err)
+		}
+		if t.Tag == I32Tag {
+			return int32(v), nil
+		}
+		return v, nil
+	case U8Tag, U32Tag, U64Tag:
+		number, err := jsonNumber(data)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		v, err := strconv.ParseUint(number, 10, 8*intSize(t.Tag)) // nolint:gomnd
+		if err != nil {
+			return nil, invalid(err)
+		}
+		switch t.Tag {
+		case U8Tag:
+			return uint8(v), nil
+		case U32Tag:
+			return uint32(v), nil
+		}
+		return v, nil
+	case U128Tag, U256Tag, U512Tag:
+		number, err := jsonNumber(data)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		v, ok := new(big.Int).SetString(number, 10)                       // nolint:gomnd
+		if !ok || v.Sign() < 0 || v.BitLen() > 8*maxBigUintBytes[t.Tag] { // nolint:gomnd
+			return nil, invalid(fmt.Errorf("out of range"))
+		}
+		return v, nil
+	case UnitTag:
+		if !isNull(data) {
+			return nil, invalid(fmt.Errorf("expected null"))
+		}
+		return Unit{}, nil
+	case StringTag:
+		var v string
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, invalid(err)
+		}
+		return v, nil
+	case KeyTag:
+		v := new(Key)
+		if err := json.Unmarshal(data, v); err != nil {
+			return nil, invalid(err)
+		}
+		return v, nil
+	case URefTag:
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, invalid(err)
+		}
+		v, err := address.ParseURef(s)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return v, nil
+	case PublicKeyTag:
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, invalid(err)
+		}
+		v, err := address.ParsePublicKey(s)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return v, nil
+	case OptionTag:
+		if isNull(data) {
+			return nil, nil
+		}
+		v, err := fromJSON(t.Inner[0], data)
+		if err != nil {
+			return nil, err
+		}
+		return &Option{Value: v}, nil
+	case ListTag:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, invalid(err)
+		}
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			if values[i], err = fromJSON(t.Inner[0], item); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case ByteArrayTag:
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, invalid(err)
+		}
+		v, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		if len(v) != int(t.Size) {
+			return nil, invalid(fmt.Errorf("expected %d bytes, got %d", t.Size, len(v)))
+		}
+		return v, nil
+	case ResultTag:
+		var result struct {
+			Ok  json.RawMessage `json:"Ok"`
+			Err json.RawMessage `json:"Err"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, invalid(err)
+		}
+		switch {
+		case result.Ok != nil && result.Err == nil:
+			v, err := fromJSON(t.Inner[0], result.Ok)
+			if err != nil {
+				return nil, err
+			}
+			return &Result{Ok: true, Value: v}, nil
+		case result.Err != nil && result.Ok == nil:
+			v, err := fromJSON(t.Inner[1], result.Err)
+			if err != nil {
+				return nil, err
+			}
+			return &Result{Value: v}, nil
+		}
+		return nil, invalid(fmt.Errorf("expected exactly one of Ok and Err"))
+	case MapTag:
+		var items []struct {
+			Key   json.RawMessage `json:"key"`
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, invalid(err)
+		}
+		entries := make([]MapEntry, len(items))
+		for i, item := range items {
+			var err error
+			if entries[i].Key, err = fromJSON(t.Inner[0], item.Key); err != nil {
+				return nil, err
+			}
+			if entries[i].Value, err = fromJSON(t.Inner[1], item.Value); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	case Tuple1Tag, Tuple2Tag, Tuple3Tag:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, invalid(err)
+		}
+		if len(items) != len(t.Inner) {
+			return nil, invalid(fmt.Errorf("expected %d elements, got %d", len(t.Inner), len(items)))
+		}
+		values := make([]interface{}, len(items))
+		for i, inner := range t.Inner {
+			var err error
+			if values[i], err = fromJSON(inner, items[i]); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s values cannot be decoded from json", ErrInvalidCLValue, t)
+}
+
+// jsonNumber returns the decimal representation of
+// a JSON number or of a JSON string of a number.
+func jsonNumber(data []byte) (string, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s, nil
+	}
+
+	var number json.Number
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&number); err != nil {
+		return "", err
+	}
+
+	return number.String(), nil
+}
+
+// intSize returns the size in bytes of the integer types.
+func intSize(tag byte) int {
+	switch tag {
+	case U8Tag:
+		return 1
+	case I32Tag, U32Tag:
+		return 4 // nolint:gomnd
+	}
+
+	return 8 // nolint:gomnd
+}
+
+func isNull(data []byte) bool {
+	return string(bytes.TrimSpace(data)) == "null"
+}
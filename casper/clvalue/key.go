@@ -0,0 +1,249 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clvalue
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+)
+
+// Key tags, as serialized by casper-node 1.x.
+const (
+	AccountKeyTag = byte(iota)
+	HashKeyTag
+	URefKeyTag
+	TransferKeyTag
+	DeployInfoKeyTag
+	EraInfoKeyTag
+	BalanceKeyTag
+	BidKeyTag
+	WithdrawKeyTag
+	DictionaryKeyTag
+	SystemContractRegistryKeyTag
+	EraSummaryKeyTag
+	UnbondKeyTag
+	ChainspecRegistryKeyTag
+	ChecksumRegistryKeyTag
+)
+
+// keyKinds are the names and the prefixes
+// of the formatted keys, by tag.
+var keyKinds = []struct {
+	name   string
+	prefix string
+}{
+	AccountKeyTag:                {"Account", address.AccountHashPrefix},
+	HashKeyTag:                   {"Hash", "hash-"},
+	URefKeyTag:                   {"URef", address.URefPrefix},
+	TransferKeyTag:               {"Transfer", "transfer-"},
+	DeployInfoKeyTag:             {"DeployInfo", "deploy-"},
+	EraInfoKeyTag:                {"EraInfo", "era-"},
+	BalanceKeyTag:                {"Balance", "balance-"},
+	BidKeyTag:                    {"Bid", "bid-"},
+	WithdrawKeyTag:               {"Withdraw", "withdraw-"},
+	DictionaryKeyTag:             {"Dictionary", "dictionary-"},
+	SystemContractRegistryKeyTag: {"SystemContractRegistry", "system-contract-registry-"},
+	EraSummaryKeyTag:             {"EraSummary", "era-summary-"},
+	UnbondKeyTag:                 {"Unbond", "unbond-"},
+	ChainspecRegistryKeyTag:      {"ChainspecRegistry", "chainspec-registry-"},
+	ChecksumRegistryKeyTag:       {"ChecksumRegistry", "checksum-registry-"},
+}
+
+// Key is a key of the global state. Only the
+// keys of protocol versions 1.x are supported.
+type Key struct {
+	Tag byte
+
+	// Hash is the address of the keys
+	// other than URef and EraInfo keys.
+	Hash [address.HashLength]byte
+
+	// URef is the URef of URef keys.
+	URef *address.URef
+
+	// EraID is the era of EraInfo keys.
+	EraID uint64
+}
+
+// ParseKey parses a formatted key, e.g. "account-hash-<hex>".
+func ParseKey(s string) (*Key, error) {
+	tag := -1
+	for i, kind := range keyKinds {
+		// The longest prefix wins, era-summary- over era-.
+		if strings.HasPrefix(s, kind.prefix) && (tag < 0 || len(kind.prefix) > len(keyKinds[tag].prefix)) {
+			tag = i
+		}
+	}
+	if tag < 0 {
+		return nil, fmt.Errorf("%w: unknown key %s", ErrInvalidCLValue, s)
+	}
+
+	key := &Key{Tag: byte(tag)}
+	switch key.Tag {
+	case URefKeyTag:
+		uref, err := address.ParseURef(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCLValue, err.Error())
+		}
+		key.URef = uref
+	case EraInfoKeyTag:
+		eraID, err := strconv.ParseUint(strings.TrimPrefix(s, keyKinds[tag].prefix), 10, 64) // nolint:gomnd
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid era of key %s", ErrInvalidCLValue, s)
+		}
+		key.EraID = eraID
+	default:
+		hash, err := address.DecodeHex(strings.TrimPrefix(s, keyKinds[tag].prefix))
+		if err != nil || len(hash) != address.HashLength {
+			return nil, fmt.Errorf("%w: invalid address of key %s", ErrInvalidCLValue, s)
+		}
+		copy(key.Hash[:], hash)
+	}
+
+	return key, nil
+}
+
+func (k *Key) validate() error {
+	if int(k.Tag) >= len(keyKinds) {
+		return fmt.Errorf("%w: unsupported key tag %d", ErrInvalidCLValue, k.Tag)
+	}
+	if k.Tag == URefKeyTag && k.URef == nil {
+		return fmt.Errorf("%w: missing uref of key", ErrInvalidCLValue)
+	}
+
+	return nil
+}
+
+// String returns the formatted key, as served by casper-node.
+func (k *Key) String() string {
+	if k.validate() != nil {
+		return ""
+	}
+
+	switch k.Tag {
+	case URefKeyTag:
+		return k.URef.String()
+	case EraInfoKeyTag:
+		return keyKinds[k.Tag].prefix + strconv.FormatUint(k.EraID, 10) // nolint:gomnd
+	}
+
+	return keyKinds[k.Tag].prefix + hex.EncodeToString(k.Hash[:])
+}
+
+func (k *Key) appendBytes(b []byte) ([]byte, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+
+	b = append(b, k.Tag)
+	switch k.Tag {
+	case URefKeyTag:
+		return append(append(b, k.URef.Addr[:]...), k.URef.AccessRights), nil
+	case EraInfoKeyTag:
+		return appendU64(b, k.EraID), nil
+	}
+
+	return append(b, k.Hash[:]...), nil
+}
+
+func readKey(b []byte) (*Key, []byte, error) {
+	tag, b, err := readByte(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if int(tag) >= len(keyKinds) {
+		return nil, nil, fmt.Errorf("%w: unsupported key tag %d", ErrInvalidCLValue, tag)
+	}
+
+	key := &Key{Tag: tag}
+
+	switch tag {
+	case URefKeyTag:
+		if key.URef, b, err = readURef(b); err != nil {
+			return nil, nil, err
+		}
+	case EraInfoKeyTag:
+		if key.EraID, b, err = readU64(b); err != nil {
+			return nil, nil, err
+		}
+	default:
+		var hash []byte
+		if hash, b, err = readBytes(b, address.HashLength); err != nil {
+			return nil, nil, err
+		}
+		copy(key.Hash[:], hash)
+	}
+
+	return key, b, nil
+}
+
+func readURef(b []byte) (*address.URef, []byte, error) {
+	addr, b, err := readBytes(b, address.HashLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	rights, b, err := readByte(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rights > address.AccessRightsReadAddWrite {
+		return nil, nil, fmt.Errorf("%w: invalid access rights %d", ErrInvalidCLValue, rights)
+	}
+
+	uref := &address.URef{AccessRights: rights}
+	copy(uref.Addr[:], addr)
+
+	return uref, b, nil
+}
+
+// MarshalJSON encodes k as casper-node 1.x does, as
+// an object of its formatted key by key kind, e.g.
+// {"Account": "account-hash-<hex>"}.
+func (k *Key) MarshalJSON() ([]byte, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]string{keyKinds[k.Tag].name: k.String()})
+}
+
+// UnmarshalJSON decodes a key encoded as by MarshalJSON
+// or, as by casper-node 2.x, as a formatted key.
+func (k *Key) UnmarshalJSON(data []byte) error {
+	var formatted string
+	if err := json.Unmarshal(data, &formatted); err != nil {
+		var object map[string]string
+		if err := json.Unmarshal(data, &object); err != nil || len(object) != 1 {
+			return fmt.Errorf("%w: invalid key %s", ErrInvalidCLValue, string(data))
+		}
+		for _, value := range object {
+			formatted = value
+		}
+	}
+
+	key, err := ParseKey(formatted)
+	if err != nil {
+		return err
+	}
+	*k = *key
+
+	return nil
+}
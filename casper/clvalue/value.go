@@ -0,0 +1,510 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clvalue
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+)
+
+// Values are represented by the following Go types:
+//
+//	Bool              bool
+//	I32, I64          int32, int64
+//	U8, U32, U64      uint8, uint32, uint64
+//	U128, U256, U512  *big.Int
+//	Unit              Unit
+//	String            string
+//	Key               *Key
+//	URef              *address.URef
+//	PublicKey         *address.PublicKey
+//	Option            nil for None, *Option for Some
+//	List, Tuple1-3    []interface{}
+//	ByteArray         []byte
+//	Result            *Result
+//	Map               []MapEntry, serialized by key
+//	Any               []byte, the serialized value
+
+// Unit is the value of the Unit type.
+type Unit struct{}
+
+// Option is a value of an Option type other than None.
+type Option struct {
+	Value interface{}
+}
+
+// Result is a value of a Result type: an ok
+// value if Ok is true, an err value otherwise.
+type Result struct {
+	Ok    bool
+	Value interface{}
+}
+
+// MapEntry is an entry of a value of a Map type.
+type MapEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Tags of the variants of Option and Result values.
+const (
+	noneTag = byte(0)
+	someTag = byte(1)
+	errTag  = byte(0)
+	okTag   = byte(1)
+)
+
+// maxBigUintBytes are the lengths of the
+// largest U128, U256 and U512 values.
+var maxBigUintBytes = map[byte]int{
+	U128Tag: 16, // nolint:gomnd
+	U256Tag: 32, // nolint:gomnd
+	U512Tag: 64, // nolint:gomnd
+}
+
+func typeError(t *CLType, value interface{}) error {
+	return fmt.Errorf("%w: %T is not a %s value", ErrInvalidCLValue, value, t)
+}
+
+// Encode returns the bytesrepr serialization of value, of type t.
+func Encode(t *CLType, value interface{}) ([]byte, error) {
+	if err := t.validate(0); err != nil {
+		return nil, err
+	}
+
+	return appendValue(nil, t, value)
+}
+
+func appendValue(b []byte, t *CLType, value interface{}) ([]byte, error) {
+	switch t.Tag {
+	case BoolTag:
+		v, ok := value.(bool)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		if v {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case I32Tag:
+		v, ok := value.(int32)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		return appendU32(b, uint32(v)), nil
+	case I64Tag:
+		v, ok := value.(int64)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		return appendU64(b, uint64(v)), nil
+	case U8Tag:
+		v, ok := value.(uint8)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		return append(b, v), nil
+	case U32Tag:
+		v, ok := value.(uint32)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		return appendU32(b, v), nil
+	case U64Tag:
+		v, ok := value.(uint64)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		return appendU64(b, v), nil
+	case U128Tag, U256Tag, U512Tag:
+		v, ok := value.(*big.Int)
+		if !ok || v == nil {
+			return nil, typeError(t, value)
+		}
+		return appendBigUint(b, v, maxBigUintBytes[t.Tag])
+	case UnitTag:
+		if _, ok := value.(Unit); !ok {
+			return nil, typeError(t, value)
+		}
+		return b, nil
+	case StringTag:
+		v, ok := value.(string)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		return appendString(b, v), nil
+	case KeyTag:
+		v, ok := value.(*Key)
+		if !ok || v == nil {
+			return nil, typeError(t, value)
+		}
+		return v.appendBytes(b)
+	case URefTag:
+		v, ok := value.(*address.URef)
+		if !ok || v == nil {
+			return nil, typeError(t, value)
+		}
+		return append(append(b, v.Addr[:]...), v.AccessRights), nil
+	case PublicKeyTag:
+		v, ok := value.(*address.PublicKey)
+		if !ok || v == nil {
+			return nil, typeError(t, value)
+		}
+		if _, err := address.NewPublicKey(v.Tag, v.Bytes); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCLValue, err.Error())
+		}
+		return append(append(b, v.Tag), v.Bytes...), nil
+	case OptionTag:
+		if value == nil {
+			return append(b, noneTag), nil
+		}
+		v, ok := value.(*Option)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		if v == nil {
+			return append(b, noneTag), nil
+		}
+		return appendValue(append(b, someTag), t.Inner[0], v.Value)
+	case ListTag:
+		v, ok := value.([]interface{})
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		return appendValues(appendU32(b, uint32(len(v))), t.Inner[0], v)
+	case ByteArrayTag:
+		v, ok := value.([]byte)
+		if !ok || len(v) != int(t.Size) {
+			return nil, typeError(t, value)
+		}
+		return append(b, v...), nil
+	case ResultTag:
+		v, ok := value.(*Result)
+		if !ok || v == nil {
+			return nil, typeError(t, value)
+		}
+		if v.Ok {
+			return appendValue(append(b, okTag), t.Inner[0], v.Value)
+		}
+		return appendValue(append(b, errTag), t.Inner[1], v.Value)
+	case MapTag:
+		v, ok := value.([]MapEntry)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		return appendMap(b, t, v)
+	case Tuple1Tag, Tuple2Tag, Tuple3Tag:
+		v, ok := value.([]interface{})
+		if !ok || len(v) != len(t.Inner) {
+			return nil, typeError(t, value)
+		}
+		for i, inner := range t.Inner {
+			var err error
+			if b, err = appendValue(b, inner, v[i]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case AnyTag:
+		v, ok := value.([]byte)
+		if !ok {
+			return nil, typeError(t, value)
+		}
+		return append(b, v...), nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown type tag %d", ErrInvalidCLValue, t.Tag)
+}
+
+// appendMap appends the entries of a value of the Map type t,
+// sorted by serialized key as by casper-node, whatever their
+// order in entries. Duplicate keys are rejected.
+func appendMap(b []byte, t *CLType, entries []MapEntry) ([]byte, error) {
+	type encodedEntry struct {
+		key   []byte
+		value []byte
+	}
+
+	encoded := make([]encodedEntry, len(entries))
+	for i, entry := range entries {
+		var err error
+		if encoded[i].key, err = appendValue(nil, t.Inner[0], entry.Key); err != nil {
+			return nil, err
+		}
+		if encoded[i].value, err = appendValue(nil, t.Inner[1], entry.Value); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i].key, encoded[j].key) < 0
+	})
+
+	b = appendU32(b, uint32(len(encoded)))
+	for i, entry := range encoded {
+		if i > 0 && bytes.Equal(entry.key, encoded[i-1].key) {
+			return nil, fmt.Errorf("%w: duplicate key %x in %s value", ErrInvalidCLValue, entry.key, t)
+		}
+		b = append(append(b, entry.key...), entry.value...)
+	}
+
+	return b, nil
+}
+
+func appendValues(b []byte, t *CLType, values []interface{}) ([]byte, error) {
+	for _, value := range values {
+		var err error
+		if b, err = appendValue(b, t, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// appendBigUint appends the length of v in bytes,
+// followed by its little endian bytes.
+func appendBigUint(b []byte, v *big.Int, maxBytes int) ([]byte, error) {
+	if v.Sign() < 0 || v.BitLen() > 8*maxBytes { // nolint:gomnd
+		return nil, fmt.Errorf("%w: %s does not fit in %d bytes", ErrInvalidCLValue, v.String(), maxBytes)
+	}
+
+	bigEndian := v.Bytes()
+	b = append(b, byte(len(bigEndian)))
+	for i := len(bigEndian) - 1; i >= 0; i-- {
+		b = append(b, bigEndian[i])
+	}
+
+	return b, nil
+}
+
+// Decode decodes the bytesrepr serialization of a value of type t.
+func Decode(t *CLType, b []byte) (interface{}, error) {
+	if err := t.validate(0); err != nil {
+		return nil, err
+	}
+
+	value, rest, err := readValue(b, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes after %s value", ErrInvalidCLValue, len(rest), t)
+	}
+
+	return value, nil
+}
+
+func readValue(b []byte, t *CLType) (interface{}, []byte, error) {
+	switch t.Tag {
+	case BoolTag:
+		v, b, err := readByte(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		if v > 1 {
+			return nil, nil, fmt.Errorf("%w: invalid bool %d", ErrInvalidCLValue, v)
+		}
+		return v == 1, b, nil
+	case I32Tag:
+		v, b, err := readU32(b)
+		return int32(v), b, err
+	case I64Tag:
+		v, b, err := readU64(b)
+		return int64(v), b, err
+	case U8Tag:
+		v, b, err := readByte(b)
+		return v, b, err
+	case U32Tag:
+		v, b, err := readU32(b)
+		return v, b, err
+	case U64Tag:
+		v, b, err := readU64(b)
+		return v, b, err
+	case U128Tag, U256Tag, U512Tag:
+		return readBigUint(b, maxBigUintBytes[t.Tag])
+	case UnitTag:
+		return Unit{}, b, nil
+	case StringTag:
+		length, b, err := readU32(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, b, err := readBytes(b, int(length))
+		if err != nil {
+			return nil, nil, err
+		}
+		if !utf8.Valid(v) {
+			return nil, nil, fmt.Errorf("%w: invalid utf-8 string", ErrInvalidCLValue)
+		}
+		return string(v), b, nil
+	case KeyTag:
+		return readKey(b)
+	case URefTag:
+		return readURef(b)
+	case PublicKeyTag:
+		return readPublicKey(b)
+	case OptionTag:
+		tag, b, err := readByte(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch tag {
+		case noneTag:
+			return nil, b, nil
+		case someTag:
+			v, b, err := readValue(b, t.Inner[0])
+			if err != nil {
+				return nil, nil, err
+			}
+			return &Option{Value: v}, b, nil
+		}
+		return nil, nil, fmt.Errorf("%w: invalid option tag %d", ErrInvalidCLValue, tag)
+	case ListTag:
+		length, b, err := readU32(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		return readValues(b, t.Inner[0], int(length))
+	case ByteArrayTag:
+		v, b, err := readBytes(b, int(t.Size))
+		if err != nil {
+			return nil, nil, err
+		}
+		return append([]byte{}, v...), b, nil
+	case ResultTag:
+		tag, b, err := readByte(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tag != okTag && tag != errTag {
+			return nil, nil, fmt.Errorf("%w: invalid result tag %d", ErrInvalidCLValue, tag)
+		}
+		inner := t.Inner[1]
+		if tag == okTag {
+			inner = t.Inner[0]
+		}
+		v, b, err := readValue(b, inner)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &Result{Ok: tag == okTag, Value: v}, b, nil
+	case MapTag:
+		length, b, err := readU32(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries := make([]MapEntry, 0, capacity(length, b))
+		for i := uint32(0); i < length; i++ {
+			var entry MapEntry
+			if entry.Key, b, err = readValue(b, t.Inner[0]); err != nil {
+				return nil, nil, err
+			}
+			if entry.Value, b, err = readValue(b, t.Inner[1]); err != nil {
+				return nil, nil, err
+			}
+			entries = append(entries, entry)
+		}
+		return entries, b, nil
+	case Tuple1Tag, Tuple2Tag, Tuple3Tag:
+		values := make([]interface{}, len(t.Inner))
+		for i, inner := range t.Inner {
+			var err error
+			if values[i], b, err = readValue(b, inner); err != nil {
+				return nil, nil, err
+			}
+		}
+		return values, b, nil
+	case AnyTag:
+		// Any values are not delimited,
+		// they span the remaining bytes.
+		return append([]byte{}, b...), nil, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: unknown type tag %d", ErrInvalidCLValue, t.Tag)
+}
+
+func readValues(b []byte, t *CLType, length int) ([]interface{}, []byte, error) {
+	values := make([]interface{}, 0, capacity(uint32(length), b))
+	for i := 0; i < length; i++ {
+		var value interface{}
+		var err error
+		if value, b, err = readValue(b, t); err != nil {
+			return nil, nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, b, nil
+}
+
+// capacity bounds the capacity allocated for length
+// elements by the number of bytes left to decode.
+func capacity(length uint32, b []byte) int {
+	if int(length) > len(b) {
+		return len(b)
+	}
+
+	return int(length)
+}
+
+func readBigUint(b []byte, maxBytes int) (*big.Int, []byte, error) {
+	length, b, err := readByte(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if int(length) > maxBytes {
+		return nil, nil, fmt.Errorf("%w: %d bytes do not fit in %d bytes", ErrInvalidCLValue, length, maxBytes)
+	}
+
+	littleEndian, b, err := readBytes(b, int(length))
+	if err != nil {
+		return nil, nil, err
+	}
+	bigEndian := make([]byte, len(littleEndian))
+	for i, v := range littleEndian {
+		bigEndian[len(bigEndian)-1-i] = v
+	}
+
+	return new(big.Int).SetBytes(bigEndian), b, nil
+}
+
+func readPublicKey(b []byte) (*address.PublicKey, []byte, error) {
+	tag, b, err := readByte(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var length int
+	switch tag {
+	case address.ED25519Tag:
+		length = address.ED25519Length
+	case address.SECP256K1Tag:
+		length = address.SECP256K1Length
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported public key tag %d", ErrInvalidCLValue, tag)
+	}
+
+	bytes, b, err := readBytes(b, length)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &address.PublicKey{Tag: tag, Bytes: append([]byte{}, bytes...)}, b, nil
+}
@@ -0,0 +1,363 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+const (
+	// TransfersOperationBuilder builds the operations of a deploy
+	// from its transfer records and its payment amount.
+	TransfersOperationBuilder = "transfers"
+
+	// EffectsOperationBuilder builds the operations of a deploy
+	// from the balance transforms of its execution effects.
+	EffectsOperationBuilder = "effects"
+
+	balanceKeyPrefix     = "balance-"
+	balanceHoldKeyPrefix = "balance-hold-"
+	addUInt512Transform  = "AddUInt512"
+	writeCLValue         = "WriteCLValue"
+	u512CLType           = `"U512"`
+)
+
+// OperationBuilders are the supported operation builders.
+var OperationBuilders = []string{
+	TransfersOperationBuilder,
+	EffectsOperationBuilder,
+}
+
+// purseBalances tracks the balances of the purses written
+// by the deploys of a block, in execution order. Balances
+// are read from the state of the parent block on first use.
+type purseBalances struct {
+	stateRootHash string
+	balances      map[string]*big.Int
+}
+
+func newPurseBalances(parentStateRootHash string) *purseBalances {
+	return &purseBalances{
+		stateRootHash: parentStateRootHash,
+		balances:      map[string]*big.Int{},
+	}
+}
+
+// purseBalance returns the current balance of the
+// purse stored under the balance key.
+func (ec *Client) purseBalance(
+	ctx context.Context,
+	balances *purseBalances,
+	key string,
+) (*big.Int, error) {
+	if balance, ok := balances.balances[key]; ok {
+		return balance, nil
+	}
+
+	balance := new(big.Int)
+	if len(balances.stateRootHash) > 0 {
+		var err error
+		balance, err = ec.node.GetBalance(ctx, balances.stateRootHash, balanceKeyPurse(key)+"-001")
+		if err != nil && !rpc.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: could not get balance of %s", err, key)
+		}
+		if err != nil {
+			// The purse is created by the block.
+			balance = new(big.Int)
+		}
+	}
+	balances.balances[key] = balance
+
+	return balance, nil
+}
+
+// isBalanceKey returns true if key holds the balance of a
+// purse. Balance holds of protocol versions 2.x share its
+// prefix but do not move funds.
+func isBalanceKey(key string) bool {
+	return strings.HasPrefix(key, balanceKeyPrefix) && !strings.HasPrefix(key, balanceHoldKeyPrefix)
+}
+
+// balanceKeyPurse returns the purse address
+// stored under a balance key.
+func balanceKeyPurse(key string) string {
+	return "uref-" + strings.TrimPrefix(key, balanceKeyPrefix)
+}
+
+// balanceTransform decodes a transform of a balance key. It returns
+// either the amount added to the balance or its new value, and
+// false if the transform does not change the balance.
+func balanceTransform(transform json.RawMessage) (added *big.Int, written *big.Int, ok bool, err error) {
+	var variants map[string]json.RawMessage
+	if err := json.Unmarshal(transform, &variants); err != nil {
+		// Unit variants such as "Identity" are plain strings.
+		return nil, nil, false, nil
+	}
+
+	if raw, found := variants[addUInt512Transform]; found {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, nil, false, fmt.Errorf("%w: invalid %s transform", err, addUInt512Transform)
+		}
+		added, ok := new(big.Int).SetString(value, 10) // nolint:gomnd
+		if !ok {
+			return nil, nil, false, fmt.Errorf("invalid %s value %s", addUInt512Transform, value)
+		}
+
+		return added, nil, true, nil
+	}
+
+	if raw, found := variants[writeCLValue]; found {
+		var clValue rpc.CLValue
+		if err := json.Unmarshal(raw, &clValue); err != nil {
+			return nil, nil, false, fmt.Errorf("%w: invalid %s transform", err, writeCLValue)
+		}
+		if string(clValue.CLType) != u512CLType {
+			return nil, nil, false, nil
+		}
+
+		var value string
+		if err := json.Unmarshal(clValue.Parsed, &value); err != nil {
+			return nil, nil, false, fmt.Errorf("%w: invalid %s value", err, writeCLValue)
+		}
+		written, ok := new(big.Int).SetString(value, 10) // nolint:gomnd
+		if !ok {
+			return nil, nil, false, fmt.Errorf("invalid %s value %s", writeCLValue, value)
+		}
+
+		return nil, written, true, nil
+	}
+
+	return nil, nil, false, nil
+}
+
+// effectsOperations returns the operations of the purses whose balance
+// is changed by the transforms of outcome, in order of first change,
+// attributed to their owners. The part of a change paying or receiving
+// fee is a FEE operation, the rest a TRANSFER operation. balances is
+// updated with the new balances.
+func (ec *Client) effectsOperations(
+	ctx context.Context,
+	outcome *rpc.ExecutionOutcome,
+	fee *deployFee,
+	balances *purseBalances,
+	owners *purseOwners,
+) ([]*RosettaTypes.Operation, error) {
+	deltas := map[string]*big.Int{}
+	keys := []string{}
+	for _, entry := range outcome.Effect.Transforms {
+		if !isBalanceKey(entry.Key) {
+			continue
+		}
+
+		added, written, ok, err := balanceTransform(entry.Transform)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid transform of %s", err, entry.Key)
+		}
+		if !ok {
+			continue
+		}
+
+		balance, err := ec.purseBalance(ctx, balances, entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		if written != nil {
+			added = new(big.Int).Sub(written, balance)
+		}
+		balances.balances[entry.Key] = new(big.Int).Add(balance, added)
+
+		if _, found := deltas[entry.Key]; !found {
+			deltas[entry.Key] = new(big.Int)
+			keys = append(keys, entry.Key)
+		}
+		deltas[entry.Key].Add(deltas[entry.Key], added)
+	}
+
+	fees := map[string]*big.Int{}
+	addFee := func(purse string, amount *big.Int) {
+		purse = purseAddress(purse)
+		if _, found := fees[purse]; !found {
+			fees[purse] = new(big.Int)
+		}
+		fees[purse].Add(fees[purse], amount)
+	}
+	if fee != nil {
+		addFee(fee.payer, new(big.Int).Neg(fee.amount()))
+		for _, recipient := range fee.recipients {
+			addFee(recipient.purse, recipient.amount)
+		}
+	}
+
+	operations := []*RosettaTypes.Operation{}
+	appendOperation := func(opType string, key string, amount *big.Int) {
+		if amount.Sign() == 0 {
+			return
+		}
+
+		operations = append(operations, &RosettaTypes.Operation{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: int64(len(operations)),
+			},
+			Type:    opType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: owners.account(balanceKeyPurse(key)),
+			Amount: &RosettaTypes.Amount{
+				Value:    amount.String(),
+				Currency: Currency,
+			},
+		})
+	}
+	for _, key := range keys {
+		transferred := deltas[key]
+		if feeAmount, ok := fees[purseAddress(balanceKeyPurse(key))]; ok {
+			appendOperation(FeeOpType, key, feeAmount)
+			transferred = new(big.Int).Sub(transferred, feeAmount)
+		}
+		appendOperation(TransferOpType, key, transferred)
+	}
+
+	return operations, nil
+}
+
+// createEffectsTransactions builds the operations of the provided
+// deploys from their execution effects in execution order, as a purse
+// written by a deploy is read by the following ones.
+func (ec *Client) createEffectsTransactions(
+	ctx context.Context,
+	deploys []*executedTransaction,
+	block *rpc.Block,
+	validatorMainPurse string,
+	purses blockPurses,
+) ([]*RosettaTypes.Transaction, error) {
+	strategy, err := strategyFor(block.Header.ProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	parentStateRootHash := ""
+	if block.Header.Height != uint64(GenesisBlockIndex) {
+		parent, err := ec.node.GetBlock(ctx, rpc.BlockByHash(block.Header.ParentHash))
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not get parent block", err)
+		}
+		parentStateRootHash = parent.Header.StateRootHash
+	}
+
+	balances := newPurseBalances(parentStateRootHash)
+	transactions := make([]*RosettaTypes.Transaction, len(deploys))
+	for i, deploy := range deploys {
+		executionResult, err := deploy.executionResult(block.Hash)
+		if err != nil {
+			return nil, err
+		}
+		outcome, err := executionResult.Outcome()
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid execution result of transaction %s", err, deploy.hash)
+		}
+		owners, fee, err := ec.effectsPurses(
+			ctx,
+			strategy,
+			deploy,
+			executionResult,
+			outcome,
+			block,
+			validatorMainPurse,
+			purses,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not get accounts of transaction %s", err, deploy.hash)
+		}
+
+		operations, err := ec.effectsOperations(ctx, outcome, fee, balances, owners)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not build operations of transaction %s", err, deploy.hash)
+		}
+
+		metadata, err := deploy.metadata(outcome)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions[i] = &RosettaTypes.Transaction{
+			TransactionIdentifier: &RosettaTypes.TransactionIdentifier{
+				Hash: deploy.hash,
+			},
+			Operations: operations,
+			Metadata:   metadata,
+		}
+	}
+
+	return transactions, nil
+}
+
+// effectsPurses returns the owners of the purses moved by a
+// transaction: the main purses of its initiator and of the proposer,
+// the purses of its transfers if it succeeded, and the purses of its
+// balance transforms whose owner is found in the global state. It also
+// returns the fee recorded by the effects of the transaction, if any.
+func (ec *Client) effectsPurses(
+	ctx context.Context,
+	strategy protocolStrategy,
+	deploy *executedTransaction,
+	executionResult *rpc.ExecutionResult,
+	outcome *rpc.ExecutionOutcome,
+	block *rpc.Block,
+	validatorMainPurse string,
+	purses blockPurses,
+) (*purseOwners, *deployFee, error) {
+	signerMainPurse, err := ec.initiatorMainPurse(ctx, deploy.initiator, block.Header.StateRootHash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: could not get signer purse %s", err, deploy.initiator)
+	}
+
+	transfers := []*rpc.Transfer{}
+	if executionResult.Success != nil {
+		transfers, err = strategy.deployTransfers(ctx, ec, executionResult.Success, block)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	fee, err := feeFromEffects(outcome, transfers, signerMainPurse)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owners, err := ec.transactionPurseOwners(ctx, block, deploy.initiator, signerMainPurse, validatorMainPurse, transfers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	moved := []string{}
+	for _, entry := range outcome.Effect.Transforms {
+		if isBalanceKey(entry.Key) {
+			moved = append(moved, balanceKeyPurse(entry.Key))
+		}
+	}
+	if err := ec.resolvePurseOwners(ctx, owners, block, purses, moved); err != nil {
+		return nil, nil, err
+	}
+
+	return owners, fee, nil
+}
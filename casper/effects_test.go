@@ -0,0 +1,189 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+)
+
+// balanceKey returns the balance key of purse.
+func balanceKey(purse string) string {
+	return balanceKeyPrefix + strings.TrimPrefix(PurseWithoutIndex(purse), "uref-")
+}
+
+// addBalanceTransform returns a transform adding amount to the balance of purse.
+func addBalanceTransform(purse string, amount string) rpc.TransformEntry {
+	return rpc.TransformEntry{
+		Key:       balanceKey(purse),
+		Transform: json.RawMessage(fmt.Sprintf(`{"AddUInt512":"%s"}`, amount)),
+	}
+}
+
+// writeBalanceTransform returns a transform writing the balance of purse.
+func writeBalanceTransform(purse string, balance string) rpc.TransformEntry {
+	return rpc.TransformEntry{
+		Key: balanceKey(purse),
+		Transform: json.RawMessage(fmt.Sprintf(
+			`{"WriteCLValue":{"cl_type":"U512","bytes":"","parsed":"%s"}}`,
+			balance,
+		)),
+	}
+}
+
+func TestEffectsOperations(t *testing.T) {
+	proposer := testPublicKey(0xa0)
+	signer := testPublicKey(0xa1)
+	recipient := testPublicKey(0xa2)
+	proposerPurse, signerPurse, recipientPurse := testPurse(0xc0), testPurse(0xc1), testPurse(0xc2)
+	recipientHash := testAccountHash(recipient)
+
+	// op is an operation type, account and amount.
+	type op struct {
+		opType  string
+		account string
+		amount  string
+	}
+
+	tests := map[string]struct {
+		transforms [][]rpc.TransformEntry
+		transfers  []*rpc.Transfer
+		want       [][]op
+	}{
+		"fee paid by the signer": {
+			transforms: [][]rpc.TransformEntry{{
+				writeBalanceTransform(signerPurse, "900"),
+				addBalanceTransform(proposerPurse, "100"),
+			}},
+			want: [][]op{{
+				{FeeOpType, testAccountHash(signer), "-100"},
+				{FeeOpType, testAccountHash(proposer), "100"},
+			}},
+		},
+		"fee and transfer": {
+			transforms: [][]rpc.TransformEntry{{
+				writeBalanceTransform(signerPurse, "870"),
+				addBalanceTransform(recipientPurse, "30"),
+				addBalanceTransform(proposerPurse, "100"),
+			}},
+			transfers: []*rpc.Transfer{{
+				From:   testAccountHash(signer),
+				To:     &recipientHash,
+				Source: signerPurse,
+				Target: recipientPurse,
+				Amount: "30",
+			}},
+			want: [][]op{{
+				{FeeOpType, testAccountHash(signer), "-100"},
+				{TransferOpType, testAccountHash(signer), "-30"},
+				{TransferOpType, recipientHash, "30"},
+				{FeeOpType, testAccountHash(proposer), "100"},
+			}},
+		},
+		"balances written by a previous deploy": {
+			transforms: [][]rpc.TransformEntry{
+				{
+					writeBalanceTransform(signerPurse, "900"),
+					addBalanceTransform(proposerPurse, "100"),
+				},
+				{
+					writeBalanceTransform(signerPurse, "850"),
+					addBalanceTransform(proposerPurse, "50"),
+				},
+			},
+			want: [][]op{
+				{
+					{FeeOpType, testAccountHash(signer), "-100"},
+					{FeeOpType, testAccountHash(proposer), "100"},
+				},
+				{
+					{FeeOpType, testAccountHash(signer), "-50"},
+					{FeeOpType, testAccountHash(proposer), "50"},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			parent := testBlock(9, "1.4.0", proposer)
+			block := testBlock(10, "1.4.0", proposer)
+
+			node := newFakeNode()
+			node.addBlock(parent)
+			node.addBlock(block)
+			for publicKey, purse := range map[string]string{
+				proposer:  proposerPurse,
+				signer:    signerPurse,
+				recipient: recipientPurse,
+			} {
+				node.addAccount(block.Header.StateRootHash, publicKey, purse)
+
+				// Balances are read at the parent state, the
+				// balances after the block must not be used.
+				node.setBalance(parent.Header.StateRootHash, purse, 1000)
+				node.setBalance(block.Header.StateRootHash, purse, 1)
+			}
+
+			hashes := []string{}
+			for i, transforms := range test.transforms {
+				outcome := &rpc.ExecutionOutcome{
+					Effect: rpc.ExecutionEffect{Transforms: transforms},
+					Cost:   "100",
+				}
+				for j, transfer := range test.transfers {
+					key := fmt.Sprintf("transfer-%s", testHash(byte(0xe0+j)))
+					node.setItem(block.Header.StateRootHash, key, &rpc.StoredValue{Transfer: transfer})
+					outcome.Transfers = append(outcome.Transfers, key)
+				}
+
+				hash := testHash(byte(i + 1))
+				node.addDeploy(transferDeploy(hash, signer), block, rpc.ExecutionResult{Success: outcome})
+				hashes = append(hashes, deployHash(byte(i+1)))
+			}
+
+			client := newTestClient(t, node, &ClientOptions{OperationBuilder: EffectsOperationBuilder})
+			deploys, err := client.fetchTransactions(context.Background(), hashes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			purses, err := client.indexBlockPurses(context.Background(), block, deploys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			transactions, err := client.createEffectsTransactions(context.Background(), deploys, block, proposerPurse, purses)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([][]op, len(transactions))
+			for i, transaction := range transactions {
+				got[i] = []op{}
+				for _, operation := range transaction.Operations {
+					got[i] = append(got[i], op{operation.Type, operation.Account.Address, operation.Amount.Value})
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
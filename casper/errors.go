@@ -22,4 +22,29 @@ var (
 	ErrCallParametersInvalid = errors.New("call parameters invalid")
 	ErrCallOutputMarshal     = errors.New("call output marshal")
 	ErrCallMethodInvalid     = errors.New("call method invalid")
+
+	// ErrExecutionResultNotFound is returned when a transaction
+	// has no execution result recorded against a block.
+	ErrExecutionResultNotFound = errors.New("execution result not found")
+
+	// ErrInvalidSignature is returned when a signature does
+	// not match its message and public key.
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrBlockNotFinalized is returned when the finality
+	// signatures of a block do not reach the threshold.
+	ErrBlockNotFinalized = errors.New("block not finalized")
+
+	// ErrTransactionNotInBlock is returned when a transaction
+	// was not executed in the requested block.
+	ErrTransactionNotInBlock = errors.New("transaction not in block")
+
+	// ErrGenesisAccountsUnavailable is returned when the genesis
+	// accounts are neither in the genesis accounts file nor in
+	// the chainspec served by the node.
+	ErrGenesisAccountsUnavailable = errors.New("genesis accounts unavailable")
+
+	// ErrAmbiguousFee is returned when the effects of a
+	// transaction do not tell which purses paid its fee.
+	ErrAmbiguousFee = errors.New("ambiguous fee")
 )
@@ -0,0 +1,266 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// feeRecipient is a purse credited with
+// (a part of) the fee of a deploy.
+type feeRecipient struct {
+	purse  string
+	amount *big.Int
+}
+
+// deployFee is the fee of a deploy, paid by the payer
+// purse to the recipient purses. The burned part of the
+// fee is paid to no purse.
+type deployFee struct {
+	payer      string
+	recipients []feeRecipient
+	burned     *big.Int
+}
+
+// amount returns the total fee.
+func (f *deployFee) amount() *big.Int {
+	amount := new(big.Int)
+	if f.burned != nil {
+		amount.Add(amount, f.burned)
+	}
+	for _, recipient := range f.recipients {
+		amount.Add(amount, recipient.amount)
+	}
+
+	return amount
+}
+
+// purses returns the payer and recipient purses.
+func (f *deployFee) purses() []string {
+	purses := []string{f.payer}
+	for _, recipient := range f.recipients {
+		purses = append(purses, recipient.purse)
+	}
+
+	return purses
+}
+
+// operations returns the FEE operations debiting the payer
+// and crediting each recipient, attributed to their owners.
+func (f *deployFee) operations(owners *purseOwners) []*RosettaTypes.Operation {
+	operations := []*RosettaTypes.Operation{
+		{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: 0,
+			},
+			Type:    FeeOpType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: owners.account(f.payer),
+			Amount: &RosettaTypes.Amount{
+				Value:    new(big.Int).Neg(f.amount()).String(),
+				Currency: Currency,
+			},
+		},
+	}
+
+	for _, recipient := range f.recipients {
+		operations = append(operations, &RosettaTypes.Operation{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: int64(len(operations)),
+			},
+			RelatedOperations: []*RosettaTypes.OperationIdentifier{
+				{
+					Index: 0,
+				},
+			},
+			Type:    FeeOpType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: owners.account(recipient.purse),
+			Amount: &RosettaTypes.Amount{
+				Value:    recipient.amount.String(),
+				Currency: Currency,
+			},
+		})
+	}
+
+	return operations
+}
+
+// feeFromEffects returns the fee of a deploy as recorded by the
+// balance transforms of its execution outcome, or nil if they do
+// not show one.
+//
+// The mint credits purses with AddUInt512 transforms and writes the
+// new balance of debited purses. The payment purse of the handle
+// payment contract is emptied at the end of the execution: credits
+// not explained by a transfer record are the fee it pays out, to
+// the proposer or to the accumulation purse depending on the fee
+// handling, or the refund of the payer. What the payment purse
+// received and did not pay out is burned. The payer is the purse
+// written without being the source of a transfer record, the
+// signer main purse if there is none.
+//
+// Protocol versions 1.x record a single transform per key while
+// 2.x record each of them. ErrAmbiguousFee is returned rather
+// than guessing if several purses may be the payer or the
+// payment purse.
+func feeFromEffects(
+	outcome *rpc.ExecutionOutcome,
+	transfers []*rpc.Transfer,
+	signerMainPurse string,
+) (*deployFee, error) {
+	explained := map[string]*big.Int{}
+	sources := map[string]bool{}
+	for _, transfer := range transfers {
+		amount, ok := new(big.Int).SetString(transfer.Amount, 10) // nolint:gomnd
+		if !ok {
+			return nil, fmt.Errorf("invalid transfer amount %s", transfer.Amount)
+		}
+
+		target := purseAddress(transfer.Target)
+		if _, ok := explained[target]; !ok {
+			explained[target] = new(big.Int)
+		}
+		explained[target].Add(explained[target], amount)
+		sources[purseAddress(transfer.Source)] = true
+	}
+
+	purses := []string{}
+	credits := map[string]*big.Int{}
+	received := map[string]*big.Int{}
+	written := map[string]bool{}
+	emptied := map[string]bool{}
+	for _, entry := range outcome.Effect.Transforms {
+		if !isBalanceKey(entry.Key) {
+			continue
+		}
+
+		added, value, ok, err := balanceTransform(entry.Transform)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid transform of %s", err, entry.Key)
+		}
+		if !ok {
+			continue
+		}
+
+		purse := purseAddress(balanceKeyPurse(entry.Key))
+		if _, found := credits[purse]; !found {
+			purses = append(purses, purse)
+			credits[purse] = new(big.Int)
+			received[purse] = new(big.Int)
+		}
+
+		if value != nil {
+			if sources[purse] {
+				continue
+			}
+			if value.Sign() == 0 {
+				emptied[purse] = true
+			} else {
+				written[purse] = true
+			}
+			continue
+		}
+
+		received[purse].Add(received[purse], added)
+		if amount, ok := explained[purse]; ok {
+			used := amount
+			if used.Cmp(added) > 0 {
+				used = added
+			}
+			added = new(big.Int).Sub(added, used)
+			amount.Sub(amount, used)
+		}
+		credits[purse].Add(credits[purse], added)
+	}
+
+	// The purse emptied by the execution is
+	// the payment purse, not the payer.
+	payers := []string{}
+	paymentPurses := []string{}
+	for _, purse := range purses {
+		switch {
+		case emptied[purse]:
+			paymentPurses = append(paymentPurses, purse)
+		case written[purse]:
+			payers = append(payers, purse)
+		}
+	}
+	if len(payers) > 1 {
+		return nil, fmt.Errorf("%w: purses %s may all pay the fee", ErrAmbiguousFee, strings.Join(payers, ", "))
+	}
+	if len(paymentPurses) > 1 {
+		return nil, fmt.Errorf(
+			"%w: purses %s may all be the payment purse",
+			ErrAmbiguousFee,
+			strings.Join(paymentPurses, ", "),
+		)
+	}
+
+	fee := &deployFee{payer: purseAddress(PurseWithoutIndex(signerMainPurse))}
+	if len(payers) == 1 {
+		fee.payer = payers[0]
+	}
+
+	paidOut := new(big.Int)
+	for _, purse := range purses {
+		if credits[purse].Sign() <= 0 || emptied[purse] {
+			continue
+		}
+
+		// Refunds are paid back to the payer.
+		paidOut.Add(paidOut, credits[purse])
+		if purse == fee.payer {
+			continue
+		}
+
+		fee.recipients = append(fee.recipients, feeRecipient{purse: purse, amount: credits[purse]})
+	}
+
+	// Payment purses are credited by separate transforms
+	// since protocol versions 2.x only.
+	if len(paymentPurses) == 1 {
+		if burned := new(big.Int).Sub(received[paymentPurses[0]], paidOut); burned.Sign() > 0 {
+			fee.burned = burned
+		}
+	}
+	if len(fee.recipients) == 0 && fee.burned == nil {
+		return nil, nil
+	}
+
+	return fee, nil
+}
+
+// estimatedFee returns the fee of a deploy whose effects do not
+// show one: amount is paid by the signer to the proposer.
+func estimatedFee(amount string, signerMainPurse string, validatorMainPurse string) (*deployFee, error) {
+	value, ok := new(big.Int).SetString(amount, 10) // nolint:gomnd
+	if !ok {
+		return nil, fmt.Errorf("invalid fee amount %s", amount)
+	}
+
+	return &deployFee{
+		payer: PurseWithoutIndex(signerMainPurse),
+		recipients: []feeRecipient{
+			{purse: PurseWithoutIndex(validatorMainPurse), amount: value},
+		},
+	}, nil
+}
@@ -0,0 +1,490 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// Execution results as returned by info_get_deploy. {S} is the
+// signer main purse, {P} the payment purse, {V} the proposer main
+// purse, {A} the accumulation purse and {T} a transfer target.
+const (
+	// A 1.x node records a single transform per key.
+	v1PayToProposerResult = `{
+  "execution_results": [{
+    "block_hash": "{BLOCK}",
+    "result": {"Success": {
+      "effect": {"operations": [], "transforms": [
+        {"key": "hash-{HASH}", "transform": "Identity"},
+        {"key": "balance-{S}", "transform": {"WriteCLValue": {"cl_type": "U512", "bytes": "", "parsed": "9900"}}},
+        {"key": "balance-{P}", "transform": {"WriteCLValue": {"cl_type": "U512", "bytes": "00", "parsed": "0"}}},
+        {"key": "balance-{V}", "transform": {"AddUInt512": "100"}}
+      ]},
+      "transfers": [],
+      "cost": "100"
+    }}
+  }]
+}`
+
+	v1FailureResult = `{
+  "execution_results": [{
+    "block_hash": "{BLOCK}",
+    "result": {"Failure": {
+      "effect": {"operations": [], "transforms": [
+        {"key": "balance-{S}", "transform": {"WriteCLValue": {"cl_type": "U512", "bytes": "", "parsed": "9900"}}},
+        {"key": "balance-{P}", "transform": {"WriteCLValue": {"cl_type": "U512", "bytes": "00", "parsed": "0"}}},
+        {"key": "balance-{V}", "transform": {"AddUInt512": "100"}}
+      ]},
+      "transfers": [],
+      "cost": "100",
+      "error_message": "User error: 1"
+    }}
+  }]
+}`
+
+	// A 2.x node records every transform, in execution order.
+	v2PayToProposerResult = `{
+  "execution_info": {
+    "block_hash": "{BLOCK}",
+    "block_height": 10,
+    "execution_result": {"Version2": {
+      "initiator": {"PublicKey": "{SIGNER}"},
+      "error_message": null,
+      "limit": "200",
+      "consumed": "150",
+      "cost": "150",
+      "transfers": [],
+      "effects": [
+        {"key": "balance-{S}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "9800"}}}},
+        {"key": "balance-{P}", "kind": {"AddUInt512": "200"}},
+        {"key": "balance-{P}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "00", "parsed": "0"}}}},
+        {"key": "balance-{V}", "kind": {"AddUInt512": "150"}},
+        {"key": "balance-{S}", "kind": {"AddUInt512": "50"}}
+      ]
+    }}
+  }
+}`
+
+	v2AccumulateResult = `{
+  "execution_info": {
+    "block_hash": "{BLOCK}",
+    "block_height": 10,
+    "execution_result": {"Version2": {
+      "initiator": {"PublicKey": "{SIGNER}"},
+      "error_message": null,
+      "limit": "200",
+      "consumed": "200",
+      "cost": "200",
+      "transfers": [],
+      "effects": [
+        {"key": "balance-{S}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "9800"}}}},
+        {"key": "balance-{P}", "kind": {"AddUInt512": "200"}},
+        {"key": "balance-{P}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "00", "parsed": "0"}}}},
+        {"key": "balance-{A}", "kind": {"AddUInt512": "200"}}
+      ]
+    }}
+  }
+}`
+
+	v2BurnResult = `{
+  "execution_info": {
+    "block_hash": "{BLOCK}",
+    "block_height": 10,
+    "execution_result": {"Version2": {
+      "initiator": {"PublicKey": "{SIGNER}"},
+      "error_message": null,
+      "limit": "200",
+      "consumed": "150",
+      "cost": "150",
+      "transfers": [],
+      "effects": [
+        {"key": "balance-{S}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "9800"}}}},
+        {"key": "balance-{P}", "kind": {"AddUInt512": "200"}},
+        {"key": "balance-{P}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "00", "parsed": "0"}}}},
+        {"key": "balance-{S}", "kind": {"AddUInt512": "50"}},
+        {"key": "uref-{HASH}-007", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "999850"}}}}
+      ]
+    }}
+  }
+}`
+
+	v2NoFeeResult = `{
+  "execution_info": {
+    "block_hash": "{BLOCK}",
+    "block_height": 10,
+    "execution_result": {"Version2": {
+      "initiator": {"PublicKey": "{SIGNER}"},
+      "error_message": null,
+      "limit": "200",
+      "consumed": "150",
+      "cost": "150",
+      "transfers": [],
+      "effects": [
+        {"key": "balance-hold-00{S}8f0b2ca991010000", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "200"}}}}
+      ]
+    }}
+  }
+}`
+
+	v2TransferResult = `{
+  "execution_info": {
+    "block_hash": "{BLOCK}",
+    "block_height": 10,
+    "execution_result": {"Version2": {
+      "initiator": {"PublicKey": "{SIGNER}"},
+      "error_message": null,
+      "limit": "100",
+      "consumed": "100",
+      "cost": "100",
+      "transfers": [{"Version2": {
+        "transaction_hash": {"Deploy": "{HASH}"},
+        "from": {"AccountHash": "{SIGNER_HASH}"},
+        "to": null,
+        "source": "uref-{S}-007",
+        "target": "uref-{T}-004",
+        "amount": "1000",
+        "gas": "0",
+        "id": null
+      }}],
+      "effects": [
+        {"key": "balance-{S}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "9900"}}}},
+        {"key": "balance-{P}", "kind": {"AddUInt512": "100"}},
+        {"key": "balance-{S}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "8900"}}}},
+        {"key": "balance-{T}", "kind": {"AddUInt512": "1000"}},
+        {"key": "balance-{P}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "00", "parsed": "0"}}}},
+        {"key": "balance-{V}", "kind": {"AddUInt512": "100"}}
+      ]
+    }}
+  }
+}`
+
+	// The purses {S} and {T} are both debited without a transfer.
+	ambiguousPayerResult = `{
+  "execution_info": {
+    "block_hash": "{BLOCK}",
+    "block_height": 10,
+    "execution_result": {"Version2": {
+      "initiator": {"PublicKey": "{SIGNER}"},
+      "error_message": null,
+      "limit": "100",
+      "consumed": "100",
+      "cost": "100",
+      "transfers": [],
+      "effects": [
+        {"key": "balance-{S}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "9950"}}}},
+        {"key": "balance-{T}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "950"}}}},
+        {"key": "balance-{P}", "kind": {"AddUInt512": "100"}},
+        {"key": "balance-{P}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "00", "parsed": "0"}}}},
+        {"key": "balance-{V}", "kind": {"AddUInt512": "100"}}
+      ]
+    }}
+  }
+}`
+
+	// The purses {P} and {T} are both emptied.
+	ambiguousPaymentPurseResult = `{
+  "execution_info": {
+    "block_hash": "{BLOCK}",
+    "block_height": 10,
+    "execution_result": {"Version2": {
+      "initiator": {"PublicKey": "{SIGNER}"},
+      "error_message": null,
+      "limit": "100",
+      "consumed": "100",
+      "cost": "100",
+      "transfers": [],
+      "effects": [
+        {"key": "balance-{S}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "", "parsed": "9900"}}}},
+        {"key": "balance-{P}", "kind": {"AddUInt512": "100"}},
+        {"key": "balance-{P}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "00", "parsed": "0"}}}},
+        {"key": "balance-{T}", "kind": {"Write": {"CLValue": {"cl_type": "U512", "bytes": "00", "parsed": "0"}}}},
+        {"key": "balance-{V}", "kind": {"AddUInt512": "100"}}
+      ]
+    }}
+  }
+}`
+)
+
+// bigInt returns the integer represented by value.
+func bigInt(value string) *big.Int {
+	integer, ok := new(big.Int).SetString(value, 10) // nolint:gomnd
+	if !ok {
+		panic("invalid integer " + value)
+	}
+
+	return integer
+}
+
+func TestFeeFromEffects(t *testing.T) {
+	signer := testPublicKey(0xa1)
+	signerPurse := testPurse(0xc1)
+	proposerPurse := testPurse(0xc0)
+	accumulationPurse := testPurse(0xd1)
+
+	fixture := strings.NewReplacer(
+		"{BLOCK}", testHash(0xb0),
+		"{HASH}", testHash(0xe0),
+		"{SIGNER}", signer,
+		"{SIGNER_HASH}", testAccountHash(signer),
+		"{S}", testHash(0xc1),
+		"{P}", testHash(0xd0),
+		"{V}", testHash(0xc0),
+		"{A}", testHash(0xd1),
+		"{T}", testHash(0xc2),
+	)
+	purse := func(purse string) string {
+		return PurseWithoutIndex(purse)
+	}
+
+	tests := map[string]struct {
+		result string
+		want   *deployFee
+		err    error
+	}{
+		"1.x pay to proposer": {
+			result: v1PayToProposerResult,
+			want: &deployFee{
+				payer:      purse(signerPurse),
+				recipients: []feeRecipient{{purse: purse(proposerPurse), amount: bigInt("100")}},
+			},
+		},
+		"1.x failure": {
+			result: v1FailureResult,
+			want: &deployFee{
+				payer:      purse(signerPurse),
+				recipients: []feeRecipient{{purse: purse(proposerPurse), amount: bigInt("100")}},
+			},
+		},
+		"2.x pay to proposer with refund": {
+			result: v2PayToProposerResult,
+			want: &deployFee{
+				payer:      purse(signerPurse),
+				recipients: []feeRecipient{{purse: purse(proposerPurse), amount: bigInt("150")}},
+			},
+		},
+		"2.x accumulate": {
+			result: v2AccumulateResult,
+			want: &deployFee{
+				payer:      purse(signerPurse),
+				recipients: []feeRecipient{{purse: purse(accumulationPurse), amount: bigInt("200")}},
+			},
+		},
+		"2.x burn with refund": {
+			result: v2BurnResult,
+			want: &deployFee{
+				payer:  purse(signerPurse),
+				burned: bigInt("150"),
+			},
+		},
+		"2.x no fee with gas hold": {
+			result: v2NoFeeResult,
+		},
+		"2.x transfer": {
+			result: v2TransferResult,
+			want: &deployFee{
+				payer:      purse(signerPurse),
+				recipients: []feeRecipient{{purse: purse(proposerPurse), amount: bigInt("100")}},
+			},
+		},
+		"ambiguous payer": {
+			result: ambiguousPayerResult,
+			err:    ErrAmbiguousFee,
+		},
+		"ambiguous payment purse": {
+			result: ambiguousPaymentPurseResult,
+			err:    ErrAmbiguousFee,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var result rpc.DeployResult
+			if err := json.Unmarshal([]byte(fixture.Replace(test.result)), &result); err != nil {
+				t.Fatal(err)
+			}
+			if len(result.ExecutionResults) != 1 {
+				t.Fatalf("%d execution results, want 1", len(result.ExecutionResults))
+			}
+			outcome, err := result.ExecutionResults[0].Result.Outcome()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fee, err := feeFromEffects(outcome, outcome.TransferRecords, signerPurse)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fee, test.want) {
+				t.Fatalf("fee %+v, want %+v", fee, test.want)
+			}
+		})
+	}
+}
+
+func TestPaymentAmount(t *testing.T) {
+	tests := map[string]struct {
+		payment rpc.ExecutableDeployItem
+		want    string
+		err     bool
+	}{
+		"standard payment": {
+			payment: standardPayment("100000000"),
+			want:    "100000000",
+		},
+		"standard payment without amount": {
+			payment: rpc.ExecutableDeployItem{ModuleBytes: &rpc.ModuleBytes{
+				Args: rpc.RuntimeArgs{{Name: "gas", Value: stringValue("1")}},
+			}},
+			want: "0",
+		},
+		"custom payment": {
+			payment: rpc.ExecutableDeployItem{ModuleBytes: &rpc.ModuleBytes{
+				ModuleBytes: "0061736d01000000",
+				Args:        rpc.RuntimeArgs{{Name: "amount", Value: rpc.CLValue{Parsed: json.RawMessage(`12`)}}},
+			}},
+			want: "0",
+		},
+		"stored payment": {
+			payment: rpc.ExecutableDeployItem{StoredContractByName: &rpc.StoredContract{Name: "payment"}},
+			want:    "0",
+		},
+		"invalid standard payment amount": {
+			payment: rpc.ExecutableDeployItem{ModuleBytes: &rpc.ModuleBytes{
+				Args: rpc.RuntimeArgs{{Name: "amount", Value: rpc.CLValue{Parsed: json.RawMessage(`12`)}}},
+			}},
+			err: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deploy := transferDeploy(testHash(1), testPublicKey(0xa1))
+			deploy.Payment = test.payment
+
+			got, err := (&executedTransaction{deploy: &deploy}).paymentAmount()
+			if test.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEstimatedFeePaymentAmount(t *testing.T) {
+	proposer, signer := testPublicKey(0xa0), testPublicKey(0xa1)
+	customPayment := rpc.ExecutableDeployItem{ModuleBytes: &rpc.ModuleBytes{
+		ModuleBytes: "0061736d01000000",
+		Args:        rpc.RuntimeArgs{{Name: "gas", Value: stringValue("1")}},
+	}}
+	invalidPayment := rpc.ExecutableDeployItem{ModuleBytes: &rpc.ModuleBytes{
+		Args: rpc.RuntimeArgs{{Name: "amount", Value: rpc.CLValue{Parsed: json.RawMessage(`12`)}}},
+	}}
+
+	tests := map[string]struct {
+		payment rpc.ExecutableDeployItem
+		result  rpc.ExecutionResult
+		want    string
+		err     bool
+	}{
+		"standard payment": {
+			payment: standardPayment("100000000"),
+			result:  rpc.ExecutionResult{Success: &rpc.ExecutionOutcome{Cost: "2500"}},
+			want:    "100000000",
+		},
+		"custom payment without amount": {
+			payment: customPayment,
+			result:  rpc.ExecutionResult{Success: &rpc.ExecutionOutcome{Cost: "2500"}},
+			want:    "2500",
+		},
+		"failed deploy with invalid payment amount": {
+			payment: invalidPayment,
+			result:  rpc.ExecutionResult{Failure: &rpc.ExecutionOutcome{Cost: "2500", ErrorMessage: "Out of gas"}},
+			want:    "2500",
+		},
+		"invalid payment amount": {
+			payment: invalidPayment,
+			result:  rpc.ExecutionResult{Success: &rpc.ExecutionOutcome{Cost: "2500"}},
+			err:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			block := testBlock(10, "1.4.0", proposer)
+			block.Body.DeployHashes = []string{testHash(1)}
+			deploy := transferDeploy(testHash(1), signer)
+			deploy.Payment = test.payment
+
+			node := newFakeNode()
+			node.addBlock(testBlock(9, "1.4.0", proposer))
+			node.addBlock(block)
+			node.addAccount(block.Header.StateRootHash, proposer, testPurse(0xc0))
+			node.addAccount(block.Header.StateRootHash, signer, testPurse(0xc1))
+			node.addDeploy(deploy, block, test.result)
+
+			client := newTestClient(t, node, nil)
+			transaction, err := client.BlockTransaction(
+				context.Background(),
+				&RosettaTypes.BlockIdentifier{Index: int64(block.Header.Height), Hash: block.Hash},
+				&RosettaTypes.TransactionIdentifier{Hash: deployHash(0x01)},
+			)
+			if test.err {
+				var typeErr *json.UnmarshalTypeError
+				if !errors.As(err, &typeErr) {
+					t.Fatalf("error %v, want the payment amount decoding error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fees := []string{}
+			for _, operation := range transaction.Operations {
+				if operation.Type == FeeOpType {
+					fees = append(fees, operation.Amount.Value)
+				}
+			}
+			if want := []string{"-" + test.want, test.want}; !reflect.DeepEqual(fees, want) {
+				t.Fatalf("fees %v, want %v", fees, want)
+			}
+		})
+	}
+}
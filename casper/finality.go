@@ -0,0 +1,338 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// LatestBlockMode serves the latest block added by the node.
+	LatestBlockMode = "latest"
+
+	// FinalizedBlockMode only serves the blocks whose finality
+	// signatures reach the finality threshold.
+	FinalizedBlockMode = "finalized"
+
+	// maxFinalityLookback is the number of blocks walked back
+	// from the latest block to find a finalized block.
+	maxFinalityLookback = 100
+
+	// maxSignedBlocks is the number of blocks whose
+	// streamed finality signatures are kept.
+	maxSignedBlocks = 1024
+)
+
+// FinalityModes are the supported finality modes.
+var FinalityModes = []string{
+	LatestBlockMode,
+	FinalizedBlockMode,
+}
+
+// DefaultFinalityThreshold is the share of the era validator
+// weight that must sign a block for it to be finalized.
+var DefaultFinalityThreshold = big.NewRat(2, 3) // nolint:gomnd
+
+// finalityTracker holds the finality signatures streamed by
+// the node, the validator weights of the recent eras and the
+// highest block known to be finalized.
+type finalityTracker struct {
+	mode      string
+	threshold *big.Rat
+	eventsURL string
+
+	mu            sync.Mutex
+	signatures    map[string]map[string]string
+	signedBlocks  []string
+	eraWeights    map[uint64]map[string]*big.Int
+	lastFinalized *rpc.Block
+	chainNameHash []byte
+}
+
+func newFinalityTracker(mode string, threshold *big.Rat, eventsURL string) *finalityTracker {
+	if len(mode) == 0 {
+		mode = LatestBlockMode
+	}
+	if threshold == nil {
+		threshold = DefaultFinalityThreshold
+	}
+
+	return &finalityTracker{
+		mode:       mode,
+		threshold:  threshold,
+		eventsURL:  eventsURL,
+		signatures: map[string]map[string]string{},
+		eraWeights: map[uint64]map[string]*big.Int{},
+	}
+}
+
+// addSignature records a streamed finality signature. The
+// signatures of the oldest blocks are dropped once more
+// than maxSignedBlocks blocks are tracked.
+func (t *finalityTracker) addSignature(signature *rpc.FinalitySignature) {
+	publicKey, err := address.ParsePublicKey(signature.PublicKey)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	blockSignatures, ok := t.signatures[signature.BlockHash]
+	if !ok {
+		blockSignatures = map[string]string{}
+		t.signatures[signature.BlockHash] = blockSignatures
+		t.signedBlocks = append(t.signedBlocks, signature.BlockHash)
+		if len(t.signedBlocks) > maxSignedBlocks {
+			delete(t.signatures, t.signedBlocks[0])
+			t.signedBlocks = t.signedBlocks[1:]
+		}
+	}
+	blockSignatures[publicKey.String()] = signature.Signature
+}
+
+// blockSignatures returns the finality signatures of block,
+// from its proofs and from the event stream, by public key.
+func (t *finalityTracker) blockSignatures(block *rpc.Block) map[string]string {
+	signatures := map[string]string{}
+	for _, proof := range block.Proofs {
+		publicKey, err := address.ParsePublicKey(proof.PublicKey)
+		if err != nil {
+			continue
+		}
+		signatures[publicKey.String()] = proof.Signature
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for publicKey, signature := range t.signatures[block.Hash] {
+		if _, ok := signatures[publicKey]; !ok {
+			signatures[publicKey] = signature
+		}
+	}
+
+	return signatures
+}
+
+// finalized returns the highest block known to be finalized.
+func (t *finalityTracker) finalized() *rpc.Block {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.lastFinalized
+}
+
+// setFinalized records block as finalized
+// if it is the highest finalized block.
+func (t *finalityTracker) setFinalized(block *rpc.Block) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.lastFinalized == nil || block.Header.Height > t.lastFinalized.Header.Height {
+		t.lastFinalized = block
+	}
+}
+
+// StreamFinalitySignatures records the finality signatures streamed
+// by the node event stream, if any, until ctx is done.
+func (ec *Client) StreamFinalitySignatures(ctx context.Context) error {
+	if len(ec.finality.eventsURL) == 0 {
+		return nil
+	}
+
+	return rpc.StreamFinalitySignatures(ctx, ec.finality.eventsURL, ec.finality.addSignature)
+}
+
+// chainNameHash returns the blake2b hash of
+// the chain name, read from the node once.
+func (ec *Client) chainNameHash(ctx context.Context) ([]byte, error) {
+	ec.finality.mu.Lock()
+	chainNameHash := ec.finality.chainNameHash
+	ec.finality.mu.Unlock()
+	if chainNameHash != nil {
+		return chainNameHash, nil
+	}
+
+	status, err := ec.node.GetStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get chain name", err)
+	}
+	hash := blake2b.Sum256([]byte(status.ChainspecName))
+
+	ec.finality.mu.Lock()
+	ec.finality.chainNameHash = hash[:]
+	ec.finality.mu.Unlock()
+
+	return hash[:], nil
+}
+
+// eraValidatorWeights returns the weights of the validators
+// of the era of block, by public key.
+func (ec *Client) eraValidatorWeights(ctx context.Context, block *rpc.Block) (map[string]*big.Int, error) {
+	eraID := block.Header.EraID
+	ec.finality.mu.Lock()
+	weights, ok := ec.finality.eraWeights[eraID]
+	ec.finality.mu.Unlock()
+	if ok {
+		return weights, nil
+	}
+
+	auctionState, err := ec.node.GetAuctionInfo(ctx, rpc.BlockByHash(block.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get validators of era %d", err, eraID)
+	}
+
+	for _, eraValidators := range auctionState.EraValidators {
+		if eraValidators.EraID != eraID {
+			continue
+		}
+
+		weights = map[string]*big.Int{}
+		for _, validator := range eraValidators.ValidatorWeights {
+			publicKey, err := address.ParsePublicKey(validator.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			weight, ok := new(big.Int).SetString(validator.Weight, 10) // nolint:gomnd
+			if !ok {
+				return nil, fmt.Errorf("invalid weight %s of validator %s", validator.Weight, validator.PublicKey)
+			}
+			weights[publicKey.String()] = weight
+		}
+
+		ec.finality.mu.Lock()
+		ec.finality.eraWeights[eraID] = weights
+		ec.finality.mu.Unlock()
+
+		return weights, nil
+	}
+
+	return nil, fmt.Errorf("no validators for era %d at block %s", eraID, block.Hash)
+}
+
+// blockFinalized returns true if the valid finality signatures of
+// block reach the finality threshold of the era validator weight.
+func (ec *Client) blockFinalized(ctx context.Context, block *rpc.Block) (bool, error) {
+	strategy, err := strategyFor(block.Header.ProtocolVersion)
+	if err != nil {
+		return false, err
+	}
+
+	message, err := strategy.finalitySignatureMessage(ctx, ec, block)
+	if err != nil {
+		return false, err
+	}
+
+	weights, err := ec.eraValidatorWeights(ctx, block)
+	if err != nil {
+		return false, err
+	}
+
+	total := new(big.Int)
+	for _, weight := range weights {
+		total.Add(total, weight)
+	}
+	if total.Sign() == 0 {
+		return false, nil
+	}
+
+	signed := new(big.Int)
+	for publicKey, signature := range ec.finality.blockSignatures(block) {
+		weight, ok := weights[publicKey]
+		if !ok {
+			continue
+		}
+		if err := VerifySignature(publicKey, signature, message); err != nil {
+			log.Printf("invalid finality signature of %s for block %s: %s", publicKey, block.Hash, err.Error())
+			continue
+		}
+		signed.Add(signed, weight)
+	}
+
+	return new(big.Rat).SetFrac(signed, total).Cmp(ec.finality.threshold) >= 0, nil
+}
+
+// checkFinalized returns ErrBlockNotFinalized if block
+// must be finalized to be served and is not.
+func (ec *Client) checkFinalized(ctx context.Context, block *rpc.Block) error {
+	if ec.finality.mode != FinalizedBlockMode {
+		return nil
+	}
+
+	// Blocks below a finalized block are finalized.
+	if last := ec.finality.finalized(); last != nil && block.Header.Height <= last.Header.Height {
+		return nil
+	}
+
+	finalized, err := ec.blockFinalized(ctx, block)
+	if err != nil {
+		return fmt.Errorf("%w: could not check finality of block %s", err, block.Hash)
+	}
+	if !finalized {
+		return fmt.Errorf("%w: %s", ErrBlockNotFinalized, block.Hash)
+	}
+	ec.finality.setFinalized(block)
+
+	return nil
+}
+
+// latestBlock returns the latest block added by the node or,
+// in FinalizedBlockMode, the latest finalized block.
+func (ec *Client) latestBlock(ctx context.Context) (*rpc.Block, error) {
+	block, err := ec.node.GetBlock(ctx, nil)
+	if err != nil || ec.finality.mode != FinalizedBlockMode {
+		return block, err
+	}
+
+	last := ec.finality.finalized()
+	for i := 0; i < maxFinalityLookback; i++ {
+		if last != nil && block.Header.Height <= last.Header.Height {
+			return last, nil
+		}
+
+		finalized, err := ec.blockFinalized(ctx, block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not check finality of block %s", err, block.Hash)
+		}
+		if finalized {
+			ec.finality.setFinalized(block)
+			return block, nil
+		}
+		if block.Header.Height == 0 {
+			break
+		}
+
+		block, err = ec.node.GetBlock(ctx, rpc.BlockByHash(block.Header.ParentHash))
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not get parent block", err)
+		}
+	}
+
+	if last != nil {
+		return last, nil
+	}
+
+	return nil, fmt.Errorf("%w: no finalized block in the last %d blocks", ErrBlockNotFinalized, maxFinalityLookback)
+}
@@ -0,0 +1,209 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"golang.org/x/crypto/blake2b"
+)
+
+// signMessage signs a finality signature message. Secp256k1
+// keys sign its sha256 digest, ed25519 keys the message.
+func (s testSigner) signMessage(message []byte) string {
+	if s.publicKey.CurveType == RosettaTypes.Secp256k1 {
+		digest := sha256.Sum256(message)
+		return s.sign(digest[:])
+	}
+
+	return s.sign(message)
+}
+
+// v1FinalityMessage returns the block hash followed by the era id.
+func v1FinalityMessage(block *rpc.Block) []byte {
+	message, err := hex.DecodeString(block.Hash)
+	if err != nil {
+		panic(err)
+	}
+
+	return append(message, littleEndian(block.Header.EraID)...)
+}
+
+// v2FinalityMessage returns the block hash followed by the
+// height, the era id and the hash of the chain name.
+func v2FinalityMessage(block *rpc.Block, chainName string) []byte {
+	message, err := hex.DecodeString(block.Hash)
+	if err != nil {
+		panic(err)
+	}
+	chainNameHash := blake2b.Sum256([]byte(chainName))
+
+	message = append(message, littleEndian(block.Header.Height)...)
+	message = append(message, littleEndian(block.Header.EraID)...)
+
+	return append(message, chainNameHash[:]...)
+}
+
+func littleEndian(value uint64) []byte {
+	encoded := make([]byte, 8) // nolint:gomnd
+	binary.LittleEndian.PutUint64(encoded, value)
+
+	return encoded
+}
+
+func TestCheckFinalized(t *testing.T) {
+	const chainName = "casper-test"
+
+	// The validators weigh 40, 30 and 30, the
+	// fourth key is not a validator of the era.
+	signers := []testSigner{ed25519Signer(1), secp256k1Signer(2), ed25519Signer(3), secp256k1Signer(4)}
+	publicKeys := make([]string, len(signers))
+	for i, signer := range signers {
+		publicKey, err := PublicKeyHex(signer.publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKeys[i] = publicKey
+	}
+
+	v1, v2 := "1.4.0", "2.0.0"
+	v1Format := v1FinalityMessage
+	v2Format := func(block *rpc.Block) []byte { return v2FinalityMessage(block, chainName) }
+	otherBlock := func(block *rpc.Block) []byte {
+		other := *block
+		other.Hash = testHash(0xee)
+		return v1FinalityMessage(&other)
+	}
+
+	tests := map[string]struct {
+		protocolVersion string
+		mode            string
+		threshold       *big.Rat
+		proofs          map[int]func(*rpc.Block) []byte
+		streamed        map[int]func(*rpc.Block) []byte
+		finalized       bool
+	}{
+		"1.x signatures above the threshold": {
+			protocolVersion: v1,
+			proofs:          map[int]func(*rpc.Block) []byte{0: v1Format, 1: v1Format},
+			finalized:       true,
+		},
+		"1.x signatures below the threshold": {
+			protocolVersion: v1,
+			proofs:          map[int]func(*rpc.Block) []byte{0: v1Format},
+		},
+		"signatures reaching the threshold": {
+			protocolVersion: v1,
+			threshold:       big.NewRat(7, 10), // nolint:gomnd
+			proofs:          map[int]func(*rpc.Block) []byte{0: v1Format, 2: v1Format},
+			finalized:       true,
+		},
+		"invalid signature skipped": {
+			protocolVersion: v1,
+			proofs:          map[int]func(*rpc.Block) []byte{0: v1Format, 1: otherBlock},
+		},
+		"invalid signature skipped among valid ones": {
+			protocolVersion: v1,
+			proofs:          map[int]func(*rpc.Block) []byte{0: v1Format, 1: otherBlock, 2: v1Format},
+			finalized:       true,
+		},
+		"signature of a key out of the era": {
+			protocolVersion: v1,
+			proofs:          map[int]func(*rpc.Block) []byte{0: v1Format, 3: v1Format},
+		},
+		"streamed signatures": {
+			protocolVersion: v1,
+			proofs:          map[int]func(*rpc.Block) []byte{0: v1Format},
+			streamed:        map[int]func(*rpc.Block) []byte{1: v1Format},
+			finalized:       true,
+		},
+		"2.0 signatures": {
+			protocolVersion: v2,
+			proofs:          map[int]func(*rpc.Block) []byte{0: v2Format, 1: v2Format},
+			finalized:       true,
+		},
+		"1.x signatures of a 2.0 block": {
+			protocolVersion: v2,
+			proofs:          map[int]func(*rpc.Block) []byte{0: v1Format, 1: v1Format},
+		},
+		"2.0 signatures of a 1.x block": {
+			protocolVersion: v1,
+			proofs:          map[int]func(*rpc.Block) []byte{0: v2Format, 1: v2Format},
+		},
+		"latest block mode": {
+			protocolVersion: v1,
+			mode:            LatestBlockMode,
+			finalized:       true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			block := testBlock(10, test.protocolVersion, publicKeys[0])
+			block.Header.EraID = 3
+			for i, message := range test.proofs {
+				block.Proofs = append(block.Proofs, rpc.Proof{
+					PublicKey: publicKeys[i],
+					Signature: signers[i].signMessage(message(block)),
+				})
+			}
+
+			node := newFakeNode()
+			node.chainName = chainName
+			node.addBlock(block)
+			node.auctions[block.Hash] = &rpc.AuctionState{EraValidators: []rpc.EraValidators{{
+				EraID: 3,
+				ValidatorWeights: []rpc.AuctionValidatorWeight{
+					{PublicKey: publicKeys[0], Weight: "40"},
+					{PublicKey: publicKeys[1], Weight: "30"},
+					{PublicKey: publicKeys[2], Weight: "30"},
+				},
+			}}}
+
+			mode := test.mode
+			if len(mode) == 0 {
+				mode = FinalizedBlockMode
+			}
+			client := newTestClient(t, node, &ClientOptions{FinalityMode: mode, FinalityThreshold: test.threshold})
+			for i, message := range test.streamed {
+				client.finality.addSignature(&rpc.FinalitySignature{
+					BlockHash: block.Hash,
+					PublicKey: publicKeys[i],
+					Signature: signers[i].signMessage(message(block)),
+				})
+			}
+
+			err := client.checkFinalized(context.Background(), block)
+			if !test.finalized {
+				if !errors.Is(err, ErrBlockNotFinalized) {
+					t.Fatalf("error %v, want %v", err, ErrBlockNotFinalized)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
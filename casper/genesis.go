@@ -0,0 +1,227 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	"github.com/BurntSushi/toml"
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// genesisTransactionPrefix prefixes the hash of the synthetic
+// transaction holding the genesis allocations.
+const genesisTransactionPrefix = "genesis-"
+
+// GenesisTransactionHash returns the hash of the synthetic
+// transaction holding the allocations of the genesis block.
+func GenesisTransactionHash(blockHash string) string {
+	return genesisTransactionPrefix + blockHash
+}
+
+// isGenesisTransactionHash returns true if hash is the
+// hash of the synthetic genesis transaction.
+func isGenesisTransactionHash(hash string) bool {
+	return strings.HasPrefix(hash, genesisTransactionPrefix)
+}
+
+// genesisAccounts is the content of the accounts.toml
+// file of the chainspec.
+type genesisAccounts struct {
+	Accounts   []genesisAccount   `toml:"accounts"`
+	Delegators []genesisDelegator `toml:"delegators"`
+}
+
+// genesisAccount is an account funded at genesis,
+// bonded if it is a genesis validator.
+type genesisAccount struct {
+	PublicKey string            `toml:"public_key"`
+	Balance   string            `toml:"balance"`
+	Validator *genesisValidator `toml:"validator"`
+}
+
+// genesisValidator is the bond of a genesis validator.
+type genesisValidator struct {
+	BondedAmount   string `toml:"bonded_amount"`
+	DelegationRate uint8  `toml:"delegation_rate"`
+}
+
+// genesisDelegator is an account funded at genesis
+// and delegating to a genesis validator.
+type genesisDelegator struct {
+	ValidatorPublicKey string `toml:"validator_public_key"`
+	DelegatorPublicKey string `toml:"delegator_public_key"`
+	Balance            string `toml:"balance"`
+	DelegatedAmount    string `toml:"delegated_amount"`
+}
+
+// genesisAllocation is a credit of the genesis transaction,
+// on the main purse of publicKey if validator is empty or
+// on its stake with validator otherwise.
+type genesisAllocation struct {
+	publicKey string
+	validator string
+	amount    string
+}
+
+// loadGenesisAccounts reads the genesis accounts from the configured
+// accounts.toml file, or from the chainspec served by the node.
+func (ec *Client) loadGenesisAccounts(ctx context.Context) (*genesisAccounts, error) {
+	var content []byte
+	if len(ec.genesisAccountsFile) > 0 {
+		var err error
+		content, err = ioutil.ReadFile(ec.genesisAccountsFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to read genesis accounts file %s", err, ec.genesisAccountsFile)
+		}
+	} else {
+		chainspec, err := ec.node.GetChainspec(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not get chainspec", err)
+		}
+		if chainspec.MaybeGenesisAccountsBytes == nil {
+			// Nodes upgraded from an earlier protocol
+			// version no longer serve them.
+			return nil, fmt.Errorf(
+				"%w: the chainspec has no genesis accounts, configure a genesis accounts file",
+				ErrGenesisAccountsUnavailable,
+			)
+		}
+
+		content, err = hex.DecodeString(*chainspec.MaybeGenesisAccountsBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid genesis accounts", err)
+		}
+	}
+
+	accounts := &genesisAccounts{}
+	if err := toml.Unmarshal(content, accounts); err != nil {
+		return nil, fmt.Errorf("%w: unable to parse genesis accounts", err)
+	}
+	if len(accounts.Accounts) == 0 && len(accounts.Delegators) == 0 {
+		return nil, fmt.Errorf("%w: no genesis account found", ErrGenesisAccountsUnavailable)
+	}
+
+	return accounts, nil
+}
+
+// CheckGenesisAccounts returns an error if the genesis accounts
+// can not be loaded, so that a missing source is reported at
+// startup rather than when the genesis block is requested.
+func (ec *Client) CheckGenesisAccounts(ctx context.Context) error {
+	_, err := ec.loadGenesisAccounts(ctx)
+
+	return err
+}
+
+// allocations returns the non zero credits of the genesis accounts.
+func (accounts *genesisAccounts) allocations() []genesisAllocation {
+	allocations := []genesisAllocation{}
+	add := func(publicKey string, validator string, amount string) {
+		if len(amount) == 0 || strings.TrimLeft(amount, "0") == "" {
+			return
+		}
+		allocations = append(allocations, genesisAllocation{
+			publicKey: publicKey,
+			validator: validator,
+			amount:    amount,
+		})
+	}
+
+	for _, account := range accounts.Accounts {
+		add(account.PublicKey, "", account.Balance)
+		if account.Validator != nil {
+			add(account.PublicKey, account.PublicKey, account.Validator.BondedAmount)
+		}
+	}
+	for _, delegator := range accounts.Delegators {
+		add(delegator.DelegatorPublicKey, "", delegator.Balance)
+		add(delegator.DelegatorPublicKey, delegator.ValidatorPublicKey, delegator.DelegatedAmount)
+	}
+
+	return allocations
+}
+
+// createGenesisTransaction returns the synthetic transaction
+// crediting the genesis accounts, validator bonds and delegator
+// bonds, or nil if block is not the genesis block. The
+// transaction is built once and then cached.
+func (ec *Client) createGenesisTransaction(
+	ctx context.Context,
+	block *rpc.Block,
+) (*RosettaTypes.Transaction, error) {
+	if block.Header.Height != uint64(GenesisBlockIndex) {
+		return nil, nil
+	}
+
+	ec.genesisMu.Lock()
+	defer ec.genesisMu.Unlock()
+	if ec.genesisTransaction != nil {
+		return ec.genesisTransaction, nil
+	}
+
+	accounts, err := ec.loadGenesisAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	allocations := accounts.allocations()
+	operations := make([]*RosettaTypes.Operation, len(allocations))
+	for i, allocation := range allocations {
+		if _, ok := new(big.Int).SetString(allocation.amount, 10); !ok { // nolint:gomnd
+			return nil, fmt.Errorf("invalid genesis amount %s of %s", allocation.amount, allocation.publicKey)
+		}
+
+		hash, err := AccountHashFromPublicKey(allocation.publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid genesis account", err)
+		}
+
+		account := MainAccount(hash)
+		if len(allocation.validator) > 0 {
+			account = StakedAccount(allocation.publicKey, allocation.validator)
+		}
+
+		operations[i] = &RosettaTypes.Operation{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: int64(i),
+			},
+			Type:    GenesisOpType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: account,
+			Amount: &RosettaTypes.Amount{
+				Value:    allocation.amount,
+				Currency: Currency,
+			},
+		}
+	}
+
+	ec.genesisTransaction = &RosettaTypes.Transaction{
+		TransactionIdentifier: &RosettaTypes.TransactionIdentifier{
+			Hash: GenesisTransactionHash(block.Hash),
+		},
+		Operations: operations,
+		Metadata:   map[string]interface{}{},
+	}
+
+	return ec.genesisTransaction, nil
+}
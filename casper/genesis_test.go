@@ -0,0 +1,211 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// testGenesisAccounts returns an accounts.toml with a genesis
+// validator, an account and a delegator to the validator.
+func testGenesisAccounts() string {
+	return fmt.Sprintf(`
+[[accounts]]
+public_key = "%s"
+balance = "1000"
+
+[accounts.validator]
+bonded_amount = "500"
+delegation_rate = 10
+
+[[accounts]]
+public_key = "%s"
+balance = "2000"
+
+[[delegators]]
+validator_public_key = "%s"
+delegator_public_key = "%s"
+balance = "0"
+delegated_amount = "300"
+`, testPublicKey(0xa0), testPublicKey(0xa1), testPublicKey(0xa0), testPublicKey(0xa2))
+}
+
+// writeTempFile writes content to a file removed
+// at the end of the test and returns its path.
+func writeTempFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "genesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	path := filepath.Join(dir, "accounts.toml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil { // nolint:gomnd
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestCheckGenesisAccounts(t *testing.T) {
+	accounts := hex.EncodeToString([]byte(testGenesisAccounts()))
+	empty := ""
+
+	tests := map[string]struct {
+		file      string
+		chainspec *rpc.ChainspecRawBytes
+		err       error
+	}{
+		"file": {
+			file: testGenesisAccounts(),
+		},
+		"chainspec": {
+			chainspec: &rpc.ChainspecRawBytes{MaybeGenesisAccountsBytes: &accounts},
+		},
+		"upgraded node": {
+			chainspec: &rpc.ChainspecRawBytes{},
+			err:       ErrGenesisAccountsUnavailable,
+		},
+		"empty chainspec accounts": {
+			chainspec: &rpc.ChainspecRawBytes{MaybeGenesisAccountsBytes: &empty},
+			err:       ErrGenesisAccountsUnavailable,
+		},
+		"file without accounts": {
+			file: "[[validators]]\n",
+			err:  ErrGenesisAccountsUnavailable,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			node := newFakeNode()
+			node.chainspec = test.chainspec
+
+			opts := &ClientOptions{}
+			if len(test.file) > 0 {
+				opts.GenesisAccountsFile = writeTempFile(t, test.file)
+			}
+
+			client := newTestClient(t, node, opts)
+			err := client.CheckGenesisAccounts(context.Background())
+			if test.err == nil && err != nil {
+				t.Fatal(err)
+			}
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestGenesisTransaction(t *testing.T) {
+	validator := testPublicKey(0xa0)
+	node := newFakeNode()
+	genesis := testBlock(0, "1.0.0", "00")
+	node.addBlock(genesis)
+
+	client := newTestClient(t, node, &ClientOptions{GenesisAccountsFile: writeTempFile(t, testGenesisAccounts())})
+	transaction, err := client.createGenesisTransaction(context.Background(), genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transaction.TransactionIdentifier.Hash != GenesisTransactionHash(genesis.Hash) {
+		t.Fatalf("transaction hash %s", transaction.TransactionIdentifier.Hash)
+	}
+
+	want := []*RosettaTypes.AccountIdentifier{
+		MainAccount(testAccountHash(validator)),
+		StakedAccount(validator, validator),
+		MainAccount(testAccountHash(testPublicKey(0xa1))),
+		StakedAccount(testPublicKey(0xa2), validator),
+	}
+	wantAmounts := []string{"1000", "500", "2000", "300"}
+	accounts := []*RosettaTypes.AccountIdentifier{}
+	amounts := []string{}
+	for _, operation := range transaction.Operations {
+		if operation.Type != GenesisOpType {
+			t.Fatalf("operation type %s, want %s", operation.Type, GenesisOpType)
+		}
+		accounts = append(accounts, operation.Account)
+		amounts = append(amounts, operation.Amount.Value)
+	}
+	if !reflect.DeepEqual(accounts, want) {
+		t.Fatalf("accounts %s, want %s", RosettaTypes.PrintStruct(accounts), RosettaTypes.PrintStruct(want))
+	}
+	if !reflect.DeepEqual(amounts, wantAmounts) {
+		t.Fatalf("amounts %v, want %v", amounts, wantAmounts)
+	}
+
+	transaction, err = client.createGenesisTransaction(context.Background(), testBlock(1, "1.0.0", "00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transaction != nil {
+		t.Fatal("genesis transaction in block 1")
+	}
+}
+
+func TestGenesisBlock(t *testing.T) {
+	node := newFakeNode()
+	genesis := testBlock(0, "1.0.0", systemPublicKey)
+	node.addBlock(genesis)
+
+	client := newTestClient(t, node, &ClientOptions{GenesisAccountsFile: writeTempFile(t, testGenesisAccounts())})
+	index := GenesisBlockIndex
+	block, err := client.Block(context.Background(), &RosettaTypes.PartialBlockIdentifier{Index: &index})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if block.BlockIdentifier.Index != GenesisBlockIndex || block.BlockIdentifier.Hash != genesis.Hash {
+		t.Fatalf("block %s", RosettaTypes.PrintStruct(block.BlockIdentifier))
+	}
+	if RosettaTypes.Hash(block.ParentBlockIdentifier) != RosettaTypes.Hash(block.BlockIdentifier) {
+		t.Fatalf("parent block %s", RosettaTypes.PrintStruct(block.ParentBlockIdentifier))
+	}
+	if len(block.Transactions) != 1 {
+		t.Fatalf("%d transactions, want the genesis transaction", len(block.Transactions))
+	}
+	transaction := block.Transactions[0]
+	if transaction.TransactionIdentifier.Hash != GenesisTransactionHash(genesis.Hash) || len(transaction.Operations) != 4 {
+		t.Fatalf("transaction %s", RosettaTypes.PrintStruct(transaction))
+	}
+
+	found, err := client.BlockTransaction(
+		context.Background(),
+		block.BlockIdentifier,
+		transaction.TransactionIdentifier,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if RosettaTypes.Hash(found) != RosettaTypes.Hash(transaction) {
+		t.Fatalf("transaction %s, want %s", RosettaTypes.PrintStruct(found), RosettaTypes.PrintStruct(transaction))
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// SignerMetadataKey is the account identifier metadata key of
+// the public key signing a payload.
+const SignerMetadataKey = "public_key"
+
+// signatureLength is the length of ed25519 signatures
+// and of compact secp256k1 signatures.
+const signatureLength = 64
+
+// PublicKeyHex returns the tagged hex representation
+// of a public key, as used by casper-node.
+func PublicKeyHex(publicKey *RosettaTypes.PublicKey) (string, error) {
+	var tag byte
+	switch publicKey.CurveType {
+	case RosettaTypes.Edwards25519:
+		tag = address.ED25519Tag
+	case RosettaTypes.Secp256k1:
+		tag = address.SECP256K1Tag
+	default:
+		return "", fmt.Errorf("%w: unsupported curve type %s", address.ErrInvalidAddress, publicKey.CurveType)
+	}
+
+	key, err := address.NewPublicKey(tag, publicKey.Bytes)
+	if err != nil {
+		return "", err
+	}
+
+	return key.String(), nil
+}
+
+// AccountHashFromPublicKey returns the account hash key
+// ("account-hash-...") of a tagged public key hex.
+func AccountHashFromPublicKey(publicKey string) (string, error) {
+	key, err := address.ParsePublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return key.AccountHash().String(), nil
+}
+
+// VerifySignature checks the tagged hex signature of message by
+// a tagged hex public key. secp256k1 signatures are compact ECDSA
+// signatures of the SHA-256 digest of message.
+func VerifySignature(publicKey string, signature string, message []byte) error {
+	key, err := address.ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	// Like public keys, the tag and the signature
+	// are checksummed independently.
+	if len(signature) != 2*(signatureLength+1) || !strings.EqualFold(signature[:2], key.String()[:2]) {
+		return fmt.Errorf("%w: malformed signature %s", ErrInvalidSignature, signature)
+	}
+	sig, err := address.DecodeHex(signature[2:])
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err.Error())
+	}
+
+	switch key.Tag {
+	case address.ED25519Tag:
+		if !ed25519.Verify(key.Bytes, message, sig) {
+			return ErrInvalidSignature
+		}
+	case address.SECP256K1Tag:
+		pubKey, err := secp256k1.ParsePubKey(key.Bytes)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSignature, err.Error())
+		}
+
+		var r, s secp256k1.ModNScalar
+		if r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:]) { // nolint:gomnd
+			return fmt.Errorf("%w: malformed signature %s", ErrInvalidSignature, signature)
+		}
+
+		digest := sha256.Sum256(message)
+		if !ecdsa.NewSignature(&r, &s).Verify(digest[:], pubKey) {
+			return ErrInvalidSignature
+		}
+	}
+
+	return nil
+}
+
+// SigningPayload returns the payload signing a deploy hash with
+// a public key, addressed to the sender account of the deploy and
+// keyed by the public key. secp256k1 keys sign the SHA-256 digest
+// of the deploy hash, as VerifySignature expects.
+func SigningPayload(
+	sender string,
+	publicKey *RosettaTypes.PublicKey,
+	deployHash []byte,
+) (*RosettaTypes.SigningPayload, error) {
+	publicKeyHex, err := PublicKeyHex(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	account := MainAccount(sender)
+	account.Metadata = map[string]interface{}{
+		SignerMetadataKey: publicKeyHex,
+	}
+	payload := &RosettaTypes.SigningPayload{
+		AccountIdentifier: account,
+		Bytes:             deployHash,
+		SignatureType:     RosettaTypes.Ed25519,
+	}
+	if publicKey.CurveType == RosettaTypes.Secp256k1 {
+		digest := sha256.Sum256(deployHash)
+		payload.Bytes = digest[:]
+		payload.SignatureType = RosettaTypes.Ecdsa
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// testSigner is a key signing the payloads of a deploy.
+type testSigner struct {
+	publicKey *RosettaTypes.PublicKey
+	sign      func(payload []byte) string
+}
+
+func ed25519Signer(seed byte) testSigner {
+	privateKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+
+	return testSigner{
+		publicKey: &RosettaTypes.PublicKey{
+			Bytes:     privateKey.Public().(ed25519.PublicKey),
+			CurveType: RosettaTypes.Edwards25519,
+		},
+		sign: func(payload []byte) string {
+			return "01" + hex.EncodeToString(ed25519.Sign(privateKey, payload))
+		},
+	}
+}
+
+func secp256k1Signer(seed byte) testSigner {
+	privateKey := secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{seed}, 32))
+
+	return testSigner{
+		publicKey: &RosettaTypes.PublicKey{
+			Bytes:     privateKey.PubKey().SerializeCompressed(),
+			CurveType: RosettaTypes.Secp256k1,
+		},
+		sign: func(payload []byte) string {
+			// Compact signatures are prefixed by a recovery byte.
+			return "02" + hex.EncodeToString(ecdsa.SignCompact(privateKey, payload, true)[1:])
+		},
+	}
+}
+
+func TestSigningPayload(t *testing.T) {
+	deployHash := bytes.Repeat([]byte{0xd1}, 32)
+	digest := sha256.Sum256(deployHash)
+	signers := []testSigner{
+		ed25519Signer(1),
+		ed25519Signer(2),
+		secp256k1Signer(3),
+		secp256k1Signer(4),
+	}
+
+	senderKey, err := PublicKeyHex(signers[0].publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := AccountHashFromPublicKey(senderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, signer := range signers {
+		publicKeyHex, err := PublicKeyHex(signer.publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(publicKeyHex, func(t *testing.T) {
+			payload, err := SigningPayload(sender, signer.publicKey, deployHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every payload is addressed to the sender account.
+			want := MainAccount(sender)
+			want.Metadata = map[string]interface{}{SignerMetadataKey: publicKeyHex}
+			if RosettaTypes.Hash(payload.AccountIdentifier) != RosettaTypes.Hash(want) {
+				t.Fatalf("account %s, want %s", RosettaTypes.PrintStruct(payload.AccountIdentifier), RosettaTypes.PrintStruct(want))
+			}
+
+			switch signer.publicKey.CurveType {
+			case RosettaTypes.Edwards25519:
+				if payload.SignatureType != RosettaTypes.Ed25519 || !bytes.Equal(payload.Bytes, deployHash) {
+					t.Fatalf("ed25519 payload %s", RosettaTypes.PrintStruct(payload))
+				}
+			case RosettaTypes.Secp256k1:
+				if payload.SignatureType != RosettaTypes.Ecdsa || !bytes.Equal(payload.Bytes, digest[:]) {
+					t.Fatalf("secp256k1 payload %s", RosettaTypes.PrintStruct(payload))
+				}
+			}
+
+			// Signatures of the payload approve the deploy hash.
+			if err := VerifySignature(publicKeyHex, signer.sign(payload.Bytes), deployHash); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSigningPayloadUnsupportedCurve(t *testing.T) {
+	publicKey := &RosettaTypes.PublicKey{
+		Bytes:     bytes.Repeat([]byte{1}, 32),
+		CurveType: RosettaTypes.Secp256r1,
+	}
+	if _, err := SigningPayload("account-hash-"+testHash(1), publicKey, make([]byte, 32)); err == nil {
+		t.Fatal("signing payload of a secp256r1 key")
+	}
+}
@@ -0,0 +1,416 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+)
+
+// fakeNode is an in memory NodeClient. Global state
+// items and balances are keyed by state root hash.
+type fakeNode struct {
+	mu sync.Mutex
+
+	blocks         []*rpc.Block
+	blockTransfers map[string][]*rpc.Transfer
+	deploys        map[string]*rpc.DeployResult
+	transactions   map[string]*rpc.TransactionResult
+	items          map[string]*rpc.StoredValue
+	balances       map[string]*big.Int
+	auctions       map[string]*rpc.AuctionState
+	eraSummaries   map[string]*rpc.EraSummary
+	chainspec      *rpc.ChainspecRawBytes
+	chainName      string
+
+	// itemReads counts the reads of each
+	// global state key, at any state.
+	itemReads map[string]int
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{
+		blockTransfers: map[string][]*rpc.Transfer{},
+		deploys:        map[string]*rpc.DeployResult{},
+		transactions:   map[string]*rpc.TransactionResult{},
+		items:          map[string]*rpc.StoredValue{},
+		balances:       map[string]*big.Int{},
+		auctions:       map[string]*rpc.AuctionState{},
+		eraSummaries:   map[string]*rpc.EraSummary{},
+		itemReads:      map[string]int{},
+	}
+}
+
+func stateKey(stateRootHash string, key string) string {
+	return stateRootHash + " " + strings.ToLower(key)
+}
+
+func notFoundError(what string) error {
+	return fmt.Errorf("%w: %s", rpc.ErrNotFound, what)
+}
+
+// addBlock adds block, the last block added being the latest.
+func (n *fakeNode) addBlock(block *rpc.Block, transfers ...*rpc.Transfer) {
+	n.blocks = append(n.blocks, block)
+	n.blockTransfers[block.Hash] = transfers
+}
+
+// addDeploy adds deploy, executed with result in block.
+func (n *fakeNode) addDeploy(deploy rpc.Deploy, block *rpc.Block, result rpc.ExecutionResult) {
+	n.deploys[deploy.Hash] = &rpc.DeployResult{
+		Deploy:           deploy,
+		ExecutionResults: []rpc.BlockExecutionResult{{BlockHash: block.Hash, Result: result}},
+	}
+}
+
+// addAccount stores the account of publicKey in the state
+// stateRootHash, with the provided main purse and named keys.
+func (n *fakeNode) addAccount(stateRootHash string, publicKey string, mainPurse string, namedKeys ...rpc.NamedKey) {
+	hash, err := AccountHashFromPublicKey(publicKey)
+	if err != nil {
+		panic(err)
+	}
+
+	n.items[stateKey(stateRootHash, hash)] = &rpc.StoredValue{
+		Account: &rpc.Account{
+			AccountHash: hash,
+			MainPurse:   mainPurse,
+			NamedKeys:   namedKeys,
+		},
+	}
+}
+
+// setItem stores value under key in the state stateRootHash.
+func (n *fakeNode) setItem(stateRootHash string, key string, value *rpc.StoredValue) {
+	n.items[stateKey(stateRootHash, key)] = value
+}
+
+// setBalance sets the balance of purse in the state stateRootHash.
+func (n *fakeNode) setBalance(stateRootHash string, purse string, balance int64) {
+	n.balances[stateKey(stateRootHash, purseAddress(purse))] = big.NewInt(balance)
+
+	parsed, err := json.Marshal(strconv.FormatInt(balance, 10))
+	if err != nil {
+		panic(err)
+	}
+	key := "balance-" + strings.TrimPrefix(purseAddress(purse), "uref-")
+	n.items[stateKey(stateRootHash, key)] = &rpc.StoredValue{CLValue: &rpc.CLValue{CLType: json.RawMessage(`"U512"`), Parsed: parsed}}
+}
+
+func (n *fakeNode) GetStatus(ctx context.Context) (*rpc.StatusResult, error) {
+	return &rpc.StatusResult{ChainspecName: n.chainName}, nil
+}
+
+func (n *fakeNode) GetPeers(ctx context.Context) ([]rpc.Peer, error) {
+	return []rpc.Peer{}, nil
+}
+
+func (n *fakeNode) GetBlock(ctx context.Context, blockIdentifier *rpc.BlockIdentifier) (*rpc.Block, error) {
+	if len(n.blocks) == 0 {
+		return nil, notFoundError("block")
+	}
+	if blockIdentifier == nil {
+		return n.blocks[len(n.blocks)-1], nil
+	}
+
+	for _, block := range n.blocks {
+		if blockIdentifier.Hash != nil && strings.EqualFold(block.Hash, *blockIdentifier.Hash) {
+			return block, nil
+		}
+		if blockIdentifier.Height != nil && block.Header.Height == *blockIdentifier.Height {
+			return block, nil
+		}
+	}
+
+	return nil, notFoundError("block")
+}
+
+func (n *fakeNode) GetBlockTransfers(
+	ctx context.Context,
+	blockIdentifier *rpc.BlockIdentifier,
+) ([]*rpc.Transfer, error) {
+	block, err := n.GetBlock(ctx, blockIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.blockTransfers[block.Hash], nil
+}
+
+func (n *fakeNode) GetDeploy(ctx context.Context, hash string) (*rpc.DeployResult, error) {
+	deploy, ok := n.deploys[hash]
+	if !ok {
+		return nil, notFoundError("deploy " + hash)
+	}
+
+	return deploy, nil
+}
+
+func (n *fakeNode) GetTransaction(ctx context.Context, hash rpc.TransactionHash) (*rpc.TransactionResult, error) {
+	if hash.Deploy != nil {
+		deploy, err := n.GetDeploy(ctx, *hash.Deploy)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rpc.TransactionResult{
+			Transaction:      rpc.VersionedTransaction{Deploy: &deploy.Deploy},
+			ExecutionResults: deploy.ExecutionResults,
+		}, nil
+	}
+
+	transaction, ok := n.transactions[hash.Hash()]
+	if !ok {
+		return nil, notFoundError("transaction " + hash.Hash())
+	}
+
+	return transaction, nil
+}
+
+func (n *fakeNode) GetStateItem(
+	ctx context.Context,
+	stateRootHash string,
+	key string,
+	path []string,
+) (*rpc.StoredValue, error) {
+	n.mu.Lock()
+	n.itemReads[strings.ToLower(key)]++
+	n.mu.Unlock()
+
+	item, ok := n.items[stateKey(stateRootHash, key)]
+	if !ok {
+		return nil, notFoundError(key)
+	}
+
+	return item, nil
+}
+
+func (n *fakeNode) QueryGlobalState(
+	ctx context.Context,
+	stateIdentifier *rpc.StateIdentifier,
+	key string,
+	path []string,
+) (*rpc.StoredValue, error) {
+	stateRootHash := ""
+	switch {
+	case stateIdentifier.StateRootHash != nil:
+		stateRootHash = *stateIdentifier.StateRootHash
+	case stateIdentifier.BlockHash != nil:
+		block, err := n.GetBlock(ctx, rpc.BlockByHash(*stateIdentifier.BlockHash))
+		if err != nil {
+			return nil, err
+		}
+		stateRootHash = block.Header.StateRootHash
+	}
+
+	return n.GetStateItem(ctx, stateRootHash, key, path)
+}
+
+func (n *fakeNode) GetBalance(ctx context.Context, stateRootHash string, purseURef string) (*big.Int, error) {
+	balance, ok := n.balances[stateKey(stateRootHash, purseAddress(purseURef))]
+	if !ok {
+		return nil, notFoundError("balance of " + purseURef)
+	}
+
+	return balance, nil
+}
+
+func (n *fakeNode) QueryBalance(
+	ctx context.Context,
+	stateIdentifier *rpc.StateIdentifier,
+	purseIdentifier *rpc.PurseIdentifier,
+) (*big.Int, error) {
+	stateRootHash := *stateIdentifier.StateRootHash
+	purse := ""
+	switch {
+	case purseIdentifier.PurseURef != nil:
+		purse = *purseIdentifier.PurseURef
+	case purseIdentifier.MainPurseUnderAccountHash != nil:
+		item, err := n.GetStateItem(ctx, stateRootHash, *purseIdentifier.MainPurseUnderAccountHash, nil)
+		if err != nil {
+			return nil, err
+		}
+		purse = item.Account.MainPurse
+	case purseIdentifier.MainPurseUnderPublicKey != nil:
+		hash, err := AccountHashFromPublicKey(*purseIdentifier.MainPurseUnderPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		item, err := n.GetStateItem(ctx, stateRootHash, hash, nil)
+		if err != nil {
+			return nil, err
+		}
+		purse = item.Account.MainPurse
+	}
+
+	return n.GetBalance(ctx, stateRootHash, purse)
+}
+
+func (n *fakeNode) PutDeploy(ctx context.Context, deploy json.RawMessage) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (n *fakeNode) GetAuctionInfo(
+	ctx context.Context,
+	blockIdentifier *rpc.BlockIdentifier,
+) (*rpc.AuctionState, error) {
+	block, err := n.GetBlock(ctx, blockIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	auction, ok := n.auctions[block.Hash]
+	if !ok {
+		return &rpc.AuctionState{StateRootHash: block.Header.StateRootHash}, nil
+	}
+
+	return auction, nil
+}
+
+func (n *fakeNode) GetEraInfoBySwitchBlock(
+	ctx context.Context,
+	blockIdentifier *rpc.BlockIdentifier,
+) (*rpc.EraSummary, error) {
+	return n.GetEraSummary(ctx, blockIdentifier)
+}
+
+func (n *fakeNode) GetEraSummary(
+	ctx context.Context,
+	blockIdentifier *rpc.BlockIdentifier,
+) (*rpc.EraSummary, error) {
+	block, err := n.GetBlock(ctx, blockIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	eraSummary, ok := n.eraSummaries[block.Hash]
+	if !ok {
+		return nil, notFoundError("era summary")
+	}
+
+	return eraSummary, nil
+}
+
+func (n *fakeNode) GetChainspec(ctx context.Context) (*rpc.ChainspecRawBytes, error) {
+	if n.chainspec == nil {
+		return nil, notFoundError("chainspec")
+	}
+
+	return n.chainspec, nil
+}
+
+// newTestClient returns a Client of node, closed
+// at the end of the test.
+func newTestClient(t *testing.T, node *fakeNode, opts *ClientOptions) *Client {
+	client, err := NewClientWithNode(node, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	return client
+}
+
+// testHash returns a 32 bytes hash made of b.
+func testHash(b byte) string {
+	return strings.Repeat(hex.EncodeToString([]byte{b}), 32) // nolint:gomnd
+}
+
+// testPublicKey returns an ed25519 public key made of b.
+func testPublicKey(b byte) string {
+	return "01" + testHash(b)
+}
+
+// testAccountHash returns the account hash of publicKey.
+func testAccountHash(publicKey string) string {
+	hash, err := AccountHashFromPublicKey(publicKey)
+	if err != nil {
+		panic(err)
+	}
+
+	return hash
+}
+
+// testPurse returns a purse made of b, with full access rights.
+func testPurse(b byte) string {
+	return "uref-" + testHash(b) + "-007"
+}
+
+// testBlock returns a block at height, whose hash, parent
+// hash and state root hash are derived from height.
+func testBlock(height uint64, protocolVersion string, proposer string) *rpc.Block {
+	return &rpc.Block{
+		Hash: fmt.Sprintf("%064x", 0xb000+height),
+		Header: rpc.BlockHeader{
+			ParentHash:      fmt.Sprintf("%064x", 0xb000+height-1),
+			StateRootHash:   fmt.Sprintf("%064x", 0x5000+height),
+			Timestamp:       time.Unix(1600000000, 0).UTC(),
+			Height:          height,
+			ProtocolVersion: protocolVersion,
+		},
+		Body: rpc.BlockBody{
+			Proposer: proposer,
+		},
+	}
+}
+
+// stringValue returns a CLValue whose parsed value is value.
+func stringValue(value string) rpc.CLValue {
+	parsed, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return rpc.CLValue{Parsed: parsed}
+}
+
+// standardPayment returns the standard payment of amount.
+func standardPayment(amount string) rpc.ExecutableDeployItem {
+	return rpc.ExecutableDeployItem{
+		ModuleBytes: &rpc.ModuleBytes{
+			Args: rpc.RuntimeArgs{{Name: "amount", Value: stringValue(amount)}},
+		},
+	}
+}
+
+// transferDeploy returns a native transfer deploy
+// signed by account, paying a standard payment.
+func transferDeploy(hash string, account string) rpc.Deploy {
+	return rpc.Deploy{
+		Hash: hash,
+		Header: rpc.DeployHeader{
+			Account:   account,
+			Timestamp: time.Unix(1600000000, 0).UTC(),
+			TTL:       "30m",
+			GasPrice:  1,
+			ChainName: "casper-test",
+		},
+		Payment: standardPayment("100000000"),
+		Session: rpc.ExecutableDeployItem{Transfer: &rpc.TransferDeployItem{}},
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+)
+
+// ErrUnsupportedProtocolVersion is returned when a block was
+// produced by a protocol version the client cannot parse.
+var ErrUnsupportedProtocolVersion = errors.New("unsupported protocol version")
+
+// protocolVersion is a semantic protocol version.
+type protocolVersion [3]uint64
+
+// parseProtocolVersion parses a "major.minor.patch" version.
+func parseProtocolVersion(version string) (protocolVersion, error) {
+	var parsed protocolVersion
+	parts := strings.Split(version, ".")
+	if len(parts) != len(parsed) {
+		return parsed, fmt.Errorf("invalid protocol version %s", version)
+	}
+
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return parsed, fmt.Errorf("%w: invalid protocol version %s", err, version)
+		}
+		parsed[i] = value
+	}
+
+	return parsed, nil
+}
+
+// less returns true if v is older than other.
+func (v protocolVersion) less(other protocolVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+
+	return false
+}
+
+// protocolStrategy parses the fees, rewards and transfers
+// of the blocks of a range of protocol versions.
+type protocolStrategy interface {
+	// deployFee returns the fee of a deploy. paymentAmount returns
+	// the amount of a standard payment, or the execution cost, and
+	// is only called if the effects of the deploy show no fee.
+	deployFee(
+		outcome *rpc.ExecutionOutcome,
+		transfers []*rpc.Transfer,
+		signerMainPurse string,
+		validatorMainPurse string,
+		paymentAmount func() (string, error),
+	) (*deployFee, error)
+
+	// deployTransfers returns the transfers of a successful deploy
+	// which are not returned by chain_get_block_transfers.
+	deployTransfers(
+		ctx context.Context,
+		ec *Client,
+		outcome *rpc.ExecutionOutcome,
+		block *rpc.Block,
+	) ([]*rpc.Transfer, error)
+
+	// eraSummary returns the seigniorage allocations
+	// paid by a switch block.
+	eraSummary(ctx context.Context, ec *Client, block *rpc.Block) (*rpc.EraSummary, error)
+
+	// accountBalance returns the balance at block of the main purse
+	// of an account hash or public key, or of a purse.
+	accountBalance(ctx context.Context, ec *Client, block *rpc.Block, address string) (*big.Int, error)
+
+	// finalitySignatureMessage returns the message
+	// signed by the finality signatures of block.
+	finalitySignatureMessage(ctx context.Context, ec *Client, block *rpc.Block) ([]byte, error)
+
+	// systemRegistryKey returns the key of the
+	// registry of the system contracts.
+	systemRegistryKey() string
+
+	// unbondingKeyPrefix returns the prefix of the keys holding the
+	// unbonding purses of an account, followed by its account hash.
+	unbondingKeyPrefix() string
+}
+
+// protocolStrategies are the strategies of each range of
+// protocol versions, by descending first version.
+var protocolStrategies = []struct {
+	since    protocolVersion
+	strategy protocolStrategy
+}{
+	{since: protocolVersion{2, 0, 0}, strategy: &v2Strategy{}},
+	{since: protocolVersion{1, 5, 0}, strategy: &v15Strategy{}},
+	{since: protocolVersion{1, 0, 0}, strategy: &v1Strategy{}},
+}
+
+// strategyFor returns the protocolStrategy of the
+// blocks produced by the provided protocol version.
+func strategyFor(version string) (protocolStrategy, error) {
+	parsed, err := parseProtocolVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range protocolStrategies {
+		if !parsed.less(entry.since) && parsed[0] == entry.since[0] {
+			return entry.strategy, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedProtocolVersion, version)
+}
+
+// v1Strategy parses the blocks of protocol versions 1.0 to 1.4.
+// The fee is paid out of the payment purse to the proposer, and
+// era infos are read by switch block.
+type v1Strategy struct{}
+
+func (s *v1Strategy) deployFee(
+	outcome *rpc.ExecutionOutcome,
+	transfers []*rpc.Transfer,
+	signerMainPurse string,
+	validatorMainPurse string,
+	paymentAmount func() (string, error),
+) (*deployFee, error) {
+	fee, err := feeFromEffects(outcome, transfers, signerMainPurse)
+	if err != nil || fee != nil {
+		return fee, err
+	}
+
+	amount, err := paymentAmount()
+	if err != nil {
+		return nil, err
+	}
+
+	return estimatedFee(amount, signerMainPurse, validatorMainPurse)
+}
+
+func (s *v1Strategy) deployTransfers(
+	ctx context.Context,
+	ec *Client,
+	outcome *rpc.ExecutionOutcome,
+	block *rpc.Block,
+) ([]*rpc.Transfer, error) {
+	return ec.getDeployTransfers(ctx, outcome, block)
+}
+
+func (s *v1Strategy) eraSummary(ctx context.Context, ec *Client, block *rpc.Block) (*rpc.EraSummary, error) {
+	eraSummary, err := ec.node.GetEraInfoBySwitchBlock(ctx, rpc.BlockByHash(block.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get era info", err)
+	}
+	if eraSummary == nil {
+		return nil, fmt.Errorf("no era info for switch block %s", block.Hash)
+	}
+
+	return eraSummary, nil
+}
+
+func (s *v1Strategy) accountBalance(
+	ctx context.Context,
+	ec *Client,
+	block *rpc.Block,
+	addr string,
+) (*big.Int, error) {
+	return ec.legacyAccountBalance(ctx, block.Header.StateRootHash, addr)
+}
+
+// finalitySignatureMessage returns the block hash
+// followed by the era id.
+func (s *v1Strategy) finalitySignatureMessage(
+	ctx context.Context,
+	ec *Client,
+	block *rpc.Block,
+) ([]byte, error) {
+	message, err := hex.DecodeString(block.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid block hash %s", err, block.Hash)
+	}
+
+	return appendUint64(message, block.Header.EraID), nil
+}
+
+func (s *v1Strategy) systemRegistryKey() string {
+	return systemContractRegistryKey
+}
+
+// unbondingKeyPrefix returns the prefix of the withdraw keys.
+func (s *v1Strategy) unbondingKeyPrefix() string {
+	return withdrawKeyPrefix
+}
+
+// v15Strategy parses the blocks of protocol versions 1.5 and
+// later 1.x releases, which store era infos under a single
+// era summary key and unbonding purses under unbond keys.
+type v15Strategy struct {
+	v1Strategy
+}
+
+// unbondingKeyPrefix returns the prefix of the unbond keys,
+// which replace the withdraw keys since protocol version 1.5.
+func (s *v15Strategy) unbondingKeyPrefix() string {
+	return unbondKeyPrefix
+}
+
+func (s *v15Strategy) eraSummary(ctx context.Context, ec *Client, block *rpc.Block) (*rpc.EraSummary, error) {
+	eraSummary, err := ec.node.GetEraSummary(ctx, rpc.BlockByHash(block.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get era summary", err)
+	}
+
+	return eraSummary, nil
+}
+
+// v2Strategy parses the blocks of protocol versions 2.x. Transfer
+// records are part of the execution results, and fees may be held,
+// refunded or pooled rather than paid to the proposer: only the
+// balance changes recorded by the effects are reported.
+type v2Strategy struct {
+	v15Strategy
+}
+
+func (s *v2Strategy) deployFee(
+	outcome *rpc.ExecutionOutcome,
+	transfers []*rpc.Transfer,
+	signerMainPurse string,
+	validatorMainPurse string,
+	paymentAmount func() (string, error),
+) (*deployFee, error) {
+	return feeFromEffects(outcome, transfers, signerMainPurse)
+}
+
+func (s *v2Strategy) deployTransfers(
+	ctx context.Context,
+	ec *Client,
+	outcome *rpc.ExecutionOutcome,
+	block *rpc.Block,
+) ([]*rpc.Transfer, error) {
+	return outcome.TransferRecords, nil
+}
+
+func (s *v2Strategy) accountBalance(
+	ctx context.Context,
+	ec *Client,
+	block *rpc.Block,
+	addr string,
+) (*big.Int, error) {
+	parsed, err := address.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	formatted := parsed.String()
+	purseIdentifier := &rpc.PurseIdentifier{}
+	switch {
+	case parsed.AccountHash != nil:
+		purseIdentifier.MainPurseUnderAccountHash = &formatted
+	case parsed.URef != nil:
+		purseIdentifier.PurseURef = &formatted
+	case parsed.PublicKey != nil:
+		purseIdentifier.MainPurseUnderPublicKey = &formatted
+	}
+
+	balance, err := ec.node.QueryBalance(
+		ctx,
+		&rpc.StateIdentifier{StateRootHash: &block.Header.StateRootHash},
+		purseIdentifier,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't get account balance", err)
+	}
+
+	return balance, nil
+}
+
+// finalitySignatureMessage returns the block hash followed by the
+// block height, the era id and the hash of the chain name.
+func (s *v2Strategy) finalitySignatureMessage(
+	ctx context.Context,
+	ec *Client,
+	block *rpc.Block,
+) ([]byte, error) {
+	message, err := hex.DecodeString(block.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid block hash %s", err, block.Hash)
+	}
+
+	chainNameHash, err := ec.chainNameHash(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	message = appendUint64(message, block.Header.Height)
+	message = appendUint64(message, block.Header.EraID)
+
+	return append(message, chainNameHash...), nil
+}
+
+func (s *v2Strategy) systemRegistryKey() string {
+	return systemEntityRegistryKey
+}
+
+// appendUint64 appends the little endian bytes of value to b.
+func appendUint64(b []byte, value uint64) []byte {
+	var encoded [8]byte
+	binary.LittleEndian.PutUint64(encoded[:], value)
+
+	return append(b, encoded[:]...)
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStrategyFor(t *testing.T) {
+	tests := map[string]struct {
+		version string
+		want    protocolStrategy
+		err     error
+		invalid bool
+	}{
+		"1.0":             {version: "1.0.0", want: &v1Strategy{}},
+		"1.3":             {version: "1.3.1", want: &v1Strategy{}},
+		"1.4":             {version: "1.4.15", want: &v1Strategy{}},
+		"1.5":             {version: "1.5.0", want: &v15Strategy{}},
+		"later 1.5":       {version: "1.5.8", want: &v15Strategy{}},
+		"2.0":             {version: "2.0.0", want: &v2Strategy{}},
+		"later 2.x":       {version: "2.1.3", want: &v2Strategy{}},
+		"unknown major":   {version: "3.0.0", err: ErrUnsupportedProtocolVersion},
+		"major 0":         {version: "0.9.0", err: ErrUnsupportedProtocolVersion},
+		"missing patch":   {version: "1.5", invalid: true},
+		"invalid version": {version: "1.x.0", invalid: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			strategy, err := strategyFor(test.version)
+			switch {
+			case test.err != nil:
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error %v, want %v", err, test.err)
+				}
+				return
+			case test.invalid:
+				if err == nil || errors.Is(err, ErrUnsupportedProtocolVersion) {
+					t.Fatalf("error %v, want an invalid version error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.TypeOf(strategy) != reflect.TypeOf(test.want) {
+				t.Fatalf("strategy %T, want %T", strategy, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,480 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+const (
+	// mainPurseEntry and namedKeyEntry tell whether an
+	// indexed purse is the main purse of its account.
+	mainPurseEntry = "main"
+	namedKeyEntry  = "named"
+
+	writeAccountTransform = "WriteAccount"
+	addKeysTransform      = "AddKeys"
+	writeTransform        = "Write"
+
+	// entityAccountPrefix and namedKeyEntityAccountPrefix prefix
+	// the keys of the account entities and of their named keys
+	// since protocol version 2.0.
+	entityAccountPrefix         = "entity-account-"
+	namedKeyEntityAccountPrefix = "named-key-entity-account-"
+)
+
+// purseOwner is the account owning an indexed purse.
+type purseOwner struct {
+	accountHash string
+	main        bool
+}
+
+// purseIndex maps purses, without access rights, to the account
+// owning them, as found in the blocks rendered so far. Entries are
+// appended to a log file, replayed when the index is opened. The
+// index is in memory only if it has no file. Blocks are not rendered
+// from the index, which depends on the blocks rendered before, but
+// from the purses of the block itself, see resolvePurseOwners.
+type purseIndex struct {
+	mu     sync.RWMutex
+	owners map[string]purseOwner
+	file   *os.File
+}
+
+// openPurseIndex opens the index stored at path,
+// creating it if needed. An empty path opens an
+// in memory index.
+func openPurseIndex(path string) (*purseIndex, error) {
+	index := &purseIndex{owners: map[string]purseOwner{}}
+	if len(path) == 0 {
+		return index, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("%w: unable to create purse index directory", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600) // nolint:gomnd
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to open purse index %s", err, path)
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 { // nolint:gomnd
+			// Skip the last entry if it was partially written.
+			continue
+		}
+		index.owners[fields[0]] = purseOwner{accountHash: fields[1], main: fields[2] == mainPurseEntry}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w: unable to read purse index %s", err, path)
+	}
+	index.file = file
+
+	return index, nil
+}
+
+// get returns the owner of purse.
+func (i *purseIndex) get(purse string) (purseOwner, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	owner, ok := i.owners[purseAddress(purse)]
+	return owner, ok
+}
+
+// add records the owner of purse. A purse indexed as the main purse
+// of an account is not downgraded by a later named key entry.
+func (i *purseIndex) add(purse string, owner purseOwner) error {
+	purse = purseAddress(purse)
+	owner.accountHash = strings.ToLower(owner.accountHash)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	current, ok := i.owners[purse]
+	if ok && (current == owner || (current.main && current.accountHash == owner.accountHash)) {
+		return nil
+	}
+	i.owners[purse] = owner
+
+	if i.file == nil {
+		return nil
+	}
+
+	entry := namedKeyEntry
+	if owner.main {
+		entry = mainPurseEntry
+	}
+	if _, err := fmt.Fprintf(i.file, "%s %s %s\n", purse, owner.accountHash, entry); err != nil {
+		return fmt.Errorf("%w: unable to write purse index", err)
+	}
+
+	return nil
+}
+
+// close closes the index file.
+func (i *purseIndex) close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.file == nil {
+		return nil
+	}
+
+	err := i.file.Close()
+	i.file = nil
+
+	return err
+}
+
+// blockPurses maps the purses of the accounts written by the
+// transactions of a block, without access rights, to their owner.
+type blockPurses map[string]purseOwner
+
+// indexBlockPurses returns the purses of the accounts written by
+// deploys, executed in block, in execution order. The purses are
+// recorded in the purse index as well.
+func (ec *Client) indexBlockPurses(
+	ctx context.Context,
+	block *rpc.Block,
+	deploys []*executedTransaction,
+) (blockPurses, error) {
+	purses := blockPurses{}
+	for _, deploy := range deploys {
+		executionResult, err := deploy.executionResult(block.Hash)
+		if err != nil {
+			return nil, err
+		}
+		outcome, err := executionResult.Outcome()
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid execution result of transaction %s", err, deploy.hash)
+		}
+		if err := ec.indexPurses(ctx, block, outcome, purses); err != nil {
+			return nil, err
+		}
+	}
+
+	return purses, nil
+}
+
+// recordPurse records the owner of purse in purses and in the
+// purse index. A purse recorded as the main purse of an account
+// is not downgraded by a later named key entry.
+func (ec *Client) recordPurse(purses blockPurses, purse string, owner purseOwner) error {
+	owner.accountHash = strings.ToLower(owner.accountHash)
+	current, ok := purses[purseAddress(purse)]
+	if !ok || !current.main || current.accountHash != owner.accountHash {
+		purses[purseAddress(purse)] = owner
+	}
+
+	return ec.purseIndex.add(purse, owner)
+}
+
+// indexPurses records in purses the purses of the accounts written
+// by the execution effects of outcome: the main purse and named keys
+// of created accounts, and the purses added to the named keys of
+// existing ones.
+func (ec *Client) indexPurses(
+	ctx context.Context,
+	block *rpc.Block,
+	outcome *rpc.ExecutionOutcome,
+	purses blockPurses,
+) error {
+	for _, entry := range outcome.Effect.Transforms {
+		var transform map[string]json.RawMessage
+		if err := json.Unmarshal(entry.Transform, &transform); err != nil {
+			// Unit transforms such as "Identity".
+			continue
+		}
+
+		var err error
+		switch {
+		case transform[writeAccountTransform] != nil:
+			err = ec.indexAccount(ctx, block, entry.Key, purses)
+		case transform[addKeysTransform] != nil:
+			err = ec.indexNamedKeys(ctx, block, entry.Key, transform[addKeysTransform], purses)
+		case transform[writeTransform] != nil:
+			err = ec.indexWrite(ctx, block, entry.Key, transform[writeTransform], purses)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: could not index purses of %s", err, entry.Key)
+		}
+	}
+
+	return nil
+}
+
+// indexAccount records the main purse and the named key
+// purses of an account created or written by a 1.x block.
+func (ec *Client) indexAccount(ctx context.Context, block *rpc.Block, key string, purses blockPurses) error {
+	if !strings.HasPrefix(key, accountHashPrefix) {
+		return nil
+	}
+
+	item, err := ec.node.GetStateItem(ctx, block.Header.StateRootHash, key, nil)
+	if err != nil {
+		return fmt.Errorf("%w: could not get account %s", err, key)
+	}
+	if item.Account == nil {
+		return fmt.Errorf("%s is not an account", key)
+	}
+
+	return ec.indexStoredAccount(ctx, block, key, item.Account, purses)
+}
+
+// isPurse tells whether uref holds a balance in the
+// global state of block, that is whether it is a purse.
+func (ec *Client) isPurse(ctx context.Context, block *rpc.Block, uref string) (bool, error) {
+	key := balanceKeyPrefix + strings.TrimPrefix(purseAddress(uref), urefPrefix)
+	_, err := ec.node.GetStateItem(ctx, block.Header.StateRootHash, key, nil)
+	if rpc.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: could not get %s", err, key)
+	}
+
+	return true, nil
+}
+
+// indexNamedPurse records uref as a purse of accountHash
+// other than its main purse, if it is a purse.
+func (ec *Client) indexNamedPurse(
+	ctx context.Context,
+	block *rpc.Block,
+	accountHash string,
+	uref string,
+	purses blockPurses,
+) error {
+	if !strings.HasPrefix(uref, urefPrefix) {
+		return nil
+	}
+
+	// URefs are only indexed once they are known to be purses.
+	owner, indexed := ec.purseIndex.get(uref)
+	if !indexed || owner.accountHash != strings.ToLower(accountHash) {
+		purse, err := ec.isPurse(ctx, block, uref)
+		if err != nil || !purse {
+			return err
+		}
+	}
+
+	return ec.recordPurse(purses, uref, purseOwner{accountHash: accountHash})
+}
+
+// indexStoredAccount records the main purse and the
+// named key purses of account.
+func (ec *Client) indexStoredAccount(
+	ctx context.Context,
+	block *rpc.Block,
+	accountHash string,
+	account *rpc.Account,
+	purses blockPurses,
+) error {
+	ec.mainPurses.set(strings.ToLower(accountHash), account.MainPurse)
+	if err := ec.recordPurse(purses, account.MainPurse, purseOwner{accountHash: accountHash, main: true}); err != nil {
+		return err
+	}
+
+	for _, namedKey := range account.NamedKeys {
+		if err := ec.indexNamedPurse(ctx, block, accountHash, namedKey.Key, purses); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexNamedKeys records the purses of an AddKeys
+// transform applied to an account.
+func (ec *Client) indexNamedKeys(
+	ctx context.Context,
+	block *rpc.Block,
+	key string,
+	value json.RawMessage,
+	purses blockPurses,
+) error {
+	if !strings.HasPrefix(key, accountHashPrefix) {
+		return nil
+	}
+
+	var namedKeys []rpc.NamedKey
+	if err := json.Unmarshal(value, &namedKeys); err != nil {
+		return fmt.Errorf("%w: invalid %s transform", err, addKeysTransform)
+	}
+
+	for _, namedKey := range namedKeys {
+		if err := ec.indexNamedPurse(ctx, block, key, namedKey.Key, purses); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// namedKeyValue is a named key written
+// by protocol versions 2.x.
+type namedKeyValue struct {
+	NamedKey rpc.CLValue `json:"named_key"`
+}
+
+// addressableEntity is an account entity
+// written by protocol versions 2.x.
+type addressableEntity struct {
+	MainPurse string `json:"main_purse"`
+}
+
+// indexWrite records the purses of the accounts, account entities
+// and account named keys written by 2.x blocks.
+func (ec *Client) indexWrite(
+	ctx context.Context,
+	block *rpc.Block,
+	key string,
+	value json.RawMessage,
+	purses blockPurses,
+) error {
+	var storedValue struct {
+		Account           *rpc.Account       `json:"Account"`
+		AddressableEntity *addressableEntity `json:"AddressableEntity"`
+		NamedKey          *namedKeyValue     `json:"NamedKey"`
+	}
+	if err := json.Unmarshal(value, &storedValue); err != nil {
+		// Writes of other stored values.
+		return nil
+	}
+
+	switch {
+	case storedValue.Account != nil && strings.HasPrefix(key, accountHashPrefix):
+		return ec.indexStoredAccount(ctx, block, key, storedValue.Account, purses)
+	case storedValue.AddressableEntity != nil && strings.HasPrefix(key, entityAccountPrefix):
+		accountHash := accountHashPrefix + strings.TrimPrefix(key, entityAccountPrefix)
+		ec.mainPurses.set(accountHash, storedValue.AddressableEntity.MainPurse)
+		return ec.recordPurse(
+			purses,
+			storedValue.AddressableEntity.MainPurse,
+			purseOwner{accountHash: accountHash, main: true},
+		)
+	case storedValue.NamedKey != nil && strings.HasPrefix(key, namedKeyEntityAccountPrefix):
+		// named-key-entity-account-<account hash>-<name hash>
+		parts := strings.Split(strings.TrimPrefix(key, namedKeyEntityAccountPrefix), "-")
+		if len(parts) != 2 { // nolint:gomnd
+			return nil
+		}
+
+		var namedKey string
+		if err := json.Unmarshal(storedValue.NamedKey.NamedKey.Parsed, &namedKey); err != nil {
+			return nil
+		}
+
+		return ec.indexNamedPurse(ctx, block, accountHashPrefix+parts[0], namedKey, purses)
+	}
+
+	return nil
+}
+
+// resolvePurseOwners records the owners of the moved purses not
+// resolved from the transaction. The owner of a purse is looked up
+// among the owner recorded in the purses of the block and the
+// accounts of the transaction, in the global state of block or in
+// the one of its parent for purses the block removes from their
+// account. Other purses are left unresolved: the owners only depend
+// on the block and on the global state, not on the blocks rendered
+// before.
+func (ec *Client) resolvePurseOwners(
+	ctx context.Context,
+	owners *purseOwners,
+	block *rpc.Block,
+	purses blockPurses,
+	moved []string,
+) error {
+	transactionAccounts := owners.accountHashes()
+	parentStateRootHash := ""
+	for _, purse := range moved {
+		if _, ok := owners.accounts[purseAddress(purse)]; ok {
+			continue
+		}
+
+		candidates := transactionAccounts
+		if owner, ok := purses[purseAddress(purse)]; ok {
+			candidates = append([]string{owner.accountHash}, transactionAccounts...)
+		}
+
+		account, err := ec.purseAccount(ctx, block.Header.StateRootHash, candidates, purse)
+		if err != nil {
+			return err
+		}
+		if account == nil && block.Header.Height > 0 {
+			if len(parentStateRootHash) == 0 {
+				parent, err := ec.node.GetBlock(ctx, rpc.BlockByHash(block.Header.ParentHash))
+				if err != nil {
+					return fmt.Errorf("%w: could not get parent block", err)
+				}
+				parentStateRootHash = parent.Header.StateRootHash
+			}
+
+			account, err = ec.purseAccount(ctx, parentStateRootHash, candidates, purse)
+			if err != nil {
+				return err
+			}
+		}
+		if account != nil {
+			owners.accounts[purseAddress(purse)] = account
+		}
+	}
+
+	return nil
+}
+
+// purseAccount returns the account identifier of purse if the
+// first of candidates, account hashes, owning it in the global
+// state stateRootHash, or nil if none does.
+func (ec *Client) purseAccount(
+	ctx context.Context,
+	stateRootHash string,
+	candidates []string,
+	purse string,
+) (*RosettaTypes.AccountIdentifier, error) {
+	for _, candidate := range candidates {
+		owned, main, err := ec.accountPurse(ctx, stateRootHash, candidate, purse)
+		if err != nil {
+			return nil, err
+		}
+		if !owned {
+			continue
+		}
+
+		if main {
+			return MainAccount(candidate), nil
+		}
+		return PurseAccount(candidate, purse), nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+func TestIndexPursesOnlyIndexesPurses(t *testing.T) {
+	owner := testAccountHash(testPublicKey(0xa1))
+	purse, contract := testPurse(0xc1), testPurse(0xc2)
+	block := testBlock(10, "1.4.0", testPublicKey(0xa0))
+
+	node := newFakeNode()
+	node.addBlock(block)
+	node.setBalance(block.Header.StateRootHash, purse, 100)
+
+	client := newTestClient(t, node, nil)
+	purses := blockPurses{}
+	err := client.indexPurses(context.Background(), block, &rpc.ExecutionOutcome{
+		Effect: rpc.ExecutionEffect{Transforms: []rpc.TransformEntry{{
+			Key: owner,
+			Transform: json.RawMessage(fmt.Sprintf(
+				`{"AddKeys":[{"name":"savings","key":"%s"},{"name":"counter","key":"%s"}]}`,
+				purse,
+				contract,
+			)),
+		}}},
+	}, purses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if indexed, ok := purses[purseAddress(purse)]; !ok || indexed.accountHash != owner {
+		t.Fatalf("purse of the block recorded as %+v %t", indexed, ok)
+	}
+	if indexed, ok := client.purseIndex.get(purse); !ok || indexed.accountHash != owner {
+		t.Fatalf("purse indexed as %+v %t", indexed, ok)
+	}
+	if indexed, ok := purses[purseAddress(contract)]; ok {
+		t.Fatalf("uref without balance recorded as %+v", indexed)
+	}
+	if indexed, ok := client.purseIndex.get(contract); ok {
+		t.Fatalf("uref without balance indexed as %+v", indexed)
+	}
+}
+
+func TestResolvePurseOwners(t *testing.T) {
+	owner, signer := testPublicKey(0xa1), testPublicKey(0xa2)
+	ownerHash, signerHash := testAccountHash(owner), testAccountHash(signer)
+	mainPurse, namedPurse, removedPurse, stalePurse, indexedPurse, signerPurse, unknownPurse :=
+		testPurse(0xc1), testPurse(0xc2), testPurse(0xc3), testPurse(0xc4), testPurse(0xc5), testPurse(0xc6), testPurse(0xc7)
+	parent := testBlock(9, "1.4.0", testPublicKey(0xa0))
+	block := testBlock(10, "1.4.0", testPublicKey(0xa0))
+
+	node := newFakeNode()
+	node.addBlock(parent)
+	node.addBlock(block)
+	node.addAccount(
+		parent.Header.StateRootHash,
+		owner,
+		mainPurse,
+		rpc.NamedKey{Name: "savings", Key: namedPurse},
+		rpc.NamedKey{Name: "old", Key: removedPurse},
+		rpc.NamedKey{Name: "indexed", Key: indexedPurse},
+	)
+	node.addAccount(
+		block.Header.StateRootHash,
+		owner,
+		mainPurse,
+		rpc.NamedKey{Name: "savings", Key: namedPurse},
+		rpc.NamedKey{Name: "indexed", Key: indexedPurse},
+	)
+	node.addAccount(block.Header.StateRootHash, signer, testPurse(0xc8), rpc.NamedKey{Name: "savings", Key: signerPurse})
+
+	client := newTestClient(t, node, nil)
+	// The block purses do not tell main purses apart
+	// from other purses, the global state does.
+	purses := blockPurses{}
+	for _, purse := range []string{mainPurse, namedPurse, removedPurse, stalePurse} {
+		purses[purseAddress(purse)] = purseOwner{accountHash: ownerHash}
+	}
+	// Owners indexed while rendering other blocks are not used.
+	if err := client.purseIndex.add(indexedPurse, purseOwner{accountHash: ownerHash}); err != nil {
+		t.Fatal(err)
+	}
+
+	owners := newPurseOwners()
+	owners.accounts[purseAddress(testPurse(0xc8))] = MainAccount(signerHash)
+	moved := []string{mainPurse, namedPurse, removedPurse, stalePurse, indexedPurse, signerPurse, unknownPurse}
+	if err := client.resolvePurseOwners(context.Background(), owners, block, purses, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*RosettaTypes.AccountIdentifier{
+		MainAccount(ownerHash),
+		PurseAccount(ownerHash, namedPurse),
+		PurseAccount(ownerHash, removedPurse),
+		{Address: purseAddress(stalePurse)},
+		{Address: purseAddress(indexedPurse)},
+		PurseAccount(signerHash, signerPurse),
+		{Address: purseAddress(unknownPurse)},
+	}
+	for i, purse := range moved {
+		if account := owners.account(purse); !reflect.DeepEqual(account, want[i]) {
+			t.Errorf("%s is owned by %s, want %s", purse, RosettaTypes.PrintStruct(account), RosettaTypes.PrintStruct(want[i]))
+		}
+	}
+}
+
+func TestBlockPursesOfEarlierDeploys(t *testing.T) {
+	proposer, owner, sender := testPublicKey(0xa0), testPublicKey(0xa1), testPublicKey(0xa2)
+	savings := testPurse(0xc3)
+	parent := testBlock(9, "1.4.0", proposer)
+	block := testBlock(10, "1.4.0", proposer)
+	block.Body.DeployHashes = []string{testHash(1)}
+	block.Body.TransferHashes = []string{testHash(2)}
+
+	// The first deploy adds a purse to the named keys of owner,
+	// the second one transfers to that purse.
+	transfer := &rpc.Transfer{
+		DeployHash:      testHash(2),
+		TransactionHash: rpc.DeployHash(testHash(2)),
+		From:            testAccountHash(sender),
+		Source:          testPurse(0xc2),
+		Target:          savings,
+		Amount:          "5",
+	}
+
+	node := newFakeNode()
+	node.addBlock(parent)
+	node.addBlock(block, transfer)
+	node.addAccount(parent.Header.StateRootHash, owner, testPurse(0xc1))
+	node.addAccount(block.Header.StateRootHash, owner, testPurse(0xc1), rpc.NamedKey{Name: "savings", Key: savings})
+	node.addAccount(block.Header.StateRootHash, sender, testPurse(0xc2))
+	node.addAccount(block.Header.StateRootHash, proposer, testPurse(0xc0))
+	node.setBalance(block.Header.StateRootHash, savings, 5)
+	node.addDeploy(transferDeploy(testHash(1), owner), block, rpc.ExecutionResult{Success: &rpc.ExecutionOutcome{
+		Effect: rpc.ExecutionEffect{Transforms: []rpc.TransformEntry{{
+			Key:       testAccountHash(owner),
+			Transform: json.RawMessage(fmt.Sprintf(`{"AddKeys":[{"name":"savings","key":"%s"}]}`, savings)),
+		}}},
+		Cost: "100",
+	}})
+	node.addDeploy(transferDeploy(testHash(2), sender), block, rpc.ExecutionResult{Success: &rpc.ExecutionOutcome{Cost: "100"}})
+
+	want := PurseAccount(testAccountHash(owner), savings)
+	index := int64(block.Header.Height)
+	for i := 0; i < 20; i++ {
+		// Every rendering, by a new client, resolves the
+		// purse whatever the order the deploys are hydrated in.
+		client := newTestClient(t, node, nil)
+		rosBlock, err := client.Block(context.Background(), &RosettaTypes.PartialBlockIdentifier{Index: &index})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		transaction := rosBlock.Transactions[1]
+		var target *RosettaTypes.AccountIdentifier
+		for _, operation := range transaction.Operations {
+			if operation.Type == TransferOpType && operation.Amount.Value == "5" {
+				target = operation.Account
+			}
+		}
+		if !reflect.DeepEqual(target, want) {
+			t.Fatalf("transfer to %s, want %s", RosettaTypes.PrintStruct(target), RosettaTypes.PrintStruct(want))
+		}
+
+		found, err := client.BlockTransaction(context.Background(), rosBlock.BlockIdentifier, transaction.TransactionIdentifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if RosettaTypes.Hash(found) != RosettaTypes.Hash(transaction) {
+			t.Fatalf("transaction %s, want %s", RosettaTypes.PrintStruct(found), RosettaTypes.PrintStruct(transaction))
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+const (
+	// eraRewardsTransactionPrefix prefixes the hash of the
+	// synthetic transaction holding the rewards of an era.
+	eraRewardsTransactionPrefix = "era-rewards-"
+
+	// EraIDMetadataKey is the operation metadata key
+	// holding the era id.
+	EraIDMetadataKey = "era_id"
+
+	// ValidatorMetadataKey is the metadata key holding the
+	// public key of the validator a stake is delegated to.
+	ValidatorMetadataKey = "validator_public_key"
+)
+
+// EraRewardsTransactionHash returns the hash of the synthetic
+// transaction holding the rewards paid in a switch block.
+func EraRewardsTransactionHash(blockHash string) string {
+	return eraRewardsTransactionPrefix + blockHash
+}
+
+// isEraRewardsTransactionHash returns true if hash is the
+// hash of a synthetic era rewards transaction.
+func isEraRewardsTransactionHash(hash string) bool {
+	return strings.HasPrefix(hash, eraRewardsTransactionPrefix)
+}
+
+// StakedAccount returns the *RosettaTypes.AccountIdentifier of the
+// amount staked by publicKey with validator.
+func StakedAccount(publicKey string, validator string) *RosettaTypes.AccountIdentifier {
+	return &RosettaTypes.AccountIdentifier{
+		Address: publicKeyAccount(publicKey),
+		SubAccount: &RosettaTypes.SubAccountIdentifier{
+			Address: StakedSubAccount,
+			Metadata: map[string]interface{}{
+				ValidatorMetadataKey: validator,
+			},
+		},
+	}
+}
+
+// createEraRewardsTransaction returns the synthetic transaction
+// crediting the seigniorage allocations of the era ended by block,
+// or nil if block is not a switch block.
+func (ec *Client) createEraRewardsTransaction(
+	ctx context.Context,
+	block *rpc.Block,
+) (*RosettaTypes.Transaction, error) {
+	if block.Header.EraEnd == nil {
+		return nil, nil
+	}
+
+	strategy, err := strategyFor(block.Header.ProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	eraSummary, err := strategy.eraSummary(ctx, ec, block)
+	if err != nil {
+		return nil, err
+	}
+	if eraSummary.StoredValue.EraInfo == nil {
+		return nil, fmt.Errorf("no era info for switch block %s", block.Hash)
+	}
+
+	allocations := eraSummary.StoredValue.EraInfo.SeigniorageAllocations
+	operations := make([]*RosettaTypes.Operation, 0, len(allocations))
+	for i, allocation := range allocations {
+		var account *RosettaTypes.AccountIdentifier
+		var amount string
+		switch {
+		case allocation.Validator != nil:
+			account = StakedAccount(
+				allocation.Validator.ValidatorPublicKey,
+				allocation.Validator.ValidatorPublicKey,
+			)
+			amount = allocation.Validator.Amount
+		case allocation.Delegator != nil:
+			account = StakedAccount(
+				allocation.Delegator.DelegatorPublicKey,
+				allocation.Delegator.ValidatorPublicKey,
+			)
+			amount = allocation.Delegator.Amount
+		default:
+			return nil, fmt.Errorf("invalid seigniorage allocation in era %d", eraSummary.EraID)
+		}
+
+		operations = append(operations, &RosettaTypes.Operation{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: int64(i),
+			},
+			Type:    RewardOpType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: account,
+			Amount: &RosettaTypes.Amount{
+				Value:    amount,
+				Currency: Currency,
+			},
+			Metadata: map[string]interface{}{
+				EraIDMetadataKey: eraSummary.EraID,
+			},
+		})
+	}
+
+	return &RosettaTypes.Transaction{
+		TransactionIdentifier: &RosettaTypes.TransactionIdentifier{
+			Hash: EraRewardsTransactionHash(block.Hash),
+		},
+		Operations: operations,
+		Metadata: map[string]interface{}{
+			EraIDMetadataKey: eraSummary.EraID,
+		},
+	}, nil
+}
+
+// stakedBalance returns the amount staked by the account at
+// the provided block, as recorded by the auction contract.
+func (ec *Client) stakedBalance(
+	ctx context.Context,
+	account *RosettaTypes.AccountIdentifier,
+	block *rpc.Block,
+) (*big.Int, error) {
+	validator, ok := account.SubAccount.Metadata[ValidatorMetadataKey].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s is missing from the sub account metadata", ValidatorMetadataKey)
+	}
+	validatorKey, err := address.ParsePublicKey(validator)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := accountHash(account.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	auctionState, err := ec.node.GetAuctionInfo(ctx, rpc.BlockByHash(block.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get auction info", err)
+	}
+
+	staked := "0"
+	for _, bid := range auctionState.Bids {
+		if !strings.EqualFold(bid.PublicKey, validatorKey.String()) {
+			continue
+		}
+
+		if validatorKey.AccountHash().String() == hash {
+			staked = bid.Bid.StakedAmount
+			break
+		}
+
+		for _, delegator := range bid.Bid.Delegators {
+			if publicKeyAccount(delegator.PublicKey) == hash {
+				staked = delegator.StakedAmount
+				break
+			}
+		}
+	}
+
+	balance, ok := new(big.Int).SetString(staked, 10) // nolint:gomnd
+	if !ok {
+		return nil, fmt.Errorf("invalid staked amount %s", staked)
+	}
+
+	return balance, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+func TestBlockEraRewards(t *testing.T) {
+	validator := testPublicKey(0xa1)
+	delegator := testPublicKey(0xa2)
+	eraInfo := &rpc.EraInfo{SeigniorageAllocations: []rpc.SeigniorageAllocation{
+		{Validator: &rpc.ValidatorAllocation{ValidatorPublicKey: validator, Amount: "1000"}},
+		{Delegator: &rpc.DelegatorAllocation{
+			DelegatorPublicKey: delegator,
+			ValidatorPublicKey: validator,
+			Amount:             "200",
+		}},
+	}}
+
+	tests := map[string]struct {
+		eraSummary *rpc.EraSummary
+		err        bool
+	}{
+		"era info": {
+			eraSummary: &rpc.EraSummary{EraID: 2, StoredValue: rpc.StoredValue{EraInfo: eraInfo}},
+		},
+		"missing era info": {
+			err: true,
+		},
+		"era summary without era info": {
+			eraSummary: &rpc.EraSummary{EraID: 2},
+			err:        true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			node, blocks := unbondingChain("1.4.0")
+			block := blocks[6]
+			node.addAccount(block.Header.StateRootHash, testPublicKey(0xa0), testPurse(0xc0))
+			node.auctions[blocks[1].Hash] = &rpc.AuctionState{}
+			node.auctions[blocks[5].Hash] = &rpc.AuctionState{}
+			if test.eraSummary != nil {
+				node.eraSummaries[block.Hash] = test.eraSummary
+			}
+
+			client := newTestClient(t, node, nil)
+			index := int64(block.Header.Height)
+			rosBlock, err := client.Block(context.Background(), &RosettaTypes.PartialBlockIdentifier{Index: &index})
+			if test.err {
+				if err == nil || !strings.Contains(err.Error(), "era info") {
+					t.Fatalf("error %v, want a missing era info error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(rosBlock.Transactions) != 1 {
+				t.Fatalf("%d transactions, want 1", len(rosBlock.Transactions))
+			}
+			transaction := rosBlock.Transactions[0]
+			if hash := transaction.TransactionIdentifier.Hash; hash != EraRewardsTransactionHash(block.Hash) {
+				t.Fatalf("transaction %s, want %s", hash, EraRewardsTransactionHash(block.Hash))
+			}
+
+			accounts := []*RosettaTypes.AccountIdentifier{}
+			amounts := []string{}
+			for _, operation := range transaction.Operations {
+				if operation.Type != RewardOpType {
+					t.Fatalf("operation type %s, want %s", operation.Type, RewardOpType)
+				}
+				accounts = append(accounts, operation.Account)
+				amounts = append(amounts, operation.Amount.Value)
+			}
+			wantAccounts := []*RosettaTypes.AccountIdentifier{
+				StakedAccount(validator, validator),
+				StakedAccount(delegator, validator),
+			}
+			if !reflect.DeepEqual(accounts, wantAccounts) {
+				t.Fatalf("accounts %s, want %s", RosettaTypes.PrintStruct(accounts), RosettaTypes.PrintStruct(wantAccounts))
+			}
+			if want := []string{"1000", "200"}; !reflect.DeepEqual(amounts, want) {
+				t.Fatalf("amounts %v, want %v", amounts, want)
+			}
+		})
+	}
+}
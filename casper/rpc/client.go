@@ -0,0 +1,448 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// maxEndpointHeightLag is the number of blocks an endpoint
+	// may trail the highest endpoint before it is skipped.
+	maxEndpointHeightLag = int64(3) // nolint:gomnd
+
+	// endpointRefreshInterval is the minimum duration between
+	// two height checks of the endpoints.
+	endpointRefreshInterval = 10 * time.Second
+)
+
+// endpoint is a single casper-node RPC endpoint.
+type endpoint struct {
+	url       string
+	transport *rpcTransport
+}
+
+// Client is a casper-node JSON-RPC client backed by an ordered
+// list of endpoints. Requests are sent to the active endpoint and
+// fail over to the next ones on transport errors. The first healthy,
+// up-to-date endpoint is preferred whenever heights are checked.
+type Client struct {
+	endpoints []*endpoint
+
+	mu          sync.Mutex
+	active      int
+	lastRefresh time.Time
+}
+
+// NewClient creates a Client from the provided
+// urls, in priority order.
+func NewClient(urls []string) (*Client, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no node endpoint provided")
+	}
+
+	endpoints := make([]*endpoint, len(urls))
+	for i, u := range urls {
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return nil, err
+		}
+
+		endpoints[i] = &endpoint{
+			url:       u,
+			transport: newRPCTransport(u),
+		}
+	}
+
+	return &Client{endpoints: endpoints}, nil
+}
+
+func (p *Client) current() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.active
+}
+
+func (p *Client) setActive(index int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.active != index {
+		log.Printf("switching node endpoint to %s", p.endpoints[index].url)
+	}
+	p.active = index
+}
+
+// do runs fn against the active endpoint and then against
+// the following ones, in order, as long as fn returns
+// a retriable error.
+func (p *Client) do(ctx context.Context, fn func(*rpcTransport) error) error {
+	start := p.current()
+
+	var err error
+	for i := 0; i < len(p.endpoints); i++ {
+		index := (start + i) % len(p.endpoints)
+		err = fn(p.endpoints[index].transport)
+		if err == nil || !IsRetriable(err) {
+			p.setActive(index)
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		log.Printf("node endpoint %s failed: %s", p.endpoints[index].url, err.Error())
+	}
+
+	return err
+}
+
+// call sends a request through the pool. The endpoints are
+// refreshed first if the method is height sensitive. Idempotent
+// methods are retried with a jittered backoff as long as the
+// error is retriable and ctx is not done.
+func (p *Client) call(
+	ctx context.Context,
+	method string,
+	params interface{},
+	result interface{},
+) error {
+	if heightSensitiveMethods[method] {
+		p.Refresh(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := p.do(ctx, func(t *rpcTransport) error {
+			return t.call(ctx, method, params, result)
+		})
+		if err == nil || !IsRetriable(err) || !idempotentMethods[method] || attempt >= maxRPCAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff(attempt)):
+		}
+	}
+}
+
+// Refresh checks the height of every endpoint and activates
+// the first one that answers and is not behind the others
+// by more than maxEndpointHeightLag. It does nothing if the
+// last check is more recent than endpointRefreshInterval.
+func (p *Client) Refresh(ctx context.Context) {
+	p.mu.Lock()
+	if time.Since(p.lastRefresh) < endpointRefreshInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastRefresh = time.Now()
+	p.mu.Unlock()
+
+	if len(p.endpoints) == 1 {
+		return
+	}
+
+	heights := make([]int64, len(p.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range p.endpoints {
+		wg.Add(1)
+		go func(i int, e *endpoint) {
+			defer wg.Done()
+
+			heights[i] = -1
+			var result blockResult
+			if err := e.transport.call(ctx, "chain_get_block", nil, &result); err != nil {
+				log.Printf("node endpoint %s failed: %s", e.url, err.Error())
+				return
+			}
+			if result.Block != nil {
+				heights[i] = int64(result.Block.Header.Height)
+			}
+		}(i, e)
+	}
+	wg.Wait()
+
+	maxHeight := int64(-1)
+	for _, height := range heights {
+		if height > maxHeight {
+			maxHeight = height
+		}
+	}
+	if maxHeight < 0 {
+		return
+	}
+
+	for i, height := range heights {
+		if height >= 0 && maxHeight-height <= maxEndpointHeightLag {
+			p.setActive(i)
+			return
+		}
+	}
+}
+
+// GetStatus calls info_get_status.
+func (p *Client) GetStatus(ctx context.Context) (*StatusResult, error) {
+	var result StatusResult
+	if err := p.call(ctx, "info_get_status", nil, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetPeers calls info_get_peers.
+func (p *Client) GetPeers(ctx context.Context) ([]Peer, error) {
+	var result PeersResult
+	if err := p.call(ctx, "info_get_peers", nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Peers, nil
+}
+
+// GetBlock calls chain_get_block. A nil blockIdentifier
+// selects the latest block.
+func (p *Client) GetBlock(ctx context.Context, blockIdentifier *BlockIdentifier) (*Block, error) {
+	var result blockResult
+	err := p.call(ctx, "chain_get_block", newBlockParams(blockIdentifier), &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Block == nil && result.BlockWithSignatures != nil {
+		result.Block, err = result.BlockWithSignatures.block()
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid block", err)
+		}
+	}
+	if result.Block == nil {
+		return nil, notFound("block")
+	}
+
+	return result.Block, nil
+}
+
+// GetBlockTransfers calls chain_get_block_transfers. A nil
+// blockIdentifier selects the latest block.
+func (p *Client) GetBlockTransfers(ctx context.Context, blockIdentifier *BlockIdentifier) ([]*Transfer, error) {
+	var result blockTransfersResult
+	err := p.call(ctx, "chain_get_block_transfers", newBlockParams(blockIdentifier), &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Transfers, nil
+}
+
+// GetDeploy calls info_get_deploy.
+func (p *Client) GetDeploy(ctx context.Context, hash string) (*DeployResult, error) {
+	var result DeployResult
+	if err := p.call(ctx, "info_get_deploy", map[string]string{"deploy_hash": hash}, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetTransaction calls info_get_transaction,
+// available from protocol version 2.0.
+func (p *Client) GetTransaction(ctx context.Context, hash TransactionHash) (*TransactionResult, error) {
+	var result TransactionResult
+	err := p.call(ctx, "info_get_transaction", &getTransactionParams{TransactionHash: hash}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetStateItem calls state_get_item.
+func (p *Client) GetStateItem(
+	ctx context.Context,
+	stateRootHash string,
+	key string,
+	path []string,
+) (*StoredValue, error) {
+	if path == nil {
+		path = []string{}
+	}
+
+	var result storedValueResult
+	err := p.call(ctx, "state_get_item", &stateGetItemParams{
+		StateRootHash: stateRootHash,
+		Key:           key,
+		Path:          path,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.StoredValue == nil {
+		return nil, notFound(key)
+	}
+
+	return result.StoredValue, nil
+}
+
+// QueryGlobalState calls query_global_state.
+func (p *Client) QueryGlobalState(
+	ctx context.Context,
+	stateIdentifier *StateIdentifier,
+	key string,
+	path []string,
+) (*StoredValue, error) {
+	if path == nil {
+		path = []string{}
+	}
+
+	var result queryGlobalStateResult
+	err := p.call(ctx, "query_global_state", &queryGlobalStateParams{
+		StateIdentifier: stateIdentifier,
+		Key:             key,
+		Path:            path,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.StoredValue == nil {
+		return nil, notFound(key)
+	}
+
+	return result.StoredValue, nil
+}
+
+// GetBalance calls state_get_balance.
+func (p *Client) GetBalance(ctx context.Context, stateRootHash string, purseURef string) (*big.Int, error) {
+	var result getBalanceResult
+	err := p.call(ctx, "state_get_balance", &getBalanceParams{
+		StateRootHash: stateRootHash,
+		PurseURef:     purseURef,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, ok := new(big.Int).SetString(result.BalanceValue, 10) // nolint:gomnd
+	if !ok {
+		return nil, fmt.Errorf("invalid balance %s", result.BalanceValue)
+	}
+
+	return balance, nil
+}
+
+// QueryBalance calls query_balance, available
+// from protocol version 1.5.0.
+func (p *Client) QueryBalance(
+	ctx context.Context,
+	stateIdentifier *StateIdentifier,
+	purseIdentifier *PurseIdentifier,
+) (*big.Int, error) {
+	var result queryBalanceResult
+	err := p.call(ctx, "query_balance", &queryBalanceParams{
+		StateIdentifier: stateIdentifier,
+		PurseIdentifier: purseIdentifier,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, ok := new(big.Int).SetString(result.Balance, 10) // nolint:gomnd
+	if !ok {
+		return nil, fmt.Errorf("invalid balance %s", result.Balance)
+	}
+
+	return balance, nil
+}
+
+// PutDeploy calls account_put_deploy with the JSON
+// encoded deploy and returns the deploy hash.
+func (p *Client) PutDeploy(ctx context.Context, deploy json.RawMessage) (string, error) {
+	var result putDeployResult
+	if err := p.call(ctx, "account_put_deploy", &putDeployParams{Deploy: deploy}, &result); err != nil {
+		return "", err
+	}
+
+	return result.DeployHash, nil
+}
+
+// GetAuctionInfo calls state_get_auction_info. A nil
+// blockIdentifier selects the latest block.
+func (p *Client) GetAuctionInfo(ctx context.Context, blockIdentifier *BlockIdentifier) (*AuctionState, error) {
+	var result auctionInfoResult
+	err := p.call(ctx, "state_get_auction_info", newBlockParams(blockIdentifier), &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.AuctionState == nil {
+		return nil, notFound("auction state")
+	}
+
+	return result.AuctionState, nil
+}
+
+// GetEraInfoBySwitchBlock calls chain_get_era_info_by_switch_block.
+// It returns a nil *EraSummary if the block is not a switch block.
+func (p *Client) GetEraInfoBySwitchBlock(
+	ctx context.Context,
+	blockIdentifier *BlockIdentifier,
+) (*EraSummary, error) {
+	var result eraInfoResult
+	err := p.call(ctx, "chain_get_era_info_by_switch_block", newBlockParams(blockIdentifier), &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.EraSummary, nil
+}
+
+// GetEraSummary calls chain_get_era_summary, available
+// from protocol version 1.5.0.
+func (p *Client) GetEraSummary(
+	ctx context.Context,
+	blockIdentifier *BlockIdentifier,
+) (*EraSummary, error) {
+	var result eraInfoResult
+	err := p.call(ctx, "chain_get_era_summary", newBlockParams(blockIdentifier), &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.EraSummary == nil {
+		return nil, notFound("era summary")
+	}
+
+	return result.EraSummary, nil
+}
+
+// GetChainspec calls info_get_chainspec and returns the
+// raw chainspec files of the network.
+func (p *Client) GetChainspec(ctx context.Context) (*ChainspecRawBytes, error) {
+	var result chainspecResult
+	if err := p.call(ctx, "info_get_chainspec", nil, &result); err != nil {
+		return nil, err
+	}
+	if result.ChainspecBytes == nil {
+		return nil, notFound("chainspec")
+	}
+
+	return result.ChainspecBytes, nil
+}
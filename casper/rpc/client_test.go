@@ -0,0 +1,123 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newNodeServer returns a server answering chain_get_block with
+// a block at height and counting the requests of each method.
+func newNodeServer(t *testing.T, height uint64, calls map[string]*int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid request: %s", err)
+			return
+		}
+		if counter, ok := calls[request.Method]; ok {
+			atomic.AddInt64(counter, 1)
+		}
+
+		result := "{}"
+		switch request.Method {
+		case "chain_get_block":
+			result = fmt.Sprintf(`{"block":{"hash":"%d","header":{"height":%d}}}`, height, height)
+		case "state_get_auction_info":
+			result = fmt.Sprintf(`{"auction_state":{"block_height":%d}}`, height)
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":%s}`, request.ID, result)
+	}))
+}
+
+func TestRefreshBeforeHeightSensitiveCalls(t *testing.T) {
+	tests := map[string]struct {
+		call   func(*Client) (uint64, error)
+		height uint64
+	}{
+		"latest block": {
+			call: func(c *Client) (uint64, error) {
+				block, err := c.GetBlock(context.Background(), nil)
+				if err != nil {
+					return 0, err
+				}
+				return block.Header.Height, nil
+			},
+			height: 100,
+		},
+		"auction info": {
+			call: func(c *Client) (uint64, error) {
+				state, err := c.GetAuctionInfo(context.Background(), nil)
+				if err != nil {
+					return 0, err
+				}
+				return state.BlockHeight, nil
+			},
+			height: 100,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			lagging := newNodeServer(t, 10, nil)
+			defer lagging.Close()
+			current := newNodeServer(t, 100, nil)
+			defer current.Close()
+
+			client, err := NewClient([]string{lagging.URL, current.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			height, err := test.call(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if height != test.height {
+				t.Fatalf("height %d, want %d", height, test.height)
+			}
+		})
+	}
+}
+
+func TestNoRefreshBeforeOtherCalls(t *testing.T) {
+	var blockCalls int64
+	calls := map[string]*int64{"chain_get_block": &blockCalls}
+	first := newNodeServer(t, 10, calls)
+	defer first.Close()
+	second := newNodeServer(t, 100, calls)
+	defer second.Close()
+
+	client, err := NewClient([]string{first.URL, second.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetPeers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if blockCalls != 0 {
+		t.Fatalf("%d height checks before info_get_peers, want 0", blockCalls)
+	}
+	if client.current() != 0 {
+		t.Fatalf("active endpoint %d, want 0", client.current())
+	}
+}
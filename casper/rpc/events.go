@@ -0,0 +1,142 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// eventsReconnectDelay is the delay before reconnecting
+	// to the event stream after it is closed.
+	eventsReconnectDelay = 5 * time.Second
+
+	// maxEventSize is the maximum size of a streamed event.
+	maxEventSize = 1 << 20 // nolint:gomnd
+)
+
+// FinalitySignature is a signature of a block by a validator,
+// as streamed by the node. BlockHeight and ChainNameHash are
+// only set by protocol versions 2.x.
+type FinalitySignature struct {
+	BlockHash     string  `json:"block_hash"`
+	BlockHeight   *uint64 `json:"block_height,omitempty"`
+	EraID         uint64  `json:"era_id"`
+	ChainNameHash *string `json:"chain_name_hash,omitempty"`
+	Signature     string  `json:"signature"`
+	PublicKey     string  `json:"public_key"`
+}
+
+type finalitySignatureV1 FinalitySignature
+
+// UnmarshalJSON decodes a FinalitySignature from a 1.x event
+// or from a versioned 2.x event.
+func (s *FinalitySignature) UnmarshalJSON(data []byte) error {
+	var versioned struct {
+		V1 *finalitySignatureV1 `json:"V1"`
+		V2 *finalitySignatureV1 `json:"V2"`
+	}
+	if err := json.Unmarshal(data, &versioned); err != nil {
+		return err
+	}
+
+	switch {
+	case versioned.V2 != nil:
+		*s = FinalitySignature(*versioned.V2)
+	case versioned.V1 != nil:
+		*s = FinalitySignature(*versioned.V1)
+	default:
+		var v1 finalitySignatureV1
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return err
+		}
+		*s = FinalitySignature(v1)
+	}
+
+	return nil
+}
+
+type streamedEvent struct {
+	FinalitySignature *FinalitySignature `json:"FinalitySignature"`
+}
+
+// StreamFinalitySignatures reads the server-sent events of the node
+// event stream at url and calls handler with every finality signature.
+// It reconnects when the stream is closed and returns when ctx is done.
+func StreamFinalitySignatures(ctx context.Context, url string, handler func(*FinalitySignature)) error {
+	for {
+		err := streamEvents(ctx, url, func(data []byte) {
+			var event streamedEvent
+			if err := json.Unmarshal(data, &event); err != nil || event.FinalitySignature == nil {
+				// Other events, such as the API version.
+				return
+			}
+			handler(event.FinalitySignature)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("event stream %s closed: %v", url, err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(eventsReconnectDelay):
+		}
+	}
+}
+
+// streamEvents calls handler with the data of every
+// event streamed from url, until the stream is closed.
+func streamEvents(ctx context.Context, url string, handler func([]byte)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	dataPrefix := []byte("data:")
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxEventSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if bytes.HasPrefix(line, dataPrefix) {
+			handler(bytes.TrimSpace(bytes.TrimPrefix(line, dataPrefix)))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return errors.New("end of stream")
+}
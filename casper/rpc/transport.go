@@ -0,0 +1,253 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultRPCTimeout is the timeout of node calls
+	// without an entry in rpcTimeouts.
+	defaultRPCTimeout = 30 * time.Second
+
+	// maxRPCAttempts is the maximum number of attempts
+	// of an idempotent node call.
+	maxRPCAttempts = 4 // nolint:gomnd
+
+	// rpcBackoffBase is the base delay between two
+	// attempts of an idempotent node call. It doubles
+	// on every attempt and is jittered.
+	rpcBackoffBase = 250 * time.Millisecond
+
+	// rpcBackoffMax is the maximum delay between two
+	// attempts of an idempotent node call.
+	rpcBackoffMax = 4 * time.Second
+)
+
+var (
+	// rpcTimeouts are the per-method timeouts of node calls.
+	rpcTimeouts = map[string]time.Duration{
+		"info_get_status":           5 * time.Second,
+		"info_get_peers":            5 * time.Second,
+		"chain_get_block":           10 * time.Second,
+		"chain_get_block_transfers": 10 * time.Second,
+		"info_get_deploy":           10 * time.Second,
+		"info_get_transaction":      10 * time.Second,
+		"state_get_item":            10 * time.Second,
+		"state_get_balance":         5 * time.Second,
+		"query_balance":             5 * time.Second,
+		"query_global_state":        10 * time.Second,
+		"account_put_deploy":        10 * time.Second,
+
+		"chain_get_era_info_by_switch_block": 10 * time.Second,
+		"chain_get_era_summary":              10 * time.Second,
+	}
+
+	// idempotentMethods are the node calls that are
+	// safe to retry.
+	idempotentMethods = map[string]bool{
+		"chain_get_block":           true,
+		"chain_get_block_transfers": true,
+		"info_get_deploy":           true,
+		"info_get_transaction":      true,
+		"query_balance":             true,
+		"state_get_item":            true,
+		"state_get_balance":         true,
+		"state_get_auction_info":    true,
+		"info_get_chainspec":        true,
+	}
+
+	// heightSensitiveMethods are the node calls whose result
+	// depends on the height of the endpoint. The endpoints are
+	// refreshed before they are sent.
+	heightSensitiveMethods = map[string]bool{
+		"info_get_status":           true,
+		"chain_get_block":           true,
+		"chain_get_block_transfers": true,
+		"state_get_auction_info":    true,
+	}
+)
+
+// RPCError is returned when a node call fails. Retriable
+// is set when the same call may succeed later (the node was
+// unreachable, overloaded or timed out).
+type RPCError struct {
+	Method    string
+	Code      int
+	Retriable bool
+	Err       error
+}
+
+func (e *RPCError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s failed with code %d: %s", e.Method, e.Code, e.Err.Error())
+	}
+
+	return fmt.Sprintf("%s failed: %s", e.Method, e.Err.Error())
+}
+
+func (e *RPCError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetriable returns true if err was returned by a
+// node call that may succeed if attempted again.
+func IsRetriable(err error) bool {
+	var rpcErr *RPCError
+	return errors.As(err, &rpcErr) && rpcErr.Retriable
+}
+
+type rpcRequest struct {
+	Version string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// rpcTransport sends JSON-RPC requests to a single
+// casper-node endpoint.
+type rpcTransport struct {
+	url        string
+	httpClient *http.Client
+}
+
+func newRPCTransport(url string) *rpcTransport {
+	return &rpcTransport{
+		url:        url,
+		httpClient: &http.Client{},
+	}
+}
+
+// call sends a single request, bounded by the method timeout,
+// and unmarshals its result into result.
+func (t *rpcTransport) call(
+	ctx context.Context,
+	method string,
+	params interface{},
+	result interface{},
+) error {
+	timeout, ok := rpcTimeouts[method]
+	if !ok {
+		timeout = defaultRPCTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(&rpcRequest{
+		Version: "2.0",
+		ID:      time.Now().UnixNano(),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return &RPCError{Method: method, Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return &RPCError{Method: method, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return &RPCError{Method: method, Retriable: isRetriableTransportError(err), Err: err}
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &RPCError{Method: method, Retriable: isRetriableTransportError(err), Err: err}
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return &RPCError{
+			Method: method,
+			Retriable: resp.StatusCode >= http.StatusInternalServerError ||
+				resp.StatusCode == http.StatusTooManyRequests,
+			Err: fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(b)),
+		}
+	}
+
+	var rpcResp rpcResponse
+	if err := json.Unmarshal(b, &rpcResp); err != nil {
+		return &RPCError{Method: method, Err: fmt.Errorf("%w: unable to parse response", err)}
+	}
+
+	if rpcResp.Error != nil {
+		return &RPCError{
+			Method: method,
+			Code:   rpcResp.Error.Code,
+			Err:    errors.New(rpcResp.Error.Message),
+		}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+		return &RPCError{Method: method, Err: fmt.Errorf("%w: unable to parse result", err)}
+	}
+
+	return nil
+}
+
+// isRetriableTransportError returns true if err was caused by the
+// endpoint being unreachable or slow. Errors caused by the
+// cancellation of the caller context are not retriable.
+func isRetriableTransportError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// backoff returns the jittered delay before the provided
+// attempt (starting at 1) of a node call.
+func backoff(attempt int) time.Duration {
+	delay := rpcBackoffBase << uint(attempt-1)
+	if delay > rpcBackoffMax {
+		delay = rpcBackoffMax
+	}
+
+	// Full jitter between half the delay and the delay.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)) // nolint:gosec
+}
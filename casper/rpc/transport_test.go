@@ -0,0 +1,248 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFailingServer returns a server counting its requests and
+// answering them with handle.
+func newFailingServer(
+	t *testing.T,
+	calls *int64,
+	handle func(w http.ResponseWriter, r *http.Request, request *rpcRequest),
+) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid request: %s", err)
+			return
+		}
+		atomic.AddInt64(calls, 1)
+		handle(w, r, &request)
+	}))
+}
+
+// setTimeout sets the timeout of method for the duration of t.
+func setTimeout(t *testing.T, method string, timeout time.Duration) {
+	previous, ok := rpcTimeouts[method]
+	rpcTimeouts[method] = timeout
+	t.Cleanup(func() {
+		if ok {
+			rpcTimeouts[method] = previous
+		} else {
+			delete(rpcTimeouts, method)
+		}
+	})
+}
+
+func unavailable(w http.ResponseWriter, r *http.Request, request *rpcRequest) {
+	http.Error(w, "overloaded", http.StatusServiceUnavailable)
+}
+
+func TestRetriableErrorsAreRetried(t *testing.T) {
+	tests := map[string]struct {
+		method  string
+		handle  func(w http.ResponseWriter, r *http.Request, request *rpcRequest)
+		timeout time.Duration
+	}{
+		"server error": {
+			method: "info_get_deploy",
+			handle: unavailable,
+		},
+		"block transfers": {
+			method: "chain_get_block_transfers",
+			handle: unavailable,
+		},
+		"auction info": {
+			method: "state_get_auction_info",
+			handle: unavailable,
+		},
+		"too many requests": {
+			method: "state_get_item",
+			handle: func(w http.ResponseWriter, r *http.Request, request *rpcRequest) {
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+			},
+		},
+		"timeout": {
+			method: "info_get_deploy",
+			handle: func(w http.ResponseWriter, r *http.Request, request *rpcRequest) {
+				<-r.Context().Done()
+			},
+			timeout: 20 * time.Millisecond,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if test.timeout > 0 {
+				setTimeout(t, test.method, test.timeout)
+			}
+
+			var calls int64
+			server := newFailingServer(t, &calls, test.handle)
+			defer server.Close()
+			client, err := NewClient([]string{server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = client.call(context.Background(), test.method, nil, nil)
+			if !IsRetriable(err) {
+				t.Fatalf("error %v is not retriable", err)
+			}
+			if calls != maxRPCAttempts {
+				t.Fatalf("%d attempts, want %d", calls, maxRPCAttempts)
+			}
+		})
+	}
+}
+
+func TestRetriedCallSucceeds(t *testing.T) {
+	var calls int64
+	server := newFailingServer(t, &calls, func(w http.ResponseWriter, r *http.Request, request *rpcRequest) {
+		if atomic.LoadInt64(&calls) < 2 {
+			unavailable(w, r, request)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":{"deploy":null}}`, request.ID)
+	})
+	defer server.Close()
+	client, err := NewClient([]string{server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetDeploy(context.Background(), "deploy"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("%d attempts, want 2", calls)
+	}
+}
+
+func TestNonRetriableErrorsAreNotRetried(t *testing.T) {
+	tests := map[string]struct {
+		method string
+		handle func(w http.ResponseWriter, r *http.Request, request *rpcRequest)
+		// retriable is set if the error may succeed
+		// later, even if the method is not retried.
+		retriable bool
+	}{
+		"non idempotent method": {
+			method:    "account_put_deploy",
+			handle:    unavailable,
+			retriable: true,
+		},
+		"rpc error": {
+			method: "info_get_deploy",
+			handle: func(w http.ResponseWriter, r *http.Request, request *rpcRequest) {
+				fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"error":{"code":-32000,"message":"no such deploy"}}`, request.ID)
+			},
+		},
+		"client error": {
+			method: "info_get_deploy",
+			handle: func(w http.ResponseWriter, r *http.Request, request *rpcRequest) {
+				http.Error(w, "bad request", http.StatusBadRequest)
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var calls int64
+			server := newFailingServer(t, &calls, test.handle)
+			defer server.Close()
+			client, err := NewClient([]string{server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = client.call(context.Background(), test.method, nil, nil)
+			if err == nil {
+				t.Fatal("call succeeded")
+			}
+			if IsRetriable(err) != test.retriable {
+				t.Fatalf("error %v retriable %t, want %t", err, IsRetriable(err), test.retriable)
+			}
+			if calls != 1 {
+				t.Fatalf("%d attempts, want 1", calls)
+			}
+		})
+	}
+}
+
+func TestCanceledCallIsNotRetried(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int64
+	server := newFailingServer(t, &calls, func(w http.ResponseWriter, r *http.Request, request *rpcRequest) {
+		cancel()
+		<-r.Context().Done()
+	})
+	defer server.Close()
+	client, err := NewClient([]string{server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = client.call(ctx, "info_get_deploy", nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error %v, want %v", err, context.Canceled)
+	}
+	if IsRetriable(err) {
+		t.Fatalf("error %v is retriable", err)
+	}
+	if calls != 1 {
+		t.Fatalf("%d attempts, want 1", calls)
+	}
+	if elapsed := time.Since(start); elapsed >= rpcBackoffBase/2 {
+		t.Fatalf("canceled call returned after %s", elapsed)
+	}
+}
+
+func TestCanceledBackoffStopsRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int64
+	server := newFailingServer(t, &calls, func(w http.ResponseWriter, r *http.Request, request *rpcRequest) {
+		unavailable(w, r, request)
+		cancel()
+	})
+	defer server.Close()
+	client, err := NewClient([]string{server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.call(ctx, "info_get_deploy", nil, nil); err == nil {
+		t.Fatal("call succeeded")
+	}
+	if calls != 1 {
+		t.Fatalf("%d attempts, want 1", calls)
+	}
+}
@@ -0,0 +1,690 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BlockIdentifier selects a block by hash or by height.
+// A nil *BlockIdentifier selects the latest block.
+type BlockIdentifier struct {
+	Hash   *string `json:"Hash,omitempty"`
+	Height *uint64 `json:"Height,omitempty"`
+}
+
+// BlockByHash returns a *BlockIdentifier selecting
+// the block with the provided hash.
+func BlockByHash(hash string) *BlockIdentifier {
+	return &BlockIdentifier{Hash: &hash}
+}
+
+// BlockByHeight returns a *BlockIdentifier selecting
+// the block at the provided height.
+func BlockByHeight(height uint64) *BlockIdentifier {
+	return &BlockIdentifier{Height: &height}
+}
+
+// StateIdentifier selects the global state to query,
+// by block hash or by state root hash.
+type StateIdentifier struct {
+	BlockHash     *string `json:"BlockHash,omitempty"`
+	StateRootHash *string `json:"StateRootHash,omitempty"`
+}
+
+type blockParams struct {
+	BlockIdentifier *BlockIdentifier `json:"block_identifier"`
+}
+
+// newBlockParams returns the params selecting the provided
+// block, or no params at all to select the latest block.
+func newBlockParams(blockIdentifier *BlockIdentifier) interface{} {
+	if blockIdentifier == nil {
+		return nil
+	}
+
+	return &blockParams{BlockIdentifier: blockIdentifier}
+}
+
+// StatusResult is the result of info_get_status.
+type StatusResult struct {
+	APIVersion            string        `json:"api_version"`
+	ChainspecName         string        `json:"chainspec_name"`
+	StartingStateRootHash string        `json:"starting_state_root_hash"`
+	Peers                 []Peer        `json:"peers"`
+	LastAddedBlockInfo    *MinimalBlock `json:"last_added_block_info"`
+	OurPublicSigningKey   string        `json:"our_public_signing_key"`
+	RoundLength           string        `json:"round_length"`
+	NextUpgrade           *NextUpgrade  `json:"next_upgrade"`
+	BuildVersion          string        `json:"build_version"`
+	Uptime                string        `json:"uptime"`
+}
+
+// MinimalBlock is the summary of a block
+// returned by info_get_status.
+type MinimalBlock struct {
+	Hash          string    `json:"hash"`
+	Timestamp     time.Time `json:"timestamp"`
+	EraID         uint64    `json:"era_id"`
+	Height        uint64    `json:"height"`
+	StateRootHash string    `json:"state_root_hash"`
+	Creator       string    `json:"creator"`
+}
+
+// NextUpgrade is a scheduled protocol upgrade.
+type NextUpgrade struct {
+	ActivationPoint json.RawMessage `json:"activation_point"`
+	ProtocolVersion string          `json:"protocol_version"`
+}
+
+// Peer is a node connected to the queried node.
+type Peer struct {
+	NodeID  string `json:"node_id"`
+	Address string `json:"address"`
+}
+
+// PeersResult is the result of info_get_peers.
+type PeersResult struct {
+	APIVersion string `json:"api_version"`
+	Peers      []Peer `json:"peers"`
+}
+
+// Block is a block as returned by chain_get_block.
+type Block struct {
+	Hash   string      `json:"hash"`
+	Header BlockHeader `json:"header"`
+	Body   BlockBody   `json:"body"`
+	Proofs []Proof     `json:"proofs"`
+}
+
+// BlockHeader is the header of a Block.
+type BlockHeader struct {
+	ParentHash      string    `json:"parent_hash"`
+	StateRootHash   string    `json:"state_root_hash"`
+	BodyHash        string    `json:"body_hash"`
+	RandomBit       bool      `json:"random_bit"`
+	AccumulatedSeed string    `json:"accumulated_seed"`
+	EraEnd          *EraEnd   `json:"era_end"`
+	Timestamp       time.Time `json:"timestamp"`
+	EraID           uint64    `json:"era_id"`
+	Height          uint64    `json:"height"`
+	ProtocolVersion string    `json:"protocol_version"`
+}
+
+// EraEnd is present in the header of switch blocks.
+type EraEnd struct {
+	EraReport               EraReport         `json:"era_report"`
+	NextEraValidatorWeights []ValidatorWeight `json:"next_era_validator_weights"`
+}
+
+// EraReport describes the equivocators, rewards and
+// inactive validators of an era.
+type EraReport struct {
+	Equivocators       []string    `json:"equivocators"`
+	Rewards            []EraReward `json:"rewards"`
+	InactiveValidators []string    `json:"inactive_validators"`
+}
+
+// EraReward is the reward of a validator in an EraReport.
+// Amount is in motes.
+type EraReward struct {
+	Validator string `json:"validator"`
+	Amount    string `json:"amount"`
+}
+
+// UnmarshalJSON decodes an EraReward, whose amount
+// is a number in 1.x era reports.
+func (r *EraReward) UnmarshalJSON(data []byte) error {
+	var reward struct {
+		Validator string      `json:"validator"`
+		Amount    json.Number `json:"amount"`
+	}
+	if err := json.Unmarshal(data, &reward); err != nil {
+		return err
+	}
+
+	*r = EraReward{Validator: reward.Validator, Amount: reward.Amount.String()}
+
+	return nil
+}
+
+// ValidatorWeight is the weight of a validator in an era.
+type ValidatorWeight struct {
+	Validator string `json:"validator"`
+	Weight    string `json:"weight"`
+}
+
+// BlockBody is the body of a Block. Blocks produced
+// by protocol versions 2.x list Transactions instead
+// of deploy and transfer hashes.
+type BlockBody struct {
+	Proposer       string            `json:"proposer"`
+	DeployHashes   []string          `json:"deploy_hashes"`
+	TransferHashes []string          `json:"transfer_hashes"`
+	Transactions   []TransactionHash `json:"-"`
+}
+
+// Proof is a finality signature of a Block.
+type Proof struct {
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+type blockResult struct {
+	APIVersion          string               `json:"api_version"`
+	Block               *Block               `json:"block"`
+	BlockWithSignatures *blockWithSignatures `json:"block_with_signatures"`
+}
+
+// Transfer is a transfer record created by the mint.
+// TransactionHash is the DeployHash of 1.x records.
+type Transfer struct {
+	DeployHash      string          `json:"deploy_hash"`
+	TransactionHash TransactionHash `json:"-"`
+	From            string          `json:"from"`
+	To              *string         `json:"to"`
+	Source          string          `json:"source"`
+	Target          string          `json:"target"`
+	Amount          string          `json:"amount"`
+	Gas             string          `json:"gas"`
+	ID              *uint64         `json:"id"`
+}
+
+type blockTransfersResult struct {
+	APIVersion string      `json:"api_version"`
+	BlockHash  string      `json:"block_hash"`
+	Transfers  []*Transfer `json:"transfers"`
+}
+
+// DeployResult is the result of info_get_deploy.
+type DeployResult struct {
+	APIVersion       string                 `json:"api_version"`
+	Deploy           Deploy                 `json:"deploy"`
+	ExecutionResults []BlockExecutionResult `json:"execution_results"`
+}
+
+// Deploy is a deploy as stored by the node.
+type Deploy struct {
+	Hash      string               `json:"hash"`
+	Header    DeployHeader         `json:"header"`
+	Payment   ExecutableDeployItem `json:"payment"`
+	Session   ExecutableDeployItem `json:"session"`
+	Approvals []Approval           `json:"approvals"`
+}
+
+// DeployHeader is the header of a Deploy.
+type DeployHeader struct {
+	Account      string    `json:"account"`
+	Timestamp    time.Time `json:"timestamp"`
+	TTL          string    `json:"ttl"`
+	GasPrice     uint64    `json:"gas_price"`
+	BodyHash     string    `json:"body_hash"`
+	Dependencies []string  `json:"dependencies"`
+	ChainName    string    `json:"chain_name"`
+}
+
+// Approval is a signature of a Deploy.
+type Approval struct {
+	Signer    string `json:"signer"`
+	Signature string `json:"signature"`
+}
+
+// ExecutableDeployItem is the payment or the session of
+// a Deploy. Exactly one of its fields is set.
+type ExecutableDeployItem struct {
+	ModuleBytes                   *ModuleBytes        `json:"ModuleBytes,omitempty"`
+	StoredContractByHash          *StoredContract     `json:"StoredContractByHash,omitempty"`
+	StoredContractByName          *StoredContract     `json:"StoredContractByName,omitempty"`
+	StoredVersionedContractByHash *StoredContract     `json:"StoredVersionedContractByHash,omitempty"`
+	StoredVersionedContractByName *StoredContract     `json:"StoredVersionedContractByName,omitempty"`
+	Transfer                      *TransferDeployItem `json:"Transfer,omitempty"`
+}
+
+// Args returns the runtime arguments of the item.
+func (i *ExecutableDeployItem) Args() RuntimeArgs {
+	switch {
+	case i.ModuleBytes != nil:
+		return i.ModuleBytes.Args
+	case i.Transfer != nil:
+		return i.Transfer.Args
+	case i.StoredContract() != nil:
+		return i.StoredContract().Args
+	}
+
+	return nil
+}
+
+// Kind returns the name of the variant of the item.
+func (i *ExecutableDeployItem) Kind() string {
+	switch {
+	case i.ModuleBytes != nil:
+		return "ModuleBytes"
+	case i.StoredContractByHash != nil:
+		return "StoredContractByHash"
+	case i.StoredContractByName != nil:
+		return "StoredContractByName"
+	case i.StoredVersionedContractByHash != nil:
+		return "StoredVersionedContractByHash"
+	case i.StoredVersionedContractByName != nil:
+		return "StoredVersionedContractByName"
+	case i.Transfer != nil:
+		return "Transfer"
+	}
+
+	return ""
+}
+
+// StoredContract returns the stored contract called by
+// the item, if any.
+func (i *ExecutableDeployItem) StoredContract() *StoredContract {
+	switch {
+	case i.StoredContractByHash != nil:
+		return i.StoredContractByHash
+	case i.StoredContractByName != nil:
+		return i.StoredContractByName
+	case i.StoredVersionedContractByHash != nil:
+		return i.StoredVersionedContractByHash
+	case i.StoredVersionedContractByName != nil:
+		return i.StoredVersionedContractByName
+	}
+
+	return nil
+}
+
+// ModuleBytes is a deploy item running WASM.
+// Empty module bytes are the standard payment.
+type ModuleBytes struct {
+	ModuleBytes string      `json:"module_bytes"`
+	Args        RuntimeArgs `json:"args"`
+}
+
+// StoredContract is a deploy item calling a stored contract
+// by hash or by name, optionally versioned.
+type StoredContract struct {
+	Hash       string      `json:"hash,omitempty"`
+	Name       string      `json:"name,omitempty"`
+	Version    *uint32     `json:"version,omitempty"`
+	EntryPoint string      `json:"entry_point"`
+	Args       RuntimeArgs `json:"args"`
+}
+
+// TransferDeployItem is a native transfer deploy item.
+type TransferDeployItem struct {
+	Args RuntimeArgs `json:"args"`
+}
+
+// CLValue is the JSON representation of a CLValue.
+type CLValue struct {
+	CLType json.RawMessage `json:"cl_type"`
+	Bytes  string          `json:"bytes"`
+	Parsed json.RawMessage `json:"parsed"`
+}
+
+// NamedArg is a runtime argument of a deploy item.
+type NamedArg struct {
+	Name  string
+	Value CLValue
+}
+
+// MarshalJSON encodes a NamedArg as a [name, value] pair.
+func (a NamedArg) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{a.Name, a.Value})
+}
+
+// UnmarshalJSON decodes a NamedArg from a [name, value] pair.
+func (a *NamedArg) UnmarshalJSON(data []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 { // nolint:gomnd
+		return errors.New("named arg must be a [name, value] pair")
+	}
+
+	if err := json.Unmarshal(pair[0], &a.Name); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(pair[1], &a.Value)
+}
+
+// RuntimeArgs are the runtime arguments of a deploy item.
+type RuntimeArgs []NamedArg
+
+// Get returns the argument with the provided name.
+func (args RuntimeArgs) Get(name string) (*CLValue, bool) {
+	for i := range args {
+		if args[i].Name == name {
+			return &args[i].Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// BlockExecutionResult is the result of the
+// execution of a Deploy in a block.
+type BlockExecutionResult struct {
+	BlockHash string          `json:"block_hash"`
+	Result    ExecutionResult `json:"result"`
+}
+
+// ExecutionResult is either a Success
+// or a Failure.
+type ExecutionResult struct {
+	Success *ExecutionOutcome `json:"Success,omitempty"`
+	Failure *ExecutionOutcome `json:"Failure,omitempty"`
+}
+
+// Outcome returns the outcome of the execution,
+// whichever it is.
+func (r *ExecutionResult) Outcome() (*ExecutionOutcome, error) {
+	switch {
+	case r.Success != nil:
+		return r.Success, nil
+	case r.Failure != nil:
+		return r.Failure, nil
+	}
+
+	return nil, errors.New("empty execution result")
+}
+
+// ExecutionOutcome holds the effects, transfers and
+// cost of an execution. ErrorMessage is only set
+// on failures. Executions by protocol versions 2.x
+// hold their TransferRecords instead of transfer keys.
+type ExecutionOutcome struct {
+	Effect          ExecutionEffect `json:"effect"`
+	Transfers       []string        `json:"transfers"`
+	TransferRecords []*Transfer     `json:"-"`
+	Cost            string          `json:"cost"`
+	ErrorMessage    string          `json:"error_message,omitempty"`
+}
+
+// ExecutionEffect are the effects of an execution
+// on the global state.
+type ExecutionEffect struct {
+	Operations []json.RawMessage `json:"operations"`
+	Transforms []TransformEntry  `json:"transforms"`
+}
+
+// TransformEntry is a transform applied to a key.
+type TransformEntry struct {
+	Key       string          `json:"key"`
+	Transform json.RawMessage `json:"transform"`
+}
+
+type stateGetItemParams struct {
+	StateRootHash string   `json:"state_root_hash"`
+	Key           string   `json:"key"`
+	Path          []string `json:"path"`
+}
+
+type storedValueResult struct {
+	APIVersion  string       `json:"api_version"`
+	StoredValue *StoredValue `json:"stored_value"`
+	MerkleProof string       `json:"merkle_proof"`
+}
+
+type queryGlobalStateParams struct {
+	StateIdentifier *StateIdentifier `json:"state_identifier"`
+	Key             string           `json:"key"`
+	Path            []string         `json:"path"`
+}
+
+type queryGlobalStateResult struct {
+	APIVersion  string       `json:"api_version"`
+	BlockHeader *BlockHeader `json:"block_header"`
+	StoredValue *StoredValue `json:"stored_value"`
+	MerkleProof string       `json:"merkle_proof"`
+}
+
+// StoredValue is a value stored in the global state.
+// Exactly one of its fields is set.
+type StoredValue struct {
+	CLValue         *CLValue         `json:"CLValue,omitempty"`
+	Account         *Account         `json:"Account,omitempty"`
+	ContractWasm    *string          `json:"ContractWasm,omitempty"`
+	Contract        *Contract        `json:"Contract,omitempty"`
+	ContractPackage json.RawMessage  `json:"ContractPackage,omitempty"`
+	Transfer        *Transfer        `json:"Transfer,omitempty"`
+	DeployInfo      *DeployInfo      `json:"DeployInfo,omitempty"`
+	EraInfo         *EraInfo         `json:"EraInfo,omitempty"`
+	Bid             *Bid             `json:"Bid,omitempty"`
+	Withdraw        []UnbondingPurse `json:"Withdraw,omitempty"`
+	Unbonding       []UnbondingPurse `json:"Unbonding,omitempty"`
+}
+
+// Account is an account stored in the global state.
+type Account struct {
+	AccountHash      string           `json:"account_hash"`
+	NamedKeys        []NamedKey       `json:"named_keys"`
+	MainPurse        string           `json:"main_purse"`
+	AssociatedKeys   []AssociatedKey  `json:"associated_keys"`
+	ActionThresholds ActionThresholds `json:"action_thresholds"`
+}
+
+// NamedKey is a named key of an account or a contract.
+type NamedKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// AssociatedKey is a key allowed to sign for an account.
+type AssociatedKey struct {
+	AccountHash string `json:"account_hash"`
+	Weight      uint8  `json:"weight"`
+}
+
+// ActionThresholds are the signature thresholds of an account.
+type ActionThresholds struct {
+	Deployment    uint8 `json:"deployment"`
+	KeyManagement uint8 `json:"key_management"`
+}
+
+// Contract is a contract stored in the global state.
+type Contract struct {
+	ContractPackageHash string          `json:"contract_package_hash"`
+	ContractWasmHash    string          `json:"contract_wasm_hash"`
+	NamedKeys           []NamedKey      `json:"named_keys"`
+	EntryPoints         json.RawMessage `json:"entry_points"`
+	ProtocolVersion     string          `json:"protocol_version"`
+}
+
+// DeployInfo is the execution summary of a deploy
+// stored in the global state.
+type DeployInfo struct {
+	DeployHash string   `json:"deploy_hash"`
+	Transfers  []string `json:"transfers"`
+	From       string   `json:"from"`
+	Source     string   `json:"source"`
+	Gas        string   `json:"gas"`
+}
+
+// EraInfo holds the seigniorage allocations of an era.
+type EraInfo struct {
+	SeigniorageAllocations []SeigniorageAllocation `json:"seigniorage_allocations"`
+}
+
+// SeigniorageAllocation is the reward of a validator
+// or of a delegator. Exactly one of its fields is set.
+type SeigniorageAllocation struct {
+	Validator *ValidatorAllocation `json:"Validator,omitempty"`
+	Delegator *DelegatorAllocation `json:"Delegator,omitempty"`
+}
+
+// ValidatorAllocation is the reward of a validator.
+type ValidatorAllocation struct {
+	ValidatorPublicKey string `json:"validator_public_key"`
+	Amount             string `json:"amount"`
+}
+
+// DelegatorAllocation is the reward of a delegator.
+type DelegatorAllocation struct {
+	DelegatorPublicKey string `json:"delegator_public_key"`
+	ValidatorPublicKey string `json:"validator_public_key"`
+	Amount             string `json:"amount"`
+}
+
+// Bid is the bid of a validator and of its delegators.
+type Bid struct {
+	ValidatorPublicKey string          `json:"validator_public_key"`
+	BondingPurse       string          `json:"bonding_purse"`
+	StakedAmount       string          `json:"staked_amount"`
+	DelegationRate     uint8           `json:"delegation_rate"`
+	Inactive           bool            `json:"inactive"`
+	Delegators         []Delegator     `json:"delegators"`
+	VestingSchedule    json.RawMessage `json:"vesting_schedule,omitempty"`
+}
+
+// Delegator is a delegation to a validator.
+type Delegator struct {
+	PublicKey    string `json:"public_key"`
+	StakedAmount string `json:"staked_amount"`
+	BondingPurse string `json:"bonding_purse"`
+	Delegatee    string `json:"delegatee"`
+}
+
+// UnbondingPurse is an amount being unbonded. NewValidator
+// is set when the amount is redelegated once unbonded.
+type UnbondingPurse struct {
+	BondingPurse       string  `json:"bonding_purse"`
+	ValidatorPublicKey string  `json:"validator_public_key"`
+	UnbonderPublicKey  string  `json:"unbonder_public_key"`
+	EraOfCreation      uint64  `json:"era_of_creation"`
+	Amount             string  `json:"amount"`
+	NewValidator       *string `json:"new_validator,omitempty"`
+}
+
+type getBalanceParams struct {
+	StateRootHash string `json:"state_root_hash"`
+	PurseURef     string `json:"purse_uref"`
+}
+
+type getBalanceResult struct {
+	APIVersion   string `json:"api_version"`
+	BalanceValue string `json:"balance_value"`
+	MerkleProof  string `json:"merkle_proof"`
+}
+
+type putDeployParams struct {
+	Deploy json.RawMessage `json:"deploy"`
+}
+
+type putDeployResult struct {
+	APIVersion string `json:"api_version"`
+	DeployHash string `json:"deploy_hash"`
+}
+
+// AuctionState is the state of the auction
+// contract, as returned by state_get_auction_info.
+type AuctionState struct {
+	StateRootHash string          `json:"state_root_hash"`
+	BlockHeight   uint64          `json:"block_height"`
+	EraValidators []EraValidators `json:"era_validators"`
+	Bids          []BidEntry      `json:"bids"`
+}
+
+// EraValidators are the validator weights of an era.
+type EraValidators struct {
+	EraID            uint64                   `json:"era_id"`
+	ValidatorWeights []AuctionValidatorWeight `json:"validator_weights"`
+}
+
+// AuctionValidatorWeight is the weight of a validator
+// in an auction state.
+type AuctionValidatorWeight struct {
+	PublicKey string `json:"public_key"`
+	Weight    string `json:"weight"`
+}
+
+// BidEntry is a bid in an auction state.
+type BidEntry struct {
+	PublicKey string `json:"public_key"`
+	Bid       Bid    `json:"bid"`
+}
+
+type auctionInfoResult struct {
+	APIVersion   string        `json:"api_version"`
+	AuctionState *AuctionState `json:"auction_state"`
+}
+
+// EraSummary is the summary of an era, as returned
+// by chain_get_era_info_by_switch_block.
+type EraSummary struct {
+	BlockHash     string      `json:"block_hash"`
+	EraID         uint64      `json:"era_id"`
+	StoredValue   StoredValue `json:"stored_value"`
+	StateRootHash string      `json:"state_root_hash"`
+	MerkleProof   string      `json:"merkle_proof"`
+}
+
+type eraInfoResult struct {
+	APIVersion string      `json:"api_version"`
+	EraSummary *EraSummary `json:"era_summary"`
+}
+
+// ChainspecRawBytes are the hex encoded chainspec files
+// of the network. The genesis accounts and global state
+// files are optional.
+type ChainspecRawBytes struct {
+	ChainspecBytes            string  `json:"chainspec_bytes"`
+	MaybeGenesisAccountsBytes *string `json:"maybe_genesis_accounts_bytes"`
+	MaybeGlobalStateBytes     *string `json:"maybe_global_state_bytes"`
+}
+
+type chainspecResult struct {
+	APIVersion     string             `json:"api_version"`
+	ChainspecBytes *ChainspecRawBytes `json:"chainspec_bytes"`
+}
+
+// JSON-RPC error codes returned by casper-node
+// for missing items.
+const (
+	ErrorCodeNoSuchDeploy = -32000
+	ErrorCodeNoSuchBlock  = -32001
+	ErrorCodeQueryFailed  = -32003
+)
+
+// ErrNotFound is returned when the requested
+// item does not exist.
+var ErrNotFound = errors.New("not found")
+
+func notFound(what string) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, what)
+}
+
+// IsNotFound returns true if err means that the requested
+// deploy, block or global state value does not exist.
+func IsNotFound(err error) bool {
+	if errors.Is(err, ErrNotFound) {
+		return true
+	}
+
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+
+	switch rpcErr.Code {
+	case ErrorCodeNoSuchDeploy, ErrorCodeNoSuchBlock, ErrorCodeQueryFailed:
+		return true
+	}
+
+	return false
+}
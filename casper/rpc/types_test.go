@@ -0,0 +1,411 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEraRewardUnmarshalJSON(t *testing.T) {
+	const validator = "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c"
+
+	tests := map[string]struct {
+		data    string
+		amount  string
+		invalid bool
+	}{
+		"number": {
+			data:   `{"validator": "` + validator + `", "amount": 1202458594726}`,
+			amount: "1202458594726",
+		},
+		"number above 2^53": {
+			data:   `{"validator": "` + validator + `", "amount": 123456789012345678901234567890}`,
+			amount: "123456789012345678901234567890",
+		},
+		"zero": {
+			data:   `{"validator": "` + validator + `", "amount": 0}`,
+			amount: "0",
+		},
+		"string": {
+			data:   `{"validator": "` + validator + `", "amount": "1202458594726"}`,
+			amount: "1202458594726",
+		},
+		"not a number": {
+			data:    `{"validator": "` + validator + `", "amount": "motes"}`,
+			invalid: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var reward EraReward
+			err := json.Unmarshal([]byte(test.data), &reward)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("decoded %+v", reward)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reward.Validator != validator || reward.Amount != test.amount {
+				t.Fatalf("got %+v, want amount %s", reward, test.amount)
+			}
+		})
+	}
+}
+
+// newFixtureServer returns a server answering every
+// method of results with its result.
+func newFixtureServer(t *testing.T, results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid request: %s", err)
+			return
+		}
+		result, ok := results[request.Method]
+		if !ok {
+			t.Errorf("unexpected method %s", request.Method)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":%s}`, request.ID, result)
+	}))
+}
+
+// Hashes and keys of the 1.x fixtures.
+const (
+	fixtureBlockHash     = "fd1e5e03d4b04c7a9e5b2bc0a4ac0e4bb3e2b1b5d9ad73fd1c86bef56e8a0d5c"
+	fixtureStateRootHash = "d1f17bf3e6a34e07bd0c3b6df6e7a62f8e0cbf6e66e2c8b25b2c3a7f62e5ea3b"
+	fixtureDeployHash    = "af0b8f59b4e4c1f2fd2e0dd0ba9c0e3c4c3d7c5f3a2b8c1e7e4a1f6d9c8b7a65"
+	fixtureProposer      = "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c"
+	fixtureDelegator     = "0203b2f8c0613d2d866948c46e296f09faed9b029110d424d19d488a0c39a811ebbc"
+	fixtureAccountHash   = "account-hash-7f4bf39a311a7538d8c5fd2f6b4f6e4e4e1c5b2f4d6e8a0c2e4f6a8b0c2d4e6f"
+	fixturePurse         = "uref-9c5d4a1e3f2b7c6d8e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d-007"
+)
+
+const blockFixtureV1 = `{
+  "api_version": "1.4.15",
+  "block": {
+    "hash": "` + fixtureBlockHash + `",
+    "header": {
+      "parent_hash": "0b4e6a1bcd9a24ecbe1bd8a7e1d0f1d3fa8f3f6f2e4d7d0cf3a4b1e5c2d7f8a9",
+      "state_root_hash": "` + fixtureStateRootHash + `",
+      "body_hash": "5f6b0b3a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e",
+      "random_bit": true,
+      "accumulated_seed": "3a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b",
+      "era_end": null,
+      "timestamp": "2022-03-01T12:00:00.512Z",
+      "era_id": 3811,
+      "height": 612345,
+      "protocol_version": "1.4.15"
+    },
+    "body": {
+      "proposer": "` + fixtureProposer + `",
+      "deploy_hashes": ["` + fixtureDeployHash + `"],
+      "transfer_hashes": ["c0ffee59b4e4c1f2fd2e0dd0ba9c0e3c4c3d7c5f3a2b8c1e7e4a1f6d9c8b7a65"]
+    },
+    "proofs": [
+      {
+        "public_key": "` + fixtureProposer + `",
+        "signature": "01e5b4c0cf6b1a6f4f5d0e6a3e0c3f1a5b8c2d9e4f7a6b1c0d3e8f5a2b9c4d7e6f1a0b3c8d5e2f9a4b7c6d1e0f3a8b5c2d9e4f7a6b1c0d3e8f5a2b9c4d7e6f10f"
+      }
+    ]
+  }
+}`
+
+const deployFixtureV1 = `{
+  "api_version": "1.4.15",
+  "deploy": {
+    "hash": "` + fixtureDeployHash + `",
+    "header": {
+      "account": "` + fixtureDelegator + `",
+      "timestamp": "2022-03-01T11:59:30.000Z",
+      "ttl": "30m",
+      "gas_price": 1,
+      "body_hash": "4e0a4bd48c3b3b6d5a8f5b6f5d1e2c3b4a5f6e7d8c9b0a1f2e3d4c5b6a7f8e9d",
+      "dependencies": [],
+      "chain_name": "casper"
+    },
+    "payment": {
+      "ModuleBytes": {
+        "module_bytes": "",
+        "args": [["amount", {"cl_type": "U512", "bytes": "0400e1f505", "parsed": "100000000"}]]
+      }
+    },
+    "session": {
+      "StoredContractByName": {
+        "name": "faucet",
+        "entry_point": "call_faucet",
+        "args": [
+          ["target", {"cl_type": {"ByteArray": 32}, "bytes": "7f4bf39a311a7538d8c5fd2f6b4f6e4e4e1c5b2f4d6e8a0c2e4f6a8b0c2d4e6f", "parsed": "7f4bf39a311a7538d8c5fd2f6b4f6e4e4e1c5b2f4d6e8a0c2e4f6a8b0c2d4e6f"}],
+          ["id", {"cl_type": {"Option": "U64"}, "bytes": "00", "parsed": null}]
+        ]
+      }
+    },
+    "approvals": [
+      {
+        "signer": "` + fixtureDelegator + `",
+        "signature": "02c4a3b2e1f0d9c8b7a6f5e4d3c2b1a0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3c2b1a0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1"
+      }
+    ]
+  },
+  "execution_results": [
+    {
+      "block_hash": "` + fixtureBlockHash + `",
+      "result": {
+        "Failure": {
+          "effect": {
+            "operations": [],
+            "transforms": [
+              {"key": "hash-8cf5e4acf51f54eb59291599187838dc3bc234089c46fc6ca8ad17e762ae4401", "transform": "Identity"},
+              {"key": "balance-98d945f5324f865243b7c02c0417ab6eac361c5c56602fd42ced834a1ba201b6", "transform": {"WriteCLValue": {"cl_type": "U512", "bytes": "0400e1f505", "parsed": "100000000"}}},
+              {"key": "balance-fe327f9815a1d016e1143db85e25a86341883949fd75ac1c1e7408a26c5b62ef", "transform": {"AddUInt512": "100000000"}}
+            ]
+          },
+          "transfers": [],
+          "cost": "100000000",
+          "error_message": "ApiError::MissingArgument [2]"
+        }
+      }
+    }
+  ]
+}`
+
+const accountFixtureV1 = `{
+  "api_version": "1.4.15",
+  "stored_value": {
+    "Account": {
+      "account_hash": "` + fixtureAccountHash + `",
+      "named_keys": [{"name": "faucet", "key": "hash-8cf5e4acf51f54eb59291599187838dc3bc234089c46fc6ca8ad17e762ae4401"}],
+      "main_purse": "` + fixturePurse + `",
+      "associated_keys": [{"account_hash": "` + fixtureAccountHash + `", "weight": 1}],
+      "action_thresholds": {"deployment": 1, "key_management": 1}
+    }
+  },
+  "merkle_proof": "01000000"
+}`
+
+const transferFixtureV1 = `{
+  "api_version": "1.4.15",
+  "stored_value": {
+    "Transfer": {
+      "deploy_hash": "` + fixtureDeployHash + `",
+      "from": "` + fixtureAccountHash + `",
+      "to": null,
+      "source": "` + fixturePurse + `",
+      "target": "uref-1f2e3d4c5b6a7f8e9d0c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e7d8c9b0a1f2e-004",
+      "amount": "2500000000",
+      "gas": "0",
+      "id": 42
+    }
+  },
+  "merkle_proof": "01000000"
+}`
+
+const eraInfoFixtureV1 = `{
+  "api_version": "1.4.15",
+  "era_summary": {
+    "block_hash": "` + fixtureBlockHash + `",
+    "era_id": 3811,
+    "stored_value": {
+      "EraInfo": {
+        "seigniorage_allocations": [
+          {"Delegator": {"delegator_public_key": "` + fixtureDelegator + `", "validator_public_key": "` + fixtureProposer + `", "amount": "1254711"}},
+          {"Validator": {"validator_public_key": "` + fixtureProposer + `", "amount": "1202458594726"}}
+        ]
+      }
+    },
+    "state_root_hash": "` + fixtureStateRootHash + `",
+    "merkle_proof": "01000000"
+  }
+}`
+
+func TestDecodeV1Responses(t *testing.T) {
+	server := newFixtureServer(t, map[string]string{
+		"chain_get_block":                    blockFixtureV1,
+		"info_get_deploy":                    deployFixtureV1,
+		"chain_get_era_info_by_switch_block": eraInfoFixtureV1,
+	})
+	defer server.Close()
+	client, err := NewClient([]string{server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("chain_get_block", func(t *testing.T) {
+		block, err := client.GetBlock(ctx, BlockByHeight(612345))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Hash != fixtureBlockHash || block.Header.Height != 612345 || block.Header.EraID != 3811 {
+			t.Fatalf("block %s at height %d of era %d", block.Hash, block.Header.Height, block.Header.EraID)
+		}
+		if block.Header.StateRootHash != fixtureStateRootHash || block.Header.ProtocolVersion != "1.4.15" {
+			t.Fatalf("header %+v", block.Header)
+		}
+		if block.Header.EraEnd != nil || !block.Header.RandomBit {
+			t.Fatalf("header %+v", block.Header)
+		}
+		if block.Body.Proposer != fixtureProposer ||
+			len(block.Body.DeployHashes) != 1 || block.Body.DeployHashes[0] != fixtureDeployHash ||
+			len(block.Body.TransferHashes) != 1 || len(block.Body.Transactions) != 0 {
+			t.Fatalf("body %+v", block.Body)
+		}
+		if len(block.Proofs) != 1 || block.Proofs[0].PublicKey != fixtureProposer {
+			t.Fatalf("proofs %+v", block.Proofs)
+		}
+	})
+
+	t.Run("info_get_deploy", func(t *testing.T) {
+		result, err := client.GetDeploy(ctx, fixtureDeployHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deploy := result.Deploy
+		if deploy.Hash != fixtureDeployHash || deploy.Header.Account != fixtureDelegator ||
+			deploy.Header.GasPrice != 1 || deploy.Header.ChainName != "casper" {
+			t.Fatalf("deploy %+v", deploy)
+		}
+		if deploy.Payment.Kind() != "ModuleBytes" || deploy.Session.Kind() != "StoredContractByName" {
+			t.Fatalf("payment %s, session %s", deploy.Payment.Kind(), deploy.Session.Kind())
+		}
+		amount, ok := deploy.Payment.Args().Get("amount")
+		if !ok || string(amount.Parsed) != `"100000000"` || string(amount.CLType) != `"U512"` {
+			t.Fatalf("payment amount %+v", amount)
+		}
+		if contract := deploy.Session.StoredContract(); contract.Name != "faucet" || contract.EntryPoint != "call_faucet" {
+			t.Fatalf("session %+v", contract)
+		}
+		if id, ok := deploy.Session.Args().Get("id"); !ok || string(id.Parsed) != "null" {
+			t.Fatalf("id %+v", id)
+		}
+		if len(deploy.Approvals) != 1 || deploy.Approvals[0].Signer != fixtureDelegator {
+			t.Fatalf("approvals %+v", deploy.Approvals)
+		}
+
+		if len(result.ExecutionResults) != 1 || result.ExecutionResults[0].BlockHash != fixtureBlockHash {
+			t.Fatalf("execution results %+v", result.ExecutionResults)
+		}
+		executionResult := result.ExecutionResults[0].Result
+		if executionResult.Success != nil {
+			t.Fatal("failed execution decoded as a success")
+		}
+		outcome, err := executionResult.Outcome()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if outcome.Cost != "100000000" || outcome.ErrorMessage != "ApiError::MissingArgument [2]" ||
+			len(outcome.Effect.Transforms) != 3 {
+			t.Fatalf("outcome %+v", outcome)
+		}
+	})
+
+	t.Run("chain_get_era_info_by_switch_block", func(t *testing.T) {
+		summary, err := client.GetEraInfoBySwitchBlock(ctx, BlockByHash(fixtureBlockHash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.EraID != 3811 || summary.BlockHash != fixtureBlockHash || summary.StoredValue.EraInfo == nil {
+			t.Fatalf("era summary %+v", summary)
+		}
+		allocations := summary.StoredValue.EraInfo.SeigniorageAllocations
+		if len(allocations) != 2 ||
+			allocations[0].Delegator == nil || allocations[0].Delegator.DelegatorPublicKey != fixtureDelegator ||
+			allocations[0].Delegator.Amount != "1254711" ||
+			allocations[1].Validator == nil || allocations[1].Validator.Amount != "1202458594726" {
+			t.Fatalf("allocations %+v", allocations)
+		}
+	})
+}
+
+func TestDecodeV1StateItems(t *testing.T) {
+	tests := map[string]struct {
+		result string
+		check  func(*StoredValue) bool
+	}{
+		"account": {
+			result: accountFixtureV1,
+			check: func(value *StoredValue) bool {
+				account := value.Account
+				return account != nil && account.AccountHash == fixtureAccountHash &&
+					account.MainPurse == fixturePurse && len(account.NamedKeys) == 1 &&
+					account.NamedKeys[0].Name == "faucet" && len(account.AssociatedKeys) == 1 &&
+					account.ActionThresholds.Deployment == 1
+			},
+		},
+		"transfer": {
+			result: transferFixtureV1,
+			check: func(value *StoredValue) bool {
+				transfer := value.Transfer
+				return transfer != nil && transfer.DeployHash == fixtureDeployHash &&
+					transfer.TransactionHash.Deploy != nil && *transfer.TransactionHash.Deploy == fixtureDeployHash &&
+					transfer.From == fixtureAccountHash && transfer.To == nil &&
+					transfer.Amount == "2500000000" && transfer.ID != nil && *transfer.ID == 42
+			},
+		},
+		"balance": {
+			result: `{"api_version": "1.4.15", "stored_value": {"CLValue": {"cl_type": "U512", "bytes": "0400e1f505", "parsed": "100000000"}}, "merkle_proof": "01000000"}`,
+			check: func(value *StoredValue) bool {
+				return value.CLValue != nil && value.CLValue.Bytes == "0400e1f505"
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newFixtureServer(t, map[string]string{"state_get_item": test.result})
+			defer server.Close()
+			client, err := NewClient([]string{server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			value, err := client.GetStateItem(context.Background(), fixtureStateRootHash, fixtureAccountHash, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.check(value) {
+				t.Fatalf("stored value %+v", value)
+			}
+		})
+	}
+}
+
+func TestDecodeV1NonSwitchBlockEraInfo(t *testing.T) {
+	server := newFixtureServer(t, map[string]string{
+		"chain_get_era_info_by_switch_block": `{"api_version": "1.4.15", "era_summary": null}`,
+	})
+	defer server.Close()
+	client, err := NewClient([]string{server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := client.GetEraInfoBySwitchBlock(context.Background(), BlockByHeight(612345))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != nil {
+		t.Fatalf("era summary %+v of a non switch block", summary)
+	}
+}
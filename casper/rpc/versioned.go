@@ -0,0 +1,685 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// This file decodes the versioned envelopes introduced by
+// casper-node 2.0 into the types used for 1.x responses.
+
+// TransactionHash identifies a legacy Deploy or a
+// TransactionV1. Exactly one of its fields is set.
+type TransactionHash struct {
+	Deploy   *string `json:"Deploy,omitempty"`
+	Version1 *string `json:"Version1,omitempty"`
+}
+
+// DeployHash returns the TransactionHash of a legacy Deploy.
+func DeployHash(hash string) TransactionHash {
+	return TransactionHash{Deploy: &hash}
+}
+
+// Version1Hash returns the TransactionHash of a TransactionV1.
+func Version1Hash(hash string) TransactionHash {
+	return TransactionHash{Version1: &hash}
+}
+
+// Hash returns the hex encoded hash, whatever its kind.
+func (h TransactionHash) Hash() string {
+	switch {
+	case h.Deploy != nil:
+		return *h.Deploy
+	case h.Version1 != nil:
+		return *h.Version1
+	}
+
+	return ""
+}
+
+// InitiatorAddr is the account initiating a TransactionV1
+// or a transfer, by public key or by account hash.
+type InitiatorAddr struct {
+	PublicKey   *string `json:"PublicKey,omitempty"`
+	AccountHash *string `json:"AccountHash,omitempty"`
+}
+
+// String returns the public key or the account hash.
+func (a InitiatorAddr) String() string {
+	switch {
+	case a.PublicKey != nil:
+		return *a.PublicKey
+	case a.AccountHash != nil:
+		return *a.AccountHash
+	}
+
+	return ""
+}
+
+type blockWithSignatures struct {
+	Block  versionedBlock `json:"block"`
+	Proofs []Proof        `json:"proofs"`
+}
+
+type versionedBlock struct {
+	Version1 *Block   `json:"Version1,omitempty"`
+	Version2 *blockV2 `json:"Version2,omitempty"`
+}
+
+// blockV2 is a block produced by protocol versions 2.x.
+type blockV2 struct {
+	Hash   string        `json:"hash"`
+	Header blockHeaderV2 `json:"header"`
+	Body   blockBodyV2   `json:"body"`
+}
+
+type blockHeaderV2 struct {
+	ParentHash      string    `json:"parent_hash"`
+	StateRootHash   string    `json:"state_root_hash"`
+	BodyHash        string    `json:"body_hash"`
+	RandomBit       bool      `json:"random_bit"`
+	AccumulatedSeed string    `json:"accumulated_seed"`
+	EraEnd          *eraEndV2 `json:"era_end"`
+	Timestamp       time.Time `json:"timestamp"`
+	EraID           uint64    `json:"era_id"`
+	Height          uint64    `json:"height"`
+	ProtocolVersion string    `json:"protocol_version"`
+	Proposer        string    `json:"proposer"`
+}
+
+type eraEndV2 struct {
+	Equivocators            []string                   `json:"equivocators"`
+	InactiveValidators      []string                   `json:"inactive_validators"`
+	NextEraValidatorWeights []ValidatorWeight          `json:"next_era_validator_weights"`
+	Rewards                 map[string]json.RawMessage `json:"rewards"`
+}
+
+// rewards returns the rewards of the era, by validator. A validator
+// may be given several amounts, which are added up.
+func (e *eraEndV2) rewards() ([]EraReward, error) {
+	validators := make([]string, 0, len(e.Rewards))
+	for validator := range e.Rewards {
+		validators = append(validators, validator)
+	}
+	sort.Strings(validators)
+
+	rewards := make([]EraReward, len(validators))
+	for i, validator := range validators {
+		var amounts []string
+		if err := json.Unmarshal(e.Rewards[validator], &amounts); err != nil {
+			var amount string
+			if err := json.Unmarshal(e.Rewards[validator], &amount); err != nil {
+				return nil, fmt.Errorf("%w: invalid rewards of %s", err, validator)
+			}
+			amounts = []string{amount}
+		}
+
+		total := new(big.Int)
+		for _, amount := range amounts {
+			value, ok := new(big.Int).SetString(amount, 10) // nolint:gomnd
+			if !ok {
+				return nil, fmt.Errorf("invalid reward %s of %s", amount, validator)
+			}
+			total.Add(total, value)
+		}
+		rewards[i] = EraReward{Validator: validator, Amount: total.String()}
+	}
+
+	return rewards, nil
+}
+
+type blockBodyV2 struct {
+	// Transactions are the transaction hashes
+	// of the block, by category.
+	Transactions map[string][]TransactionHash `json:"transactions"`
+}
+
+// block returns the *Block equivalent to b. The transactions
+// are ordered by category, then as listed in the block.
+func (b *blockV2) block(proofs []Proof) (*Block, error) {
+	header := BlockHeader{
+		ParentHash:      b.Header.ParentHash,
+		StateRootHash:   b.Header.StateRootHash,
+		BodyHash:        b.Header.BodyHash,
+		RandomBit:       b.Header.RandomBit,
+		AccumulatedSeed: b.Header.AccumulatedSeed,
+		Timestamp:       b.Header.Timestamp,
+		EraID:           b.Header.EraID,
+		Height:          b.Header.Height,
+		ProtocolVersion: b.Header.ProtocolVersion,
+	}
+	if b.Header.EraEnd != nil {
+		rewards, err := b.Header.EraEnd.rewards()
+		if err != nil {
+			return nil, err
+		}
+		header.EraEnd = &EraEnd{
+			EraReport: EraReport{
+				Equivocators:       b.Header.EraEnd.Equivocators,
+				Rewards:            rewards,
+				InactiveValidators: b.Header.EraEnd.InactiveValidators,
+			},
+			NextEraValidatorWeights: b.Header.EraEnd.NextEraValidatorWeights,
+		}
+	}
+
+	categories := make([]int, 0, len(b.Body.Transactions))
+	for category := range b.Body.Transactions {
+		value, err := strconv.Atoi(category)
+		if err != nil {
+			continue
+		}
+		categories = append(categories, value)
+	}
+	sort.Ints(categories)
+
+	transactions := []TransactionHash{}
+	for _, category := range categories {
+		transactions = append(transactions, b.Body.Transactions[strconv.Itoa(category)]...)
+	}
+
+	return &Block{
+		Hash:   b.Hash,
+		Header: header,
+		Body: BlockBody{
+			Proposer:     b.Header.Proposer,
+			Transactions: transactions,
+		},
+		Proofs: proofs,
+	}, nil
+}
+
+// block returns the *Block of the envelope, or nil.
+func (b *blockWithSignatures) block() (*Block, error) {
+	switch {
+	case b.Block.Version1 != nil:
+		block := b.Block.Version1
+		block.Proofs = b.Proofs
+		return block, nil
+	case b.Block.Version2 != nil:
+		return b.Block.Version2.block(b.Proofs)
+	}
+
+	return nil, nil
+}
+
+// transferV2 is a transfer record created by protocol versions 2.x.
+type transferV2 struct {
+	TransactionHash TransactionHash `json:"transaction_hash"`
+	From            InitiatorAddr   `json:"from"`
+	To              *string         `json:"to"`
+	Source          string          `json:"source"`
+	Target          string          `json:"target"`
+	Amount          string          `json:"amount"`
+	Gas             string          `json:"gas"`
+	ID              *uint64         `json:"id"`
+}
+
+type transferV1 Transfer
+
+// UnmarshalJSON decodes a Transfer from a 1.x transfer record
+// or from a versioned 2.x transfer record.
+func (t *Transfer) UnmarshalJSON(data []byte) error {
+	var versioned struct {
+		Version1 *transferV1 `json:"Version1"`
+		Version2 *transferV2 `json:"Version2"`
+	}
+	if err := json.Unmarshal(data, &versioned); err != nil {
+		return err
+	}
+
+	switch {
+	case versioned.Version2 != nil:
+		v2 := versioned.Version2
+		*t = Transfer{
+			DeployHash:      v2.TransactionHash.Hash(),
+			TransactionHash: v2.TransactionHash,
+			From:            v2.From.String(),
+			To:              v2.To,
+			Source:          v2.Source,
+			Target:          v2.Target,
+			Amount:          v2.Amount,
+			Gas:             v2.Gas,
+			ID:              v2.ID,
+		}
+		return nil
+	case versioned.Version1 != nil:
+		*t = Transfer(*versioned.Version1)
+	default:
+		var v1 transferV1
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return err
+		}
+		*t = Transfer(v1)
+	}
+	t.TransactionHash = DeployHash(t.DeployHash)
+
+	return nil
+}
+
+// ExecutionInfo is the execution of a transaction
+// as returned by casper-node 2.x.
+type ExecutionInfo struct {
+	BlockHash       string                    `json:"block_hash"`
+	BlockHeight     uint64                    `json:"block_height"`
+	ExecutionResult *VersionedExecutionResult `json:"execution_result"`
+}
+
+// VersionedExecutionResult is the result of an execution
+// before (Version1) or after (Version2) protocol version 2.0.
+type VersionedExecutionResult struct {
+	Version1 *ExecutionResult   `json:"Version1,omitempty"`
+	Version2 *ExecutionResultV2 `json:"Version2,omitempty"`
+}
+
+// ExecutionResultV2 is the result of an
+// execution by protocol versions 2.x.
+type ExecutionResultV2 struct {
+	Initiator    InitiatorAddr `json:"initiator"`
+	ErrorMessage *string       `json:"error_message"`
+	Limit        string        `json:"limit"`
+	Consumed     string        `json:"consumed"`
+	Cost         string        `json:"cost"`
+	Transfers    []*Transfer   `json:"transfers"`
+	Effects      []EffectV2    `json:"effects"`
+}
+
+// EffectV2 is a transform applied to a key
+// by protocol versions 2.x.
+type EffectV2 struct {
+	Key  string          `json:"key"`
+	Kind json.RawMessage `json:"kind"`
+}
+
+// transform returns the 1.x equivalent of the transform kind.
+// Writes of CLValues become WriteCLValue transforms.
+func (e EffectV2) transform() json.RawMessage {
+	var kind map[string]json.RawMessage
+	if err := json.Unmarshal(e.Kind, &kind); err != nil {
+		return e.Kind
+	}
+
+	write, ok := kind["Write"]
+	if !ok {
+		return e.Kind
+	}
+
+	var storedValue map[string]json.RawMessage
+	if err := json.Unmarshal(write, &storedValue); err != nil {
+		return e.Kind
+	}
+	clValue, ok := storedValue["CLValue"]
+	if !ok {
+		return e.Kind
+	}
+
+	transform, err := json.Marshal(map[string]json.RawMessage{"WriteCLValue": clValue})
+	if err != nil {
+		return e.Kind
+	}
+
+	return transform
+}
+
+// result returns the ExecutionResult equivalent to r. Transfer
+// records are part of the outcome instead of being stored in
+// the global state.
+func (r *VersionedExecutionResult) result() (*ExecutionResult, error) {
+	switch {
+	case r.Version1 != nil:
+		return r.Version1, nil
+	case r.Version2 == nil:
+		return nil, errors.New("empty execution result")
+	}
+
+	v2 := r.Version2
+	transforms := make([]TransformEntry, len(v2.Effects))
+	for i, effect := range v2.Effects {
+		transforms[i] = TransformEntry{Key: effect.Key, Transform: effect.transform()}
+	}
+
+	outcome := &ExecutionOutcome{
+		Effect:          ExecutionEffect{Transforms: transforms},
+		Cost:            v2.Cost,
+		TransferRecords: v2.Transfers,
+	}
+	if v2.ErrorMessage != nil {
+		outcome.ErrorMessage = *v2.ErrorMessage
+		return &ExecutionResult{Failure: outcome}, nil
+	}
+
+	return &ExecutionResult{Success: outcome}, nil
+}
+
+// executionResults returns the execution results of
+// info, if the transaction was executed.
+func (info *ExecutionInfo) executionResults() ([]BlockExecutionResult, error) {
+	if info == nil || info.ExecutionResult == nil {
+		return nil, nil
+	}
+
+	result, err := info.ExecutionResult.result()
+	if err != nil {
+		return nil, err
+	}
+
+	return []BlockExecutionResult{{BlockHash: info.BlockHash, Result: *result}}, nil
+}
+
+type deployResultV1 DeployResult
+
+// UnmarshalJSON decodes the result of info_get_deploy returned
+// by 1.x nodes (execution_results) or 2.x nodes (execution_info).
+func (r *DeployResult) UnmarshalJSON(data []byte) error {
+	var result struct {
+		deployResultV1
+		ExecutionInfo *ExecutionInfo `json:"execution_info"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+
+	*r = DeployResult(result.deployResultV1)
+	if len(r.ExecutionResults) > 0 {
+		return nil
+	}
+
+	executionResults, err := result.ExecutionInfo.executionResults()
+	if err != nil {
+		return err
+	}
+	r.ExecutionResults = executionResults
+
+	return nil
+}
+
+// TransactionV1 is a transaction introduced by
+// protocol version 2.0.
+type TransactionV1 struct {
+	Hash      string               `json:"hash"`
+	Payload   TransactionV1Payload `json:"payload"`
+	Approvals []Approval           `json:"approvals"`
+}
+
+// TransactionV1Payload is the signed content of a TransactionV1.
+// Its fields are keyed by name: "args", "target", "entry_point"
+// and "scheduling".
+type TransactionV1Payload struct {
+	InitiatorAddr InitiatorAddr              `json:"initiator_addr"`
+	Timestamp     time.Time                  `json:"timestamp"`
+	TTL           string                     `json:"ttl"`
+	ChainName     string                     `json:"chain_name"`
+	PricingMode   PricingMode                `json:"pricing_mode"`
+	Fields        map[string]json.RawMessage `json:"fields"`
+}
+
+// Target returns the target field of the payload.
+func (p *TransactionV1Payload) Target() (*TransactionTarget, error) {
+	field, ok := p.Fields["target"]
+	if !ok {
+		return nil, errors.New("transaction has no target")
+	}
+
+	target := &TransactionTarget{}
+	if err := json.Unmarshal(field, target); err != nil {
+		return nil, fmt.Errorf("%w: invalid transaction target", err)
+	}
+
+	return target, nil
+}
+
+// EntryPoint returns the entry_point field of the payload: the
+// name of a custom entry point, or of a native entry point such
+// as "Transfer", "Delegate" or "Call" for session code.
+func (p *TransactionV1Payload) EntryPoint() (string, error) {
+	field, ok := p.Fields["entry_point"]
+	if !ok {
+		return "", errors.New("transaction has no entry point")
+	}
+
+	var name string
+	if err := json.Unmarshal(field, &name); err == nil {
+		return name, nil
+	}
+
+	var custom struct {
+		Custom *string `json:"Custom"`
+	}
+	if err := json.Unmarshal(field, &custom); err != nil {
+		return "", fmt.Errorf("%w: invalid transaction entry point", err)
+	}
+	if custom.Custom == nil {
+		return "", fmt.Errorf("invalid transaction entry point %s", field)
+	}
+
+	return *custom.Custom, nil
+}
+
+// TransactionTarget is what a TransactionV1 runs: a native
+// entry point, a stored contract or session code. Exactly
+// one of its fields is set.
+type TransactionTarget struct {
+	Native  bool
+	Stored  *StoredTarget
+	Session *SessionTarget
+}
+
+// UnmarshalJSON decodes a TransactionTarget from "Native"
+// or from a Stored or Session variant.
+func (t *TransactionTarget) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		if name != "Native" {
+			return fmt.Errorf("unknown transaction target %s", name)
+		}
+		*t = TransactionTarget{Native: true}
+		return nil
+	}
+
+	var variants struct {
+		Stored  *StoredTarget  `json:"Stored"`
+		Session *SessionTarget `json:"Session"`
+	}
+	if err := json.Unmarshal(data, &variants); err != nil {
+		return err
+	}
+	if variants.Stored == nil && variants.Session == nil {
+		return fmt.Errorf("unknown transaction target %s", data)
+	}
+	*t = TransactionTarget{Stored: variants.Stored, Session: variants.Session}
+
+	return nil
+}
+
+// Kind returns the kind of the target: "Native", "Session" or
+// "Stored" followed by the way the contract is identified.
+func (t *TransactionTarget) Kind() string {
+	switch {
+	case t.Native:
+		return "Native"
+	case t.Session != nil:
+		return "Session"
+	case t.Stored == nil:
+		return ""
+	}
+
+	id := t.Stored.ID
+	switch {
+	case id.ByHash != nil:
+		return "StoredByHash"
+	case id.ByName != nil:
+		return "StoredByName"
+	case id.ByPackageHash != nil:
+		return "StoredByPackageHash"
+	case id.ByPackageName != nil:
+		return "StoredByPackageName"
+	}
+
+	return "Stored"
+}
+
+// StoredTarget is a stored contract called by a TransactionV1.
+type StoredTarget struct {
+	ID      InvocationTarget `json:"id"`
+	Runtime json.RawMessage  `json:"runtime"`
+}
+
+// InvocationTarget identifies a stored contract by hash or name,
+// or a contract package by hash or name. Exactly one of its
+// fields is set.
+type InvocationTarget struct {
+	ByHash        *string        `json:"ByHash,omitempty"`
+	ByName        *string        `json:"ByName,omitempty"`
+	ByPackageHash *PackageTarget `json:"ByPackageHash,omitempty"`
+	ByPackageName *PackageTarget `json:"ByPackageName,omitempty"`
+}
+
+// PackageTarget is a version of a contract package,
+// the latest one if Version is nil.
+type PackageTarget struct {
+	Addr    string  `json:"addr,omitempty"`
+	Name    string  `json:"name,omitempty"`
+	Version *uint32 `json:"version"`
+}
+
+// SessionTarget is session code run by a TransactionV1.
+type SessionTarget struct {
+	IsInstallUpgrade bool            `json:"is_install_upgrade"`
+	Runtime          json.RawMessage `json:"runtime"`
+	ModuleBytes      string          `json:"module_bytes"`
+}
+
+// PricingMode is the way a TransactionV1 pays for its execution.
+// Exactly one of its fields is set.
+type PricingMode struct {
+	PaymentLimited *PaymentLimited `json:"PaymentLimited,omitempty"`
+	Fixed          *FixedPricing   `json:"Fixed,omitempty"`
+	Prepaid        *PrepaidPricing `json:"Prepaid,omitempty"`
+}
+
+// Name returns the name of the pricing mode.
+func (m *PricingMode) Name() string {
+	switch {
+	case m.PaymentLimited != nil:
+		return "PaymentLimited"
+	case m.Fixed != nil:
+		return "Fixed"
+	case m.Prepaid != nil:
+		return "Prepaid"
+	}
+
+	return ""
+}
+
+// GasPriceTolerance returns the highest gas price the
+// transaction accepts to pay, and false for prepaid
+// transactions.
+func (m *PricingMode) GasPriceTolerance() (uint8, bool) {
+	switch {
+	case m.PaymentLimited != nil:
+		return m.PaymentLimited.GasPriceTolerance, true
+	case m.Fixed != nil:
+		return m.Fixed.GasPriceTolerance, true
+	}
+
+	return 0, false
+}
+
+// PaymentLimited is the pricing mode of a TransactionV1
+// paying up to a fixed amount.
+type PaymentLimited struct {
+	PaymentAmount     uint64 `json:"payment_amount"`
+	GasPriceTolerance uint8  `json:"gas_price_tolerance"`
+	StandardPayment   bool   `json:"standard_payment"`
+}
+
+// FixedPricing is the pricing mode of a TransactionV1 paying
+// a cost set by the chainspec for its transaction category.
+type FixedPricing struct {
+	AdditionalComputationFactor uint8 `json:"additional_computation_factor"`
+	GasPriceTolerance           uint8 `json:"gas_price_tolerance"`
+}
+
+// PrepaidPricing is the pricing mode of a TransactionV1
+// paid in advance.
+type PrepaidPricing struct {
+	Receipt string `json:"receipt"`
+}
+
+// VersionedTransaction is a legacy Deploy or a TransactionV1.
+// Exactly one of its fields is set.
+type VersionedTransaction struct {
+	Deploy   *Deploy        `json:"Deploy,omitempty"`
+	Version1 *TransactionV1 `json:"Version1,omitempty"`
+}
+
+// TransactionResult is the result of info_get_transaction.
+type TransactionResult struct {
+	APIVersion       string                 `json:"api_version"`
+	Transaction      VersionedTransaction   `json:"transaction"`
+	ExecutionInfo    *ExecutionInfo         `json:"execution_info"`
+	ExecutionResults []BlockExecutionResult `json:"-"`
+}
+
+type transactionResultV1 TransactionResult
+
+// UnmarshalJSON decodes the result of info_get_transaction
+// and its execution info.
+func (r *TransactionResult) UnmarshalJSON(data []byte) error {
+	var result transactionResultV1
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+
+	*r = TransactionResult(result)
+	executionResults, err := r.ExecutionInfo.executionResults()
+	if err != nil {
+		return err
+	}
+	r.ExecutionResults = executionResults
+
+	return nil
+}
+
+type getTransactionParams struct {
+	TransactionHash    TransactionHash `json:"transaction_hash"`
+	FinalizedApprovals bool            `json:"finalized_approvals"`
+}
+
+// PurseIdentifier selects a purse by the public key or the
+// account hash of its owner, or by URef. Exactly one of its
+// fields is set.
+type PurseIdentifier struct {
+	MainPurseUnderPublicKey   *string `json:"main_purse_under_public_key,omitempty"`
+	MainPurseUnderAccountHash *string `json:"main_purse_under_account_hash,omitempty"`
+	PurseURef                 *string `json:"purse_uref,omitempty"`
+}
+
+type queryBalanceParams struct {
+	StateIdentifier *StateIdentifier `json:"state_identifier"`
+	PurseIdentifier *PurseIdentifier `json:"purse_identifier"`
+}
+
+type queryBalanceResult struct {
+	APIVersion string `json:"api_version"`
+	Balance    string `json:"balance"`
+}
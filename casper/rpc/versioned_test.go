@@ -0,0 +1,185 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// transactionV1Result returns an info_get_transaction
+// result with the provided pricing mode and fields.
+func transactionV1Result(pricingMode string, target string, entryPoint string) string {
+	return fmt.Sprintf(`{
+  "api_version": "2.0.0",
+  "transaction": {"Version1": {
+    "hash": "f5582e55ea1e6be6b2ed3ea0a5b1fe5ba8b8f8e8b1d2b4d7b8a5c0a1e1f2d3c4",
+    "payload": {
+      "initiator_addr": {"PublicKey": "01d9bf2148748a85c89da5aad8ee0b0fc2d105fd39d41a4c796536354f0ae2900c"},
+      "timestamp": "2024-10-01T12:00:00.000Z",
+      "ttl": "30m",
+      "chain_name": "casper-test",
+      "pricing_mode": %s,
+      "fields": {
+        "args": {"Named": []},
+        "entry_point": %s,
+        "scheduling": "Standard",
+        "target": %s
+      }
+    },
+    "approvals": []
+  }},
+  "execution_info": null
+}`, pricingMode, entryPoint, target)
+}
+
+func TestTransactionV1Payload(t *testing.T) {
+	const (
+		paymentLimited = `{"PaymentLimited": {"payment_amount": 2500000000, "gas_price_tolerance": 1, "standard_payment": true}}`
+		fixed          = `{"Fixed": {"additional_computation_factor": 0, "gas_price_tolerance": 5}}`
+		prepaid        = `{"Prepaid": {"receipt": "0000000000000000000000000000000000000000000000000000000000000000"}}`
+	)
+
+	tests := map[string]struct {
+		pricingMode string
+		target      string
+		entryPoint  string
+
+		kind         string
+		wantEntry    string
+		pricing      string
+		gasPrice     uint8
+		hasGasPrice  bool
+		contractHash string
+	}{
+		"native transfer": {
+			pricingMode: paymentLimited,
+			target:      `"Native"`,
+			entryPoint:  `"Transfer"`,
+			kind:        "Native",
+			wantEntry:   "Transfer",
+			pricing:     "PaymentLimited",
+			gasPrice:    1,
+			hasGasPrice: true,
+		},
+		"native delegation": {
+			pricingMode: fixed,
+			target:      `"Native"`,
+			entryPoint:  `"Delegate"`,
+			kind:        "Native",
+			wantEntry:   "Delegate",
+			pricing:     "Fixed",
+			gasPrice:    5,
+			hasGasPrice: true,
+		},
+		"stored contract by hash": {
+			pricingMode: fixed,
+			target: `{"Stored": {
+				"id": {"ByHash": "ccb576d6ce6dec84a551e48f0d0b7af89ddba44c7390b690036257a04a3ae9ea"},
+				"runtime": "VmCasperV1"
+			}}`,
+			entryPoint:   `{"Custom": "delegate"}`,
+			kind:         "StoredByHash",
+			wantEntry:    "delegate",
+			pricing:      "Fixed",
+			gasPrice:     5,
+			hasGasPrice:  true,
+			contractHash: "ccb576d6ce6dec84a551e48f0d0b7af89ddba44c7390b690036257a04a3ae9ea",
+		},
+		"stored package by name": {
+			pricingMode: prepaid,
+			target: `{"Stored": {
+				"id": {"ByPackageName": {"name": "cep18", "version": null}},
+				"runtime": "VmCasperV1"
+			}}`,
+			entryPoint: `{"Custom": "transfer"}`,
+			kind:       "StoredByPackageName",
+			wantEntry:  "transfer",
+			pricing:    "Prepaid",
+		},
+		"session": {
+			pricingMode: paymentLimited,
+			target: `{"Session": {
+				"is_install_upgrade": false,
+				"runtime": "VmCasperV1",
+				"module_bytes": "0061736d01000000"
+			}}`,
+			entryPoint:  `"Call"`,
+			kind:        "Session",
+			wantEntry:   "Call",
+			pricing:     "PaymentLimited",
+			gasPrice:    1,
+			hasGasPrice: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var result TransactionResult
+			data := transactionV1Result(test.pricingMode, test.target, test.entryPoint)
+			if err := json.Unmarshal([]byte(data), &result); err != nil {
+				t.Fatal(err)
+			}
+			payload := &result.Transaction.Version1.Payload
+
+			target, err := payload.Target()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kind := target.Kind(); kind != test.kind {
+				t.Fatalf("target kind %s, want %s", kind, test.kind)
+			}
+			if len(test.contractHash) > 0 && *target.Stored.ID.ByHash != test.contractHash {
+				t.Fatalf("contract hash %s, want %s", *target.Stored.ID.ByHash, test.contractHash)
+			}
+
+			entryPoint, err := payload.EntryPoint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entryPoint != test.wantEntry {
+				t.Fatalf("entry point %s, want %s", entryPoint, test.wantEntry)
+			}
+
+			if pricing := payload.PricingMode.Name(); pricing != test.pricing {
+				t.Fatalf("pricing mode %s, want %s", pricing, test.pricing)
+			}
+			gasPrice, ok := payload.PricingMode.GasPriceTolerance()
+			if gasPrice != test.gasPrice || ok != test.hasGasPrice {
+				t.Fatalf("gas price %d %t, want %d %t", gasPrice, ok, test.gasPrice, test.hasGasPrice)
+			}
+		})
+	}
+}
+
+func TestTransactionV1PayloadInvalidFields(t *testing.T) {
+	tests := map[string]map[string]json.RawMessage{
+		"no fields":           {},
+		"unknown target":      {"target": json.RawMessage(`"Wasm"`), "entry_point": json.RawMessage(`"Call"`)},
+		"unknown entry point": {"target": json.RawMessage(`"Native"`), "entry_point": json.RawMessage(`{"Other": 1}`)},
+	}
+
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			payload := &TransactionV1Payload{Fields: fields}
+			_, targetErr := payload.Target()
+			_, entryPointErr := payload.EntryPoint()
+			if targetErr == nil && entryPointErr == nil {
+				t.Fatal("invalid fields accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,609 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+const (
+	// NewValidatorMetadataKey is the metadata key holding the
+	// validator a redelegated stake is moved to.
+	NewValidatorMetadataKey = "new_validator_public_key"
+
+	// AmountMetadataKey is the metadata key holding the
+	// amount of a staking operation.
+	AmountMetadataKey = "amount"
+)
+
+const (
+	// auctionContractName is the name of the auction
+	// contract in the system contract registry.
+	auctionContractName = "auction"
+
+	// hashKeyPrefix prefixes the keys of contracts.
+	hashKeyPrefix = "hash-"
+
+	// systemContractRegistryKey and systemEntityRegistryKey hold the
+	// system contract hashes by name, since protocol versions 1.4
+	// and 2.0 respectively.
+	systemContractRegistryKey = "system-contract-registry-" +
+		"0000000000000000000000000000000000000000000000000000000000000000"
+	systemEntityRegistryKey = "system-entity-registry-" +
+		"0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// auctionEntryPoints maps the entry points of the system
+// auction contract to their operation type.
+var auctionEntryPoints = map[string]string{
+	"delegate":     DelegateOpType,
+	"undelegate":   UndelegateOpType,
+	"redelegate":   RedelegateOpType,
+	"add_bid":      AddBidOpType,
+	"withdraw_bid": WithdrawBidOpType,
+}
+
+// stakingCall is a call to the system auction contract.
+type stakingCall struct {
+	opType       string
+	publicKey    string
+	validator    string
+	newValidator string
+	amount       string
+}
+
+// auctionContract identifies the system auction contract.
+// packageHash is empty if the contract could not be read.
+type auctionContract struct {
+	contractHash string
+	packageHash  string
+}
+
+// auctionContractAt returns the system auction contract of the
+// protocol version of block, read from the system contract registry
+// at its state. The registry was introduced by protocol version 1.4,
+// older blocks use the registry of the latest block: their calls are
+// matched through the contract package, which upgrades keep.
+func (ec *Client) auctionContractAt(ctx context.Context, block *rpc.Block) (*auctionContract, error) {
+	ec.auctionMu.Lock()
+	defer ec.auctionMu.Unlock()
+
+	if auction, ok := ec.auctionContracts[block.Header.ProtocolVersion]; ok {
+		return auction, nil
+	}
+
+	auction, err := ec.readAuctionContract(ctx, block)
+	if rpc.IsNotFound(err) {
+		latest, latestErr := ec.node.GetBlock(ctx, nil)
+		if latestErr != nil {
+			return nil, fmt.Errorf("%w: could not get latest block", latestErr)
+		}
+		auction, err = ec.readAuctionContract(ctx, latest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ec.auctionContracts[block.Header.ProtocolVersion] = auction
+
+	return auction, nil
+}
+
+// readAuctionContract reads the system auction contract
+// from the system contract registry at the state of block.
+func (ec *Client) readAuctionContract(ctx context.Context, block *rpc.Block) (*auctionContract, error) {
+	strategy, err := strategyFor(block.Header.ProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	stateRootHash := block.Header.StateRootHash
+	item, err := ec.node.GetStateItem(ctx, stateRootHash, strategy.systemRegistryKey(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get system contract registry", err)
+	}
+	if item.CLValue == nil {
+		return nil, errors.New("invalid system contract registry")
+	}
+
+	var entries []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(item.CLValue.Parsed, &entries); err != nil {
+		return nil, fmt.Errorf("%w: invalid system contract registry", err)
+	}
+
+	auction := &auctionContract{}
+	for _, entry := range entries {
+		if entry.Key == auctionContractName {
+			auction.contractHash = contractHashHex(entry.Value)
+		}
+	}
+	if len(auction.contractHash) == 0 {
+		return nil, errors.New("no auction contract in the system contract registry")
+	}
+
+	contract, err := ec.node.GetStateItem(ctx, stateRootHash, hashKeyPrefix+auction.contractHash, nil)
+	if err != nil && !rpc.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: could not get auction contract", err)
+	}
+	if err == nil && contract.Contract != nil {
+		auction.packageHash = contractHashHex(contract.Contract.ContractPackageHash)
+	}
+
+	return auction, nil
+}
+
+// contractHashHex returns the hex encoded hash of a
+// contract or contract package hash, without prefix.
+func contractHashHex(hash string) string {
+	hash = strings.ToLower(hash)
+	for _, prefix := range []string{"contract-package-wasm", "contract-package-", "package-", hashKeyPrefix} {
+		if strings.HasPrefix(hash, prefix) {
+			return strings.TrimPrefix(hash, prefix)
+		}
+	}
+
+	return hash
+}
+
+// callsAuction returns true if item calls a version of the
+// system auction contract, by contract or package hash.
+func (ec *Client) callsAuction(
+	ctx context.Context,
+	auction *auctionContract,
+	item *rpc.ExecutableDeployItem,
+	block *rpc.Block,
+) (bool, error) {
+	switch {
+	case item.StoredContractByHash != nil:
+		hash := contractHashHex(item.StoredContractByHash.Hash)
+		if hash == auction.contractHash {
+			return true, nil
+		}
+		if len(auction.packageHash) == 0 {
+			return false, nil
+		}
+
+		// Earlier versions of the auction contract.
+		called, err := ec.node.GetStateItem(ctx, block.Header.StateRootHash, hashKeyPrefix+hash, nil)
+		if rpc.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: could not get contract %s", err, hash)
+		}
+
+		return called.Contract != nil &&
+			contractHashHex(called.Contract.ContractPackageHash) == auction.packageHash, nil
+	case item.StoredVersionedContractByHash != nil:
+		return len(auction.packageHash) > 0 &&
+			contractHashHex(item.StoredVersionedContractByHash.Hash) == auction.packageHash, nil
+	}
+
+	return false, nil
+}
+
+// deployStakingCall returns the staking call of deploy, executed
+// with outcome, or nil if its session does not call an entry point
+// of the system auction contract of block.
+//
+// Stored contracts called by name are resolved through the named
+// keys of the deploy account. Session code, such as delegate.wasm,
+// is decoded from the auction values written by outcome.
+func (ec *Client) deployStakingCall(
+	ctx context.Context,
+	deploy *rpc.Deploy,
+	outcome *rpc.ExecutionOutcome,
+	block *rpc.Block,
+) (*stakingCall, error) {
+	if deploy.Session.ModuleBytes != nil {
+		return moduleBytesStakingCall(deploy.Session.ModuleBytes.Args, outcome)
+	}
+
+	contract := deploy.Session.StoredContract()
+	if contract == nil {
+		return nil, nil
+	}
+	opType, ok := auctionEntryPoints[contract.EntryPoint]
+	if !ok {
+		return nil, nil
+	}
+
+	auction, err := ec.auctionContractAt(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	session, err := ec.contractByHash(ctx, deploy, block)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	ok, err = ec.callsAuction(ctx, auction, session, block)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return parseStakingCall(opType, contract.Args)
+}
+
+// contractByHash returns the session of deploy calling a stored
+// contract by hash. Calls by name are resolved through the named
+// keys of the deploy account at the state of block, nil is
+// returned if it has no such named key.
+func (ec *Client) contractByHash(
+	ctx context.Context,
+	deploy *rpc.Deploy,
+	block *rpc.Block,
+) (*rpc.ExecutableDeployItem, error) {
+	session := &deploy.Session
+	contract := session.StoredContractByName
+	if contract == nil {
+		contract = session.StoredVersionedContractByName
+	}
+	if contract == nil {
+		return session, nil
+	}
+
+	hash, err := accountHash(deploy.Header.Account)
+	if err != nil {
+		return nil, err
+	}
+	item, err := ec.node.GetStateItem(ctx, block.Header.StateRootHash, hash, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get account %s", err, hash)
+	}
+	if item.Account == nil {
+		return nil, fmt.Errorf("%s is not an account", hash)
+	}
+
+	for _, namedKey := range item.Account.NamedKeys {
+		if namedKey.Name != contract.Name {
+			continue
+		}
+
+		called := &rpc.StoredContract{Hash: namedKey.Key, EntryPoint: contract.EntryPoint, Args: contract.Args}
+		if session.StoredVersionedContractByName != nil {
+			return &rpc.ExecutableDeployItem{StoredVersionedContractByHash: called}, nil
+		}
+
+		return &rpc.ExecutableDeployItem{StoredContractByHash: called}, nil
+	}
+
+	return nil, nil
+}
+
+// moduleBytesStakingCall returns the staking call of session code
+// taking args, or nil if outcome writes neither a bid nor an
+// unbonding purse. The call is a redelegation if it takes a new
+// validator, an undelegation if it writes an unbonding purse and a
+// delegation otherwise. It is decoded from args, or from the last
+// unbonding purse written by 1.x nodes if args hold no delegator.
+func moduleBytesStakingCall(args rpc.RuntimeArgs, outcome *rpc.ExecutionOutcome) (*stakingCall, error) {
+	var bonds, unbonds bool
+	var unbondingPurses []rpc.UnbondingPurse
+	for _, entry := range outcome.Effect.Transforms {
+		name, value := auctionWrite(entry.Transform)
+		switch name {
+		case "WriteBid", "Validator", "Delegator":
+			bonds = true
+		case "Unbond":
+			unbonds = true
+		case "WriteWithdraw", "WriteUnbonding":
+			unbonds = true
+			if err := json.Unmarshal(value, &unbondingPurses); err != nil {
+				return nil, fmt.Errorf("%w: invalid unbonding purses of %s", err, entry.Key)
+			}
+		}
+	}
+	if !bonds && !unbonds {
+		return nil, nil
+	}
+
+	if _, ok := args.Get("delegator"); ok {
+		opType := DelegateOpType
+		if unbonds {
+			opType = UndelegateOpType
+		}
+		if _, ok := args.Get("new_validator"); ok {
+			opType = RedelegateOpType
+		}
+
+		return parseStakingCall(opType, args)
+	}
+
+	// Unbonding purses are appended to those of the unbonder.
+	if len(unbondingPurses) == 0 {
+		return nil, nil
+	}
+	purse := unbondingPurses[len(unbondingPurses)-1]
+	if strings.EqualFold(purse.UnbonderPublicKey, purse.ValidatorPublicKey) {
+		// The validator withdraws its own bid.
+		return nil, nil
+	}
+
+	call := &stakingCall{
+		opType:    UndelegateOpType,
+		publicKey: purse.UnbonderPublicKey,
+		validator: purse.ValidatorPublicKey,
+		amount:    purse.Amount,
+	}
+	if purse.NewValidator != nil {
+		call.opType = RedelegateOpType
+		call.newValidator = *purse.NewValidator
+	}
+
+	return call, nil
+}
+
+// auctionWrite returns the variant and the value of the auction
+// value written by transform: WriteBid, WriteWithdraw or
+// WriteUnbonding up to protocol versions 1.x, the kind of bid
+// written since 2.0. It returns an empty variant otherwise.
+func auctionWrite(transform json.RawMessage) (string, json.RawMessage) {
+	var variants map[string]json.RawMessage
+	if err := json.Unmarshal(transform, &variants); err != nil {
+		return "", nil
+	}
+
+	if write, ok := variants["Write"]; ok {
+		var storedValue map[string]json.RawMessage
+		if err := json.Unmarshal(write, &storedValue); err != nil {
+			return "", nil
+		}
+		if err := json.Unmarshal(storedValue["BidKind"], &variants); err != nil {
+			return "", nil
+		}
+	}
+
+	for _, name := range []string{"WriteBid", "WriteWithdraw", "WriteUnbonding", "Validator", "Delegator", "Unbond"} {
+		if value, ok := variants[name]; ok {
+			return name, value
+		}
+	}
+
+	return "", nil
+}
+
+// parseStakingCall decodes the arguments of a call
+// to a staking entry point of the auction contract.
+func parseStakingCall(opType string, args rpc.RuntimeArgs) (*stakingCall, error) {
+	call := &stakingCall{opType: opType}
+	var err error
+	switch opType {
+	case AddBidOpType, WithdrawBidOpType:
+		if call.publicKey, err = parsedStringArg(args, "public_key"); err != nil {
+			return nil, err
+		}
+		call.validator = call.publicKey
+	default:
+		if call.publicKey, err = parsedStringArg(args, "delegator"); err != nil {
+			return nil, err
+		}
+		if call.validator, err = parsedStringArg(args, "validator"); err != nil {
+			return nil, err
+		}
+	}
+
+	if opType == RedelegateOpType {
+		if call.newValidator, err = parsedStringArg(args, "new_validator"); err != nil {
+			return nil, err
+		}
+	}
+
+	if call.amount, err = parsedStringArg(args, "amount"); err != nil {
+		return nil, err
+	}
+
+	return call, nil
+}
+
+// parsedStringArg returns the parsed value of a string-like
+// runtime argument (public keys and big integers).
+func parsedStringArg(args rpc.RuntimeArgs, name string) (string, error) {
+	value, ok := args.Get(name)
+	if !ok {
+		return "", fmt.Errorf("missing argument %s", name)
+	}
+
+	var parsed string
+	if err := json.Unmarshal(value.Parsed, &parsed); err != nil {
+		return "", fmt.Errorf("%w: invalid argument %s", err, name)
+	}
+
+	return parsed, nil
+}
+
+// UnbondingAccount returns the *RosettaTypes.AccountIdentifier of the
+// amount being unbonded by publicKey from validator.
+func UnbondingAccount(publicKey string, validator string) *RosettaTypes.AccountIdentifier {
+	return &RosettaTypes.AccountIdentifier{
+		Address: publicKeyAccount(publicKey),
+		SubAccount: &RosettaTypes.SubAccountIdentifier{
+			Address: UnbondingSubAccount,
+			Metadata: map[string]interface{}{
+				ValidatorMetadataKey: validator,
+			},
+		},
+	}
+}
+
+// operations returns the balance movements of a successful
+// staking call, starting at index. Bonding moves funds from
+// the main purse of the caller to its stake, unbonding moves
+// them from its stake to its unbonding sub account until
+// they are paid out.
+func (c *stakingCall) operations(index int64) []*RosettaTypes.Operation {
+	var from, to *RosettaTypes.AccountIdentifier
+	switch c.opType {
+	case DelegateOpType, AddBidOpType:
+		from = MainAccount(publicKeyAccount(c.publicKey))
+		to = StakedAccount(c.publicKey, c.validator)
+	default:
+		from = StakedAccount(c.publicKey, c.validator)
+		to = UnbondingAccount(c.publicKey, c.validator)
+	}
+
+	metadata := map[string]interface{}{
+		ValidatorMetadataKey: c.validator,
+		AmountMetadataKey:    c.amount,
+	}
+	if c.opType == RedelegateOpType {
+		metadata[NewValidatorMetadataKey] = c.newValidator
+	}
+
+	return []*RosettaTypes.Operation{
+		{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: index,
+			},
+			Type:    c.opType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: from,
+			Amount: &RosettaTypes.Amount{
+				Value:    "-" + c.amount,
+				Currency: Currency,
+			},
+			Metadata: metadata,
+		},
+		{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: index + 1,
+			},
+			RelatedOperations: []*RosettaTypes.OperationIdentifier{
+				{
+					Index: index,
+				},
+			},
+			Type:    c.opType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: to,
+			Amount: &RosettaTypes.Amount{
+				Value:    c.amount,
+				Currency: Currency,
+			},
+			Metadata: metadata,
+		},
+	}
+}
+
+// unbonds returns true if the call creates an unbonding purse.
+func (c *stakingCall) unbonds() bool {
+	return c.opType != DelegateOpType && c.opType != AddBidOpType
+}
+
+// filterTransfers drops the transfer records of the bonding itself
+// (from the caller main purse, for the bonded amount), as the
+// staking operations already account for it.
+func (c *stakingCall) filterTransfers(transfers []*rpc.Transfer, mainPurse string) []*rpc.Transfer {
+	if c.unbonds() {
+		return transfers
+	}
+
+	filtered := make([]*rpc.Transfer, 0, len(transfers))
+	for _, transfer := range transfers {
+		if PurseWithoutIndex(transfer.Source) == PurseWithoutIndex(mainPurse) && transfer.Amount == c.amount {
+			continue
+		}
+		filtered = append(filtered, transfer)
+	}
+
+	return filtered
+}
+
+// unbondingBalance returns the amount being unbonded by the
+// account at the provided block.
+func (ec *Client) unbondingBalance(
+	ctx context.Context,
+	account *RosettaTypes.AccountIdentifier,
+	block *rpc.Block,
+) (*big.Int, error) {
+	validator, ok := account.SubAccount.Metadata[ValidatorMetadataKey].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s is missing from the sub account metadata", ValidatorMetadataKey)
+	}
+	validatorKey, err := address.ParsePublicKey(validator)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := accountHash(account.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	purses, err := ec.unbondingPurses(ctx, block, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := new(big.Int)
+	for _, purse := range purses {
+		if publicKeyAccount(purse.UnbonderPublicKey) != hash ||
+			!strings.EqualFold(purse.ValidatorPublicKey, validatorKey.String()) {
+			continue
+		}
+
+		amount, ok := new(big.Int).SetString(purse.Amount, 10) // nolint:gomnd
+		if !ok {
+			return nil, fmt.Errorf("invalid unbonding amount %s", purse.Amount)
+		}
+		balance.Add(balance, amount)
+	}
+
+	return balance, nil
+}
+
+// unbondingPurses returns the unbonding purses of an account
+// hash or public key in the global state of block.
+func (ec *Client) unbondingPurses(
+	ctx context.Context,
+	block *rpc.Block,
+	address string,
+) ([]rpc.UnbondingPurse, error) {
+	hash, err := accountHash(address)
+	if err != nil {
+		return nil, err
+	}
+
+	strategy, err := strategyFor(block.Header.ProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strategy.unbondingKeyPrefix() + strings.TrimPrefix(hash, accountHashPrefix)
+	item, err := ec.node.GetStateItem(ctx, block.Header.StateRootHash, key, nil)
+	if rpc.IsNotFound(err) {
+		// No pending withdrawal.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get unbonding purses of %s", err, address)
+	}
+	if item.Unbonding != nil {
+		return item.Unbonding, nil
+	}
+
+	return item.Withdraw, nil
+}
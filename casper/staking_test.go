@@ -0,0 +1,573 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+var (
+	auctionHash        = testHash(0xa1)
+	auctionPackageHash = testHash(0xa2)
+	oldAuctionHash     = testHash(0xa3)
+	otherContractHash  = testHash(0xe1)
+	otherPackageHash   = testHash(0xe2)
+)
+
+// setSystemRegistry stores the system contract
+// registry under registryKey in the state of block.
+func setSystemRegistry(node *fakeNode, block *rpc.Block, registryKey string) {
+	node.setItem(block.Header.StateRootHash, registryKey, &rpc.StoredValue{
+		CLValue: &rpc.CLValue{
+			CLType: []byte(`{"Map":{"key":"String","value":{"ByteArray":32}}}`),
+			Parsed: []byte(fmt.Sprintf(
+				`[{"key":"auction","value":"%s"},{"key":"mint","value":"%s"}]`,
+				auctionHash,
+				testHash(0xa4),
+			)),
+		},
+	})
+}
+
+// setContracts stores the auction contracts and
+// another contract in the state of block.
+func setContracts(node *fakeNode, block *rpc.Block) {
+	for hash, packageHash := range map[string]string{
+		auctionHash:       auctionPackageHash,
+		oldAuctionHash:    auctionPackageHash,
+		otherContractHash: otherPackageHash,
+	} {
+		node.setItem(block.Header.StateRootHash, hashKeyPrefix+hash, &rpc.StoredValue{
+			Contract: &rpc.Contract{ContractPackageHash: "contract-package-wasm" + packageHash},
+		})
+	}
+}
+
+// writeBid returns the 1.x transform writing the bid of validator.
+func writeBid(validator string) rpc.TransformEntry {
+	return rpc.TransformEntry{
+		Key: "bid-" + testHash(0xbb),
+		Transform: json.RawMessage(fmt.Sprintf(
+			`{"WriteBid":{"validator_public_key":"%s","staked_amount":"1000","delegators":[]}}`,
+			validator,
+		)),
+	}
+}
+
+// writeUnbondingPurses returns the 1.x transform variant
+// writing the unbonding purses of unbonder.
+func writeUnbondingPurses(variant string, unbonder string, purses ...rpc.UnbondingPurse) rpc.TransformEntry {
+	value, err := json.Marshal(map[string][]rpc.UnbondingPurse{variant: purses})
+	if err != nil {
+		panic(err)
+	}
+
+	return rpc.TransformEntry{Key: "unbond-" + testAccountHash(unbonder)[len(accountHashPrefix):], Transform: value}
+}
+
+// stakingDeploy returns a deploy running session
+// with the arguments of a delegation.
+func stakingDeploy(session rpc.ExecutableDeployItem, delegator string, validator string) *rpc.Deploy {
+	args := rpc.RuntimeArgs{
+		{Name: "delegator", Value: stringValue(delegator)},
+		{Name: "validator", Value: stringValue(validator)},
+		{Name: "amount", Value: stringValue("500000000000")},
+	}
+	switch {
+	case session.ModuleBytes != nil:
+		session.ModuleBytes.Args = args
+	case session.StoredContract() != nil:
+		session.StoredContract().Args = args
+	}
+
+	deploy := transferDeploy(testHash(0x01), delegator)
+	deploy.Session = session
+
+	return &deploy
+}
+
+func TestDeployStakingCall(t *testing.T) {
+	delegator := testPublicKey(0x10)
+	validator := testPublicKey(0x20)
+
+	tests := map[string]struct {
+		protocolVersion string
+		session         rpc.ExecutableDeployItem
+		transforms      []rpc.TransformEntry
+		registryAtBlock bool
+		want            string
+	}{
+		"auction by hash": {
+			session: rpc.ExecutableDeployItem{
+				StoredContractByHash: &rpc.StoredContract{Hash: auctionHash, EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+			want:            DelegateOpType,
+		},
+		"prefixed auction hash": {
+			session: rpc.ExecutableDeployItem{
+				StoredContractByHash: &rpc.StoredContract{Hash: "hash-" + auctionHash, EntryPoint: "undelegate"},
+			},
+			registryAtBlock: true,
+			want:            UndelegateOpType,
+		},
+		"earlier auction version": {
+			session: rpc.ExecutableDeployItem{
+				StoredContractByHash: &rpc.StoredContract{Hash: oldAuctionHash, EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+			want:            DelegateOpType,
+		},
+		"auction package": {
+			session: rpc.ExecutableDeployItem{
+				StoredVersionedContractByHash: &rpc.StoredContract{Hash: auctionPackageHash, EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+			want:            DelegateOpType,
+		},
+		"block older than the registry": {
+			protocolVersion: "1.3.0",
+			session: rpc.ExecutableDeployItem{
+				StoredContractByHash: &rpc.StoredContract{Hash: oldAuctionHash, EntryPoint: "delegate"},
+			},
+			want: DelegateOpType,
+		},
+		"2.0 entity registry": {
+			protocolVersion: "2.0.0",
+			session: rpc.ExecutableDeployItem{
+				StoredContractByHash: &rpc.StoredContract{Hash: auctionHash, EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+			want:            DelegateOpType,
+		},
+		"other contract with an auction entry point": {
+			session: rpc.ExecutableDeployItem{
+				StoredContractByHash: &rpc.StoredContract{Hash: otherContractHash, EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+		},
+		"other package with an auction entry point": {
+			session: rpc.ExecutableDeployItem{
+				StoredVersionedContractByHash: &rpc.StoredContract{Hash: otherPackageHash, EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+		},
+		"unknown contract with an auction entry point": {
+			session: rpc.ExecutableDeployItem{
+				StoredContractByHash: &rpc.StoredContract{Hash: testHash(0xee), EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+		},
+		"auction by name": {
+			session: rpc.ExecutableDeployItem{
+				StoredContractByName: &rpc.StoredContract{Name: "auction", EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+			want:            DelegateOpType,
+		},
+		"auction package by name": {
+			session: rpc.ExecutableDeployItem{
+				StoredVersionedContractByName: &rpc.StoredContract{Name: "auction_package", EntryPoint: "undelegate"},
+			},
+			registryAtBlock: true,
+			want:            UndelegateOpType,
+		},
+		"other contract by name": {
+			session: rpc.ExecutableDeployItem{
+				StoredContractByName: &rpc.StoredContract{Name: "other", EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+		},
+		"name missing from the named keys": {
+			session: rpc.ExecutableDeployItem{
+				StoredContractByName: &rpc.StoredContract{Name: "missing", EntryPoint: "delegate"},
+			},
+			registryAtBlock: true,
+		},
+		"auction entry point not staking": {
+			session: rpc.ExecutableDeployItem{
+				StoredContractByHash: &rpc.StoredContract{Hash: auctionHash, EntryPoint: "read_era_id"},
+			},
+			registryAtBlock: true,
+		},
+		"delegate.wasm": {
+			session: rpc.ExecutableDeployItem{
+				ModuleBytes: &rpc.ModuleBytes{ModuleBytes: "0061736d01000000"},
+			},
+			transforms:      []rpc.TransformEntry{writeBid(validator)},
+			registryAtBlock: true,
+			want:            DelegateOpType,
+		},
+		"session code writing no auction value": {
+			session: rpc.ExecutableDeployItem{
+				ModuleBytes: &rpc.ModuleBytes{ModuleBytes: "0061736d01000000"},
+			},
+			registryAtBlock: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			protocolVersion := test.protocolVersion
+			if len(protocolVersion) == 0 {
+				protocolVersion = "1.4.0"
+			}
+			block := testBlock(10, protocolVersion, validator)
+			latest := testBlock(20, "1.5.0", validator)
+
+			node := newFakeNode()
+			node.addBlock(block)
+			node.addBlock(latest)
+			registryKey := systemContractRegistryKey
+			if protocolVersion == "2.0.0" {
+				registryKey = systemEntityRegistryKey
+			}
+			setContracts(node, block)
+			if test.registryAtBlock {
+				setSystemRegistry(node, block, registryKey)
+			} else {
+				setContracts(node, latest)
+				setSystemRegistry(node, latest, systemContractRegistryKey)
+			}
+
+			node.addAccount(
+				block.Header.StateRootHash,
+				delegator,
+				testPurse(0xc1),
+				rpc.NamedKey{Name: "auction", Key: hashKeyPrefix + auctionHash},
+				rpc.NamedKey{Name: "auction_package", Key: hashKeyPrefix + auctionPackageHash},
+				rpc.NamedKey{Name: "other", Key: hashKeyPrefix + otherContractHash},
+			)
+
+			client := newTestClient(t, node, nil)
+			deploy := stakingDeploy(test.session, delegator, validator)
+			outcome := &rpc.ExecutionOutcome{Effect: rpc.ExecutionEffect{Transforms: test.transforms}}
+			call, err := client.deployStakingCall(context.Background(), deploy, outcome, block)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(test.want) == 0 {
+				if call != nil {
+					t.Fatalf("got %s call, want none", call.opType)
+				}
+				return
+			}
+			if call == nil {
+				t.Fatalf("got no call, want %s", test.want)
+			}
+			want := &stakingCall{
+				opType:    test.want,
+				publicKey: delegator,
+				validator: validator,
+				amount:    "500000000000",
+			}
+			if !reflect.DeepEqual(call, want) {
+				t.Fatalf("got %+v, want %+v", call, want)
+			}
+		})
+	}
+}
+
+func TestFilterTransfers(t *testing.T) {
+	mainPurse := testPurse(0xc1)
+	bondingPurse := testPurse(0xb1)
+	otherPurse := testPurse(0xc2)
+	transfer := func(source string, target string, amount string) *rpc.Transfer {
+		return &rpc.Transfer{Source: source, Target: target, Amount: amount}
+	}
+
+	tests := map[string]struct {
+		opType    string
+		transfers []*rpc.Transfer
+		want      []*rpc.Transfer
+	}{
+		"delegation": {
+			opType: DelegateOpType,
+			transfers: []*rpc.Transfer{
+				transfer(mainPurse, bondingPurse, "100"),
+			},
+			want: []*rpc.Transfer{},
+		},
+		"bid": {
+			opType: AddBidOpType,
+			transfers: []*rpc.Transfer{
+				transfer(mainPurse, bondingPurse, "100"),
+			},
+			want: []*rpc.Transfer{},
+		},
+		"main purse with other access rights": {
+			opType: DelegateOpType,
+			transfers: []*rpc.Transfer{
+				transfer(mainPurse[:len(mainPurse)-3]+"001", bondingPurse, "100"),
+			},
+			want: []*rpc.Transfer{},
+		},
+		"other amount": {
+			opType: DelegateOpType,
+			transfers: []*rpc.Transfer{
+				transfer(mainPurse, bondingPurse, "100"),
+				transfer(mainPurse, otherPurse, "7"),
+			},
+			want: []*rpc.Transfer{
+				transfer(mainPurse, otherPurse, "7"),
+			},
+		},
+		"other source": {
+			opType: DelegateOpType,
+			transfers: []*rpc.Transfer{
+				transfer(otherPurse, bondingPurse, "100"),
+			},
+			want: []*rpc.Transfer{
+				transfer(otherPurse, bondingPurse, "100"),
+			},
+		},
+		"undelegation": {
+			opType: UndelegateOpType,
+			transfers: []*rpc.Transfer{
+				transfer(mainPurse, bondingPurse, "100"),
+			},
+			want: []*rpc.Transfer{
+				transfer(mainPurse, bondingPurse, "100"),
+			},
+		},
+		"redelegation": {
+			opType: RedelegateOpType,
+			transfers: []*rpc.Transfer{
+				transfer(mainPurse, bondingPurse, "100"),
+			},
+			want: []*rpc.Transfer{
+				transfer(mainPurse, bondingPurse, "100"),
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			call := &stakingCall{opType: test.opType, amount: "100"}
+			got := call.filterTransfers(test.transfers, mainPurse)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestModuleBytesDelegationTransfers(t *testing.T) {
+	delegator := testPublicKey(0x10)
+	validator := testPublicKey(0x20)
+	mainPurse := testPurse(0xc1)
+	bondingPurse := testPurse(0xb1)
+
+	block := testBlock(10, "1.4.0", validator)
+	deploy := stakingDeploy(rpc.ExecutableDeployItem{
+		ModuleBytes: &rpc.ModuleBytes{ModuleBytes: "0061736d01000000"},
+	}, delegator, validator)
+	block.Body.DeployHashes = []string{deploy.Hash}
+
+	node := newFakeNode()
+	node.addBlock(testBlock(9, "1.4.0", validator))
+	node.addBlock(block, &rpc.Transfer{
+		DeployHash:      deploy.Hash,
+		TransactionHash: rpc.DeployHash(deploy.Hash),
+		From:            testAccountHash(delegator),
+		Source:          mainPurse,
+		Target:          bondingPurse,
+		Amount:          "500000000000",
+	})
+	node.addAccount(block.Header.StateRootHash, delegator, mainPurse)
+	node.addAccount(block.Header.StateRootHash, validator, testPurse(0xc2))
+	setContracts(node, block)
+	setSystemRegistry(node, block, systemContractRegistryKey)
+	node.addDeploy(*deploy, block, rpc.ExecutionResult{Success: &rpc.ExecutionOutcome{
+		Effect: rpc.ExecutionEffect{Transforms: []rpc.TransformEntry{writeBid(validator)}},
+		Cost:   "100000000",
+	}})
+
+	client := newTestClient(t, node, nil)
+	transaction, err := client.BlockTransaction(
+		context.Background(),
+		&RosettaTypes.BlockIdentifier{Hash: block.Hash, Index: int64(block.Header.Height)},
+		&RosettaTypes.TransactionIdentifier{Hash: deployHash(0x01)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bonding transfer is the DELEGATE operation.
+	operations := []string{}
+	for _, operation := range transaction.Operations {
+		if operation.Type == DelegateOpType || operation.Type == TransferOpType {
+			operations = append(operations, operation.Type+" "+operation.Amount.Value)
+		}
+	}
+	want := []string{
+		DelegateOpType + " -500000000000",
+		DelegateOpType + " 500000000000",
+	}
+	if !reflect.DeepEqual(operations, want) {
+		t.Fatalf("got operations %v, want %v", operations, want)
+	}
+}
+
+func TestModuleBytesStakingCall(t *testing.T) {
+	delegator := testPublicKey(0x10)
+	validator := testPublicKey(0x20)
+	newValidator := testPublicKey(0x30)
+	args := rpc.RuntimeArgs{
+		{Name: "delegator", Value: stringValue(delegator)},
+		{Name: "validator", Value: stringValue(validator)},
+		{Name: "amount", Value: stringValue("500")},
+	}
+	redelegationArgs := append(append(rpc.RuntimeArgs{}, args...), rpc.NamedArg{
+		Name:  "new_validator",
+		Value: stringValue(newValidator),
+	})
+	unbondingPurse := func(unbonder string, amount string, newValidator *string) rpc.UnbondingPurse {
+		return rpc.UnbondingPurse{
+			BondingPurse:       testPurse(0xb1),
+			ValidatorPublicKey: validator,
+			UnbonderPublicKey:  unbonder,
+			EraOfCreation:      7,
+			Amount:             amount,
+			NewValidator:       newValidator,
+		}
+	}
+	bidKind := func(kind string) rpc.TransformEntry {
+		return rpc.TransformEntry{
+			Key:       "bid-addr-" + testHash(0xbb),
+			Transform: json.RawMessage(fmt.Sprintf(`{"Write":{"BidKind":{"%s":{}}}}`, kind)),
+		}
+	}
+
+	tests := map[string]struct {
+		args       rpc.RuntimeArgs
+		transforms []rpc.TransformEntry
+		want       *stakingCall
+		err        bool
+	}{
+		"delegation": {
+			args:       args,
+			transforms: []rpc.TransformEntry{writeBid(validator)},
+			want:       &stakingCall{opType: DelegateOpType, publicKey: delegator, validator: validator, amount: "500"},
+		},
+		"undelegation": {
+			args: args,
+			transforms: []rpc.TransformEntry{
+				writeBid(validator),
+				writeUnbondingPurses("WriteUnbonding", delegator, unbondingPurse(delegator, "500", nil)),
+			},
+			want: &stakingCall{opType: UndelegateOpType, publicKey: delegator, validator: validator, amount: "500"},
+		},
+		"redelegation": {
+			args: redelegationArgs,
+			transforms: []rpc.TransformEntry{
+				writeUnbondingPurses("WriteUnbonding", delegator, unbondingPurse(delegator, "500", &newValidator)),
+			},
+			want: &stakingCall{
+				opType:       RedelegateOpType,
+				publicKey:    delegator,
+				validator:    validator,
+				newValidator: newValidator,
+				amount:       "500",
+			},
+		},
+		"2.x delegation": {
+			args:       args,
+			transforms: []rpc.TransformEntry{bidKind("Delegator")},
+			want:       &stakingCall{opType: DelegateOpType, publicKey: delegator, validator: validator, amount: "500"},
+		},
+		"2.x undelegation": {
+			args:       args,
+			transforms: []rpc.TransformEntry{bidKind("Delegator"), bidKind("Unbond")},
+			want:       &stakingCall{opType: UndelegateOpType, publicKey: delegator, validator: validator, amount: "500"},
+		},
+		"undelegation from unbonding purses": {
+			transforms: []rpc.TransformEntry{
+				writeBid(validator),
+				writeUnbondingPurses(
+					"WriteUnbonding",
+					delegator,
+					unbondingPurse(delegator, "100", nil),
+					unbondingPurse(delegator, "500", nil),
+				),
+			},
+			want: &stakingCall{opType: UndelegateOpType, publicKey: delegator, validator: validator, amount: "500"},
+		},
+		"redelegation from withdraw purses": {
+			transforms: []rpc.TransformEntry{
+				writeUnbondingPurses("WriteWithdraw", delegator, unbondingPurse(delegator, "500", &newValidator)),
+			},
+			want: &stakingCall{
+				opType:       RedelegateOpType,
+				publicKey:    delegator,
+				validator:    validator,
+				newValidator: newValidator,
+				amount:       "500",
+			},
+		},
+		"bid withdrawal": {
+			transforms: []rpc.TransformEntry{
+				writeBid(validator),
+				writeUnbondingPurses("WriteUnbonding", validator, unbondingPurse(validator, "500", nil)),
+			},
+		},
+		"delegation without arguments": {
+			transforms: []rpc.TransformEntry{writeBid(validator)},
+		},
+		"no auction value": {
+			args: args,
+			transforms: []rpc.TransformEntry{{
+				Key:       "balance-" + testHash(0xc1),
+				Transform: json.RawMessage(`{"AddUInt512":"500"}`),
+			}},
+		},
+		"invalid unbonding purses": {
+			args: args,
+			transforms: []rpc.TransformEntry{{
+				Key:       "unbond-" + testHash(0x10),
+				Transform: json.RawMessage(`{"WriteUnbonding":{}}`),
+			}},
+			err: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			outcome := &rpc.ExecutionOutcome{Effect: rpc.ExecutionEffect{Transforms: test.transforms}}
+			call, err := moduleBytesStakingCall(test.args, outcome)
+			if test.err {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", call)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(call, test.want) {
+				t.Fatalf("got %+v, want %+v", call, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// AccountMetadataKey, TimestampMetadataKey and the following keys
+	// hold the fields of a transaction in its metadata.
+	AccountMetadataKey      = "account"
+	TimestampMetadataKey    = "timestamp"
+	TTLMetadataKey          = "ttl"
+	GasPriceMetadataKey     = "gas_price"
+	PricingModeMetadataKey  = "pricing_mode"
+	ChainNameMetadataKey    = "chain_name"
+	DependenciesMetadataKey = "dependencies"
+	BodyHashMetadataKey     = "body_hash"
+	SessionKindMetadataKey  = "session_kind"
+	EntryPointMetadataKey   = "entry_point"
+	ContractHashMetadataKey = "contract_hash"
+	ContractNameMetadataKey = "contract_name"
+	CostMetadataKey         = "cost"
+	ApprovalsMetadataKey    = "approvals"
+	ErrorMessageMetadataKey = "error_message"
+
+	// DeployHashTag may prefix the transaction hash of legacy
+	// deploys in requests. Deploy hashes are returned untagged,
+	// as before Casper 2.0, so that their identifiers do not
+	// change across the upgrade.
+	DeployHashTag = "deploy-"
+
+	// Version1HashTag prefixes the transaction hash of
+	// the TransactionV1 introduced by Casper 2.0.
+	Version1HashTag = "version1-"
+)
+
+// TransactionHash returns the identifier of a transaction: the
+// hash of a TransactionV1 tagged with Version1HashTag, or the
+// plain hash of a legacy deploy.
+func TransactionHash(hash rpc.TransactionHash) string {
+	if hash.Version1 != nil {
+		return Version1HashTag + *hash.Version1
+	}
+
+	return hash.Hash()
+}
+
+// parseTransactionHash parses a transaction identifier. Untagged
+// hashes and hashes tagged with DeployHashTag are deploy hashes.
+func parseTransactionHash(hash string) (rpc.TransactionHash, error) {
+	switch {
+	case strings.HasPrefix(hash, Version1HashTag):
+		return rpc.Version1Hash(strings.TrimPrefix(hash, Version1HashTag)), nil
+	case strings.HasPrefix(hash, DeployHashTag):
+		return rpc.DeployHash(strings.TrimPrefix(hash, DeployHashTag)), nil
+	case len(hash) == 0:
+		return rpc.TransactionHash{}, fmt.Errorf("empty transaction hash")
+	}
+
+	return rpc.DeployHash(hash), nil
+}
+
+// blockTransactionHashes returns the tagged hashes of the
+// transactions of block, in canonical order: deploy hashes
+// followed by transfer hashes for 1.x blocks, transactions
+// by category for 2.x blocks.
+func blockTransactionHashes(block *rpc.Block) []string {
+	hashes := []string{}
+	for _, hash := range block.Body.DeployHashes {
+		hashes = append(hashes, TransactionHash(rpc.DeployHash(hash)))
+	}
+	for _, hash := range block.Body.TransferHashes {
+		hashes = append(hashes, TransactionHash(rpc.DeployHash(hash)))
+	}
+	for _, hash := range block.Body.Transactions {
+		hashes = append(hashes, TransactionHash(hash))
+	}
+
+	return hashes
+}
+
+// executedTransaction is a legacy deploy or
+// a TransactionV1, with its execution results.
+type executedTransaction struct {
+	hash             string
+	initiator        string
+	deploy           *rpc.Deploy
+	version1         *rpc.TransactionV1
+	executionResults []rpc.BlockExecutionResult
+}
+
+// getTransaction fetches the transaction with the provided
+// tagged hash. Deploys are fetched with info_get_deploy,
+// which is served by 1.x and 2.x nodes.
+func (ec *Client) getTransaction(ctx context.Context, hash string) (*executedTransaction, error) {
+	transactionHash, err := parseTransactionHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if transactionHash.Deploy != nil {
+		deploy, err := ec.node.GetDeploy(ctx, *transactionHash.Deploy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not get deploy", err)
+		}
+
+		return &executedTransaction{
+			hash:             TransactionHash(transactionHash),
+			initiator:        deploy.Deploy.Header.Account,
+			deploy:           &deploy.Deploy,
+			executionResults: deploy.ExecutionResults,
+		}, nil
+	}
+
+	transaction, err := ec.node.GetTransaction(ctx, transactionHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get transaction", err)
+	}
+	if transaction.Transaction.Version1 == nil {
+		return nil, fmt.Errorf("%s is not a version 1 transaction", hash)
+	}
+
+	return &executedTransaction{
+		hash:             TransactionHash(transactionHash),
+		initiator:        transaction.Transaction.Version1.Payload.InitiatorAddr.String(),
+		version1:         transaction.Transaction.Version1,
+		executionResults: transaction.ExecutionResults,
+	}, nil
+}
+
+// fetchTransactions fetches the transactions with the provided
+// hashes concurrently, bounded by the client deploy semaphore, and
+// returns them in the same order.
+func (ec *Client) fetchTransactions(ctx context.Context, hashes []string) ([]*executedTransaction, error) {
+	transactions := make([]*executedTransaction, len(hashes))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, hash := range hashes {
+		if err := ec.deploySemaphore.Acquire(gctx, semaphoreDeployWeight); err != nil {
+			if waitErr := g.Wait(); waitErr != nil {
+				return nil, waitErr
+			}
+			return nil, fmt.Errorf("%w: could not fetch deploys", err)
+		}
+
+		i, hash := i, hash
+		g.Go(func() error {
+			defer ec.deploySemaphore.Release(semaphoreDeployWeight)
+
+			transaction, err := ec.getTransaction(gctx, hash)
+			if err != nil {
+				return fmt.Errorf("%w: could not get transaction %s", err, hash)
+			}
+			transactions[i] = transaction
+
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// executionResult returns the result of the execution of the
+// transaction in the block with the provided hash. A transaction
+// may be executed in several blocks, across forks or re-executions.
+func (t *executedTransaction) executionResult(blockHash string) (*rpc.ExecutionResult, error) {
+	for i := range t.executionResults {
+		if strings.EqualFold(t.executionResults[i].BlockHash, blockHash) {
+			return &t.executionResults[i].Result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: transaction %s in block %s", ErrExecutionResultNotFound, t.hash, blockHash)
+}
+
+// paymentAmount returns the amount paid by a standard payment
+// or a payment limited transaction, "0" if it is unknown.
+func (t *executedTransaction) paymentAmount() (string, error) {
+	if t.deploy != nil {
+		// Custom payment code takes any arguments.
+		payment := t.deploy.Payment.ModuleBytes
+		if payment == nil || len(payment.ModuleBytes) > 0 {
+			return "0", nil
+		}
+
+		return readPaymentAmount(t.deploy)
+	}
+
+	if t.version1.Payload.PricingMode.PaymentLimited != nil {
+		return strconv.FormatUint(t.version1.Payload.PricingMode.PaymentLimited.PaymentAmount, 10), nil // nolint:gomnd
+	}
+
+	return "0", nil
+}
+
+// initiatorMainPurse returns the main purse of the
+// initiator of a transaction, a public key or an
+// account hash.
+func (ec *Client) initiatorMainPurse(ctx context.Context, initiator string, stateRootHash string) (string, error) {
+	hash, err := accountHash(initiator)
+	if err != nil {
+		return "", err
+	}
+
+	return ec.accountMainPurse(ctx, stateRootHash, hash)
+}
+
+// metadata returns the metadata of the transaction executed
+// with outcome: its header fields, what its session calls,
+// its cost, approvals and error message on failure.
+func (t *executedTransaction) metadata(outcome *rpc.ExecutionOutcome) (map[string]interface{}, error) {
+	metadata := map[string]interface{}{
+		AccountMetadataKey: t.initiator,
+		CostMetadataKey:    outcome.Cost,
+	}
+	if len(outcome.ErrorMessage) > 0 {
+		metadata[ErrorMessageMetadataKey] = outcome.ErrorMessage
+	}
+
+	if t.version1 != nil {
+		if err := t.version1Metadata(metadata); err != nil {
+			return nil, fmt.Errorf("%w: invalid transaction %s", err, t.hash)
+		}
+		return metadata, nil
+	}
+
+	header := t.deploy.Header
+	metadata[TimestampMetadataKey] = header.Timestamp.Format(time.RFC3339Nano)
+	metadata[TTLMetadataKey] = header.TTL
+	metadata[GasPriceMetadataKey] = header.GasPrice
+	metadata[ChainNameMetadataKey] = header.ChainName
+	metadata[DependenciesMetadataKey] = header.Dependencies
+	metadata[BodyHashMetadataKey] = header.BodyHash
+	metadata[SessionKindMetadataKey] = t.deploy.Session.Kind()
+	metadata[ApprovalsMetadataKey] = t.deploy.Approvals
+	if contract := t.deploy.Session.StoredContract(); contract != nil {
+		metadata[EntryPointMetadataKey] = contract.EntryPoint
+		if len(contract.Hash) > 0 {
+			metadata[ContractHashMetadataKey] = contract.Hash
+		}
+		if len(contract.Name) > 0 {
+			metadata[ContractNameMetadataKey] = contract.Name
+		}
+	}
+
+	return metadata, nil
+}
+
+// version1Metadata adds the payload fields of a TransactionV1 to
+// metadata: its target kind, entry point and pricing mode, and the
+// contract it calls.
+func (t *executedTransaction) version1Metadata(metadata map[string]interface{}) error {
+	payload := &t.version1.Payload
+	metadata[TimestampMetadataKey] = payload.Timestamp.Format(time.RFC3339Nano)
+	metadata[TTLMetadataKey] = payload.TTL
+	metadata[ChainNameMetadataKey] = payload.ChainName
+	metadata[ApprovalsMetadataKey] = t.version1.Approvals
+	metadata[PricingModeMetadataKey] = payload.PricingMode.Name()
+	if gasPrice, ok := payload.PricingMode.GasPriceTolerance(); ok {
+		metadata[GasPriceMetadataKey] = gasPrice
+	}
+
+	target, err := payload.Target()
+	if err != nil {
+		return err
+	}
+	metadata[SessionKindMetadataKey] = target.Kind()
+
+	entryPoint, err := payload.EntryPoint()
+	if err != nil {
+		return err
+	}
+	metadata[EntryPointMetadataKey] = entryPoint
+
+	if target.Stored == nil {
+		return nil
+	}
+
+	id := target.Stored.ID
+	switch {
+	case id.ByHash != nil:
+		metadata[ContractHashMetadataKey] = *id.ByHash
+	case id.ByName != nil:
+		metadata[ContractNameMetadataKey] = *id.ByName
+	case id.ByPackageHash != nil:
+		metadata[ContractHashMetadataKey] = id.ByPackageHash.Addr
+	case id.ByPackageName != nil:
+		metadata[ContractNameMetadataKey] = id.ByPackageName.Name
+	}
+
+	return nil
+}
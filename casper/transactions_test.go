@@ -0,0 +1,253 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+func TestTransactionHash(t *testing.T) {
+	tests := map[string]struct {
+		hash rpc.TransactionHash
+		want string
+	}{
+		"deploy": {
+			hash: rpc.DeployHash(testHash(1)),
+			want: testHash(1),
+		},
+		"version 1 transaction": {
+			hash: rpc.Version1Hash(testHash(1)),
+			want: Version1HashTag + testHash(1),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := TransactionHash(test.hash); got != test.want {
+				t.Fatalf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTransactionHash(t *testing.T) {
+	tests := map[string]struct {
+		hash    string
+		want    rpc.TransactionHash
+		invalid bool
+	}{
+		"deploy": {
+			hash: testHash(1),
+			want: rpc.DeployHash(testHash(1)),
+		},
+		"tagged deploy": {
+			hash: DeployHashTag + testHash(1),
+			want: rpc.DeployHash(testHash(1)),
+		},
+		"version 1 transaction": {
+			hash: Version1HashTag + testHash(1),
+			want: rpc.Version1Hash(testHash(1)),
+		},
+		"empty": {
+			invalid: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseTransactionHash(test.hash)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("no error parsing %q", test.hash)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetTransactionKeepsDeployHashes(t *testing.T) {
+	block := testBlock(10, "1.4.0", testPublicKey(0xa0))
+	node := newFakeNode()
+	node.addBlock(block)
+	node.addDeploy(transferDeploy(testHash(1), testPublicKey(0xa1)), block, rpc.ExecutionResult{
+		Success: &rpc.ExecutionOutcome{Cost: "100000000"},
+	})
+
+	client := newTestClient(t, node, nil)
+	for _, hash := range []string{testHash(1), DeployHashTag + testHash(1)} {
+		transaction, err := client.getTransaction(context.Background(), hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if transaction.hash != testHash(1) {
+			t.Fatalf("transaction hash %s, want %s", transaction.hash, testHash(1))
+		}
+	}
+}
+
+func TestExecutionResultOfBlock(t *testing.T) {
+	orphan := testBlock(10, "1.4.0", testPublicKey(0xa0))
+	orphan.Hash = testHash(0xbe)
+	block := testBlock(10, "1.4.0", testPublicKey(0xa0))
+	other := testBlock(11, "1.4.0", testPublicKey(0xa0))
+	other.Body.DeployHashes = []string{testHash(1)}
+
+	// The deploy was executed in an orphaned block
+	// before being executed in block.
+	node := newFakeNode()
+	node.addBlock(block)
+	node.addBlock(other)
+	node.addDeploy(transferDeploy(testHash(1), testPublicKey(0xa1)), orphan, rpc.ExecutionResult{
+		Failure: &rpc.ExecutionOutcome{Cost: "1", ErrorMessage: "orphaned"},
+	})
+	node.deploys[testHash(1)].ExecutionResults = append(
+		node.deploys[testHash(1)].ExecutionResults,
+		rpc.BlockExecutionResult{
+			BlockHash: block.Hash,
+			Result:    rpc.ExecutionResult{Success: &rpc.ExecutionOutcome{Cost: "2"}},
+		},
+	)
+
+	client := newTestClient(t, node, nil)
+	transaction, err := client.getTransaction(context.Background(), testHash(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		blockHash string
+		cost      string
+		err       error
+	}{
+		"orphaned block": {
+			blockHash: orphan.Hash,
+			cost:      "1",
+		},
+		"block": {
+			blockHash: block.Hash,
+			cost:      "2",
+		},
+		"upper case block hash": {
+			blockHash: strings.ToUpper(block.Hash),
+			cost:      "2",
+		},
+		"block without result": {
+			blockHash: other.Hash,
+			err:       ErrExecutionResultNotFound,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := transaction.executionResult(test.blockHash)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outcome, err := result.Outcome()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if outcome.Cost != test.cost {
+				t.Fatalf("cost %s, want %s", outcome.Cost, test.cost)
+			}
+		})
+	}
+
+	// The deploy is not in a block listing it
+	// without its execution result.
+	_, err = client.BlockTransaction(
+		context.Background(),
+		&RosettaTypes.BlockIdentifier{Index: int64(other.Header.Height), Hash: other.Hash},
+		&RosettaTypes.TransactionIdentifier{Hash: deployHash(1)},
+	)
+	if !errors.Is(err, ErrTransactionNotInBlock) {
+		t.Fatalf("error %v, want %v", err, ErrTransactionNotInBlock)
+	}
+}
+
+func TestVersion1TransactionMetadata(t *testing.T) {
+	contractHash := testHash(0xcc)
+	transaction := &executedTransaction{
+		hash:      TransactionHash(rpc.Version1Hash(testHash(1))),
+		initiator: testPublicKey(0xa1),
+		version1: &rpc.TransactionV1{
+			Hash: testHash(1),
+			Payload: rpc.TransactionV1Payload{
+				Timestamp: time.Unix(1600000000, 0).UTC(),
+				TTL:       "30m",
+				ChainName: "casper-test",
+				PricingMode: rpc.PricingMode{
+					Fixed: &rpc.FixedPricing{GasPriceTolerance: 3},
+				},
+				Fields: map[string]json.RawMessage{
+					"target": json.RawMessage(
+						`{"Stored": {"id": {"ByHash": "` + contractHash + `"}, "runtime": "VmCasperV1"}}`,
+					),
+					"entry_point": json.RawMessage(`{"Custom": "delegate"}`),
+				},
+			},
+		},
+	}
+
+	metadata, err := transaction.metadata(&rpc.ExecutionOutcome{Cost: "100", ErrorMessage: "User error: 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		SessionKindMetadataKey:  "StoredByHash",
+		EntryPointMetadataKey:   "delegate",
+		ContractHashMetadataKey: contractHash,
+		PricingModeMetadataKey:  "Fixed",
+		GasPriceMetadataKey:     uint8(3),
+		CostMetadataKey:         "100",
+		ErrorMessageMetadataKey: "User error: 1",
+		ChainNameMetadataKey:    "casper-test",
+	}
+	for key, value := range want {
+		if !reflect.DeepEqual(metadata[key], value) {
+			t.Errorf("%s is %v, want %v", key, metadata[key], value)
+		}
+	}
+
+	delete(transaction.version1.Payload.Fields, "entry_point")
+	if _, err := transaction.metadata(&rpc.ExecutionOutcome{}); err == nil {
+		t.Fatal("no error without entry point")
+	}
+}
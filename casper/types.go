@@ -47,6 +47,42 @@ const (
 	// FeeOpType is used to represent fee operations.
 	FeeOpType = "FEE"
 
+	// RewardOpType is used to represent the seigniorage
+	// rewards of validators and delegators.
+	RewardOpType = "REWARD"
+
+	// DelegateOpType is used to represent delegations.
+	DelegateOpType = "DELEGATE"
+
+	// UndelegateOpType is used to represent undelegations.
+	UndelegateOpType = "UNDELEGATE"
+
+	// RedelegateOpType is used to represent redelegations.
+	RedelegateOpType = "REDELEGATE"
+
+	// AddBidOpType is used to represent validator bids.
+	AddBidOpType = "ADD_BID"
+
+	// WithdrawBidOpType is used to represent validator
+	// bid withdrawals.
+	WithdrawBidOpType = "WITHDRAW_BID"
+
+	// GenesisOpType is used to represent the allocations
+	// of the genesis block.
+	GenesisOpType = "GENESIS"
+
+	// UnbondPayoutOpType is used to represent the payout
+	// of an unbonded amount at the end of an era.
+	UnbondPayoutOpType = "UNBOND_PAYOUT"
+
+	// StakedSubAccount is the sub account holding the
+	// amount staked by an account with a validator.
+	StakedSubAccount = "staked"
+
+	// UnbondingSubAccount is the sub account holding the
+	// amount being unbonded by an account from a validator.
+	UnbondingSubAccount = "unbonding"
+
 	// SuccessStatus is the status of any
 	// Ethereum operation considered successful.
 	SuccessStatus = "SUCCESS"
@@ -112,6 +148,14 @@ var (
 	OperationTypes = []string{
 		TransferOpType,
 		FeeOpType,
+		RewardOpType,
+		DelegateOpType,
+		UndelegateOpType,
+		RedelegateOpType,
+		AddBidOpType,
+		WithdrawBidOpType,
+		UnbondPayoutOpType,
+		GenesisOpType,
 	}
 
 	// OperationStatuses are all supported operation statuses.
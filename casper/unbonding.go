@@ -0,0 +1,358 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	"github.com/BurntSushi/toml"
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// unbondPayoutsTransactionPrefix prefixes the hash of the
+	// synthetic transaction holding the unbonding payouts
+	// of an era.
+	unbondPayoutsTransactionPrefix = "unbond-payouts-"
+
+	// EraOfCreationMetadataKey is the operation metadata key
+	// holding the era an unbonding was requested in.
+	EraOfCreationMetadataKey = "era_of_creation"
+
+	// withdrawKeyPrefix and unbondKeyPrefix prefix the keys holding
+	// the unbonding purses of an account, before and since protocol
+	// version 1.5.
+	withdrawKeyPrefix = "withdraw-"
+	unbondKeyPrefix   = "unbond-"
+)
+
+// UnbondPayoutsTransactionHash returns the hash of the synthetic
+// transaction holding the unbonding payouts of a switch block.
+func UnbondPayoutsTransactionHash(blockHash string) string {
+	return unbondPayoutsTransactionPrefix + blockHash
+}
+
+// isUnbondPayoutsTransactionHash returns true if hash is the
+// hash of a synthetic unbonding payouts transaction.
+func isUnbondPayoutsTransactionHash(hash string) bool {
+	return strings.HasPrefix(hash, unbondPayoutsTransactionPrefix)
+}
+
+// chainspecCore is the core section of the chainspec.
+type chainspecCore struct {
+	Core struct {
+		UnbondingDelay uint64 `toml:"unbonding_delay"`
+	} `toml:"core"`
+}
+
+// getUnbondingDelay returns the number of eras an unbonding
+// purse waits before it is paid out, read from the chainspec.
+func (ec *Client) getUnbondingDelay(ctx context.Context) (uint64, error) {
+	ec.unbondingDelayMu.Lock()
+	defer ec.unbondingDelayMu.Unlock()
+
+	if ec.unbondingDelay != nil {
+		return *ec.unbondingDelay, nil
+	}
+
+	chainspec, err := ec.node.GetChainspec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: could not get chainspec", err)
+	}
+	content, err := hex.DecodeString(chainspec.ChainspecBytes)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid chainspec", err)
+	}
+
+	core := &chainspecCore{}
+	if err := toml.Unmarshal(content, core); err != nil {
+		return 0, fmt.Errorf("%w: unable to parse chainspec", err)
+	}
+	ec.unbondingDelay = &core.Core.UnbondingDelay
+
+	return core.Core.UnbondingDelay, nil
+}
+
+// lastBlockOfEra returns the last block of era eraID, searched by
+// height below block as era ids never decrease. It returns the
+// genesis block if eraID is negative.
+func (ec *Client) lastBlockOfEra(ctx context.Context, eraID int64, block *rpc.Block) (*rpc.Block, error) {
+	if eraID < 0 {
+		return ec.node.GetBlock(ctx, rpc.BlockByHeight(uint64(GenesisBlockIndex)))
+	}
+	if block.Header.EraID <= uint64(eraID) {
+		return block, nil
+	}
+
+	// The block at low is in era eraID or before,
+	// the block at high is after it.
+	low, high := uint64(GenesisBlockIndex), block.Header.Height
+	for high-low > 1 {
+		height := low + (high-low)/2 // nolint:gomnd
+		candidate, err := ec.node.GetBlock(ctx, rpc.BlockByHeight(height))
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not get block %d", err, height)
+		}
+
+		if candidate.Header.EraID > uint64(eraID) {
+			high = height
+		} else {
+			low = height
+		}
+	}
+
+	return ec.node.GetBlock(ctx, rpc.BlockByHeight(low))
+}
+
+// unbondingCandidates returns the public keys that may have unbonding
+// purses maturing at the end of the era closed by block. Purses are
+// paid out unbonding delay eras after the era they are created in,
+// by accounts that were bidders or delegators when the creation era
+// started, or that still are at the parent of block. Both sets are
+// read from the auction state of the chain.
+func (ec *Client) unbondingCandidates(ctx context.Context, block *rpc.Block) ([]string, error) {
+	delay, err := ec.getUnbondingDelay(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The creation era starts after the last block of the era before.
+	creationStart, err := ec.lastBlockOfEra(ctx, int64(block.Header.EraID)-int64(delay)-1, block)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	candidates := []string{}
+	for _, blockHash := range []string{creationStart.Hash, block.Header.ParentHash} {
+		auctionState, err := ec.node.GetAuctionInfo(ctx, rpc.BlockByHash(blockHash))
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not get auction info of block %s", err, blockHash)
+		}
+
+		for _, bid := range auctionState.Bids {
+			publicKeys := []string{bid.PublicKey}
+			for _, delegator := range bid.Bid.Delegators {
+				publicKeys = append(publicKeys, delegator.PublicKey)
+			}
+
+			for _, publicKey := range publicKeys {
+				publicKey = strings.ToLower(publicKey)
+				if !seen[publicKey] {
+					seen[publicKey] = true
+					candidates = append(candidates, publicKey)
+				}
+			}
+		}
+	}
+	sort.Strings(candidates)
+
+	return candidates, nil
+}
+
+// maturedUnbondingPurses returns the purses withdrawn by publicKey
+// between the parent state and the state of block. Purses unbonded
+// from an equivocator are slashed rather than paid out.
+func (ec *Client) maturedUnbondingPurses(
+	ctx context.Context,
+	publicKey string,
+	parent *rpc.Block,
+	block *rpc.Block,
+) ([]rpc.UnbondingPurse, error) {
+	before, err := ec.unbondingPurses(ctx, parent, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(before) == 0 {
+		return nil, nil
+	}
+
+	after, err := ec.unbondingPurses(ctx, block, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := map[rpc.UnbondingPurse]int{}
+	for _, purse := range after {
+		remaining[unbondingPurseKey(purse)]++
+	}
+
+	equivocators := map[string]bool{}
+	for _, equivocator := range block.Header.EraEnd.EraReport.Equivocators {
+		equivocators[strings.ToLower(equivocator)] = true
+	}
+
+	matured := []rpc.UnbondingPurse{}
+	for _, purse := range before {
+		key := unbondingPurseKey(purse)
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		if equivocators[strings.ToLower(purse.ValidatorPublicKey)] {
+			continue
+		}
+		matured = append(matured, purse)
+	}
+
+	return matured, nil
+}
+
+// unbondingPurseKey returns a comparable copy of purse.
+func unbondingPurseKey(purse rpc.UnbondingPurse) rpc.UnbondingPurse {
+	key := purse
+	key.NewValidator = nil
+
+	return key
+}
+
+// unbondPayoutOperations returns the operations moving a matured
+// purse out of the unbonding sub account, starting at index. The
+// funds are paid back to the bonding purse, or staked with the
+// new validator of a redelegation.
+func unbondPayoutOperations(
+	index int64,
+	purse rpc.UnbondingPurse,
+	owners *purseOwners,
+) []*RosettaTypes.Operation {
+	opType := UnbondPayoutOpType
+	to := owners.account(purse.BondingPurse)
+	metadata := map[string]interface{}{
+		ValidatorMetadataKey:     purse.ValidatorPublicKey,
+		EraOfCreationMetadataKey: purse.EraOfCreation,
+	}
+	if purse.NewValidator != nil {
+		opType = RedelegateOpType
+		to = StakedAccount(purse.UnbonderPublicKey, *purse.NewValidator)
+		metadata[NewValidatorMetadataKey] = *purse.NewValidator
+	}
+
+	return []*RosettaTypes.Operation{
+		{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: index,
+			},
+			Type:    opType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: UnbondingAccount(purse.UnbonderPublicKey, purse.ValidatorPublicKey),
+			Amount: &RosettaTypes.Amount{
+				Value:    "-" + purse.Amount,
+				Currency: Currency,
+			},
+			Metadata: metadata,
+		},
+		{
+			OperationIdentifier: &RosettaTypes.OperationIdentifier{
+				Index: index + 1,
+			},
+			RelatedOperations: []*RosettaTypes.OperationIdentifier{
+				{
+					Index: index,
+				},
+			},
+			Type:    opType,
+			Status:  RosettaTypes.String(SuccessStatus),
+			Account: to,
+			Amount: &RosettaTypes.Amount{
+				Value:    purse.Amount,
+				Currency: Currency,
+			},
+			Metadata: metadata,
+		},
+	}
+}
+
+// createUnbondPayoutsTransaction returns the synthetic transaction
+// paying out the unbonding purses that matured at the end of the
+// era closed by block, or nil if there are none or if block is
+// not a switch block.
+func (ec *Client) createUnbondPayoutsTransaction(
+	ctx context.Context,
+	block *rpc.Block,
+) (*RosettaTypes.Transaction, error) {
+	if block.Header.EraEnd == nil || block.Header.Height == uint64(GenesisBlockIndex) {
+		return nil, nil
+	}
+
+	parent, err := ec.node.GetBlock(ctx, rpc.BlockByHash(block.Header.ParentHash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get parent block", err)
+	}
+
+	candidates, err := ec.unbondingCandidates(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+
+	matured := make([][]rpc.UnbondingPurse, len(candidates))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, publicKey := range candidates {
+		if err := ec.deploySemaphore.Acquire(gctx, semaphoreDeployWeight); err != nil {
+			if waitErr := g.Wait(); waitErr != nil {
+				return nil, waitErr
+			}
+			return nil, fmt.Errorf("%w: could not fetch withdrawals", err)
+		}
+
+		i, publicKey := i, publicKey
+		g.Go(func() error {
+			defer ec.deploySemaphore.Release(semaphoreDeployWeight)
+
+			purses, err := ec.maturedUnbondingPurses(gctx, publicKey, parent, block)
+			if err != nil {
+				return err
+			}
+			matured[i] = purses
+
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	owners := newPurseOwners()
+	operations := []*RosettaTypes.Operation{}
+	for _, purses := range matured {
+		for _, purse := range purses {
+			err := ec.addPurse(ctx, owners, block.Header.StateRootHash, purse.UnbonderPublicKey, purse.BondingPurse)
+			if err != nil {
+				return nil, fmt.Errorf("%w: could not get account of %s", err, purse.UnbonderPublicKey)
+			}
+
+			operations = append(operations, unbondPayoutOperations(int64(len(operations)), purse, owners)...)
+		}
+	}
+	if len(operations) == 0 {
+		return nil, nil
+	}
+
+	return &RosettaTypes.Transaction{
+		TransactionIdentifier: &RosettaTypes.TransactionIdentifier{
+			Hash: UnbondPayoutsTransactionHash(block.Hash),
+		},
+		Operations: operations,
+		Metadata: map[string]interface{}{
+			EraIDMetadataKey: block.Header.EraID,
+		},
+	}, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casper
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	RosettaTypes "github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// unbondingChain returns a node with blocks 0 to 6 and an unbonding
+// delay of 1 era. Blocks 0 and 1 are in era 0, blocks 2 and 3 in era
+// 1 and blocks 4 to 6 in era 2. Blocks 1 and 6 are switch blocks.
+func unbondingChain(protocolVersion string) (*fakeNode, []*rpc.Block) {
+	node := newFakeNode()
+	node.chainspec = &rpc.ChainspecRawBytes{
+		ChainspecBytes: hex.EncodeToString([]byte("[core]\nunbonding_delay = 1\n")),
+	}
+
+	eras := []uint64{0, 0, 1, 1, 2, 2, 2}
+	blocks := make([]*rpc.Block, len(eras))
+	for height, era := range eras {
+		block := testBlock(uint64(height), protocolVersion, testPublicKey(0xa0))
+		block.Header.EraID = era
+		if height == 1 || height == len(eras)-1 {
+			block.Header.EraEnd = &rpc.EraEnd{}
+		}
+
+		node.addBlock(block)
+		blocks[height] = block
+	}
+
+	return node, blocks
+}
+
+// auctionOf returns an auction state with a bid of validator
+// delegated to by delegators.
+func auctionOf(validator string, delegators ...string) *rpc.AuctionState {
+	bid := rpc.BidEntry{PublicKey: validator}
+	for _, delegator := range delegators {
+		bid.Bid.Delegators = append(bid.Bid.Delegators, rpc.Delegator{PublicKey: delegator})
+	}
+
+	return &rpc.AuctionState{Bids: []rpc.BidEntry{bid}}
+}
+
+func TestUnbondPayoutsTransaction(t *testing.T) {
+	validator := testPublicKey(0xa1)
+	equivocator := testPublicKey(0xa2)
+	fullUnbonder := testPublicKey(0xa3)
+	partialUnbonder := testPublicKey(0xa4)
+
+	purses := map[string]string{
+		fullUnbonder:    testPurse(0xc3),
+		partialUnbonder: testPurse(0xc4),
+	}
+
+	matured := func(unbonder string, validator string, amount string) rpc.UnbondingPurse {
+		return rpc.UnbondingPurse{
+			BondingPurse:       purses[unbonder],
+			ValidatorPublicKey: validator,
+			UnbonderPublicKey:  unbonder,
+			EraOfCreation:      1,
+			Amount:             amount,
+		}
+	}
+	pending := rpc.UnbondingPurse{
+		BondingPurse:       purses[partialUnbonder],
+		ValidatorPublicKey: validator,
+		UnbonderPublicKey:  partialUnbonder,
+		EraOfCreation:      2,
+		Amount:             "7",
+	}
+
+	tests := map[string]struct {
+		protocolVersion string
+		prefix          string
+		stored          func(purses []rpc.UnbondingPurse) *rpc.StoredValue
+	}{
+		"withdraw keys": {
+			protocolVersion: "1.4.0",
+			prefix:          "withdraw-",
+			stored: func(purses []rpc.UnbondingPurse) *rpc.StoredValue {
+				return &rpc.StoredValue{Withdraw: purses}
+			},
+		},
+		"unbond keys": {
+			protocolVersion: "1.5.0",
+			prefix:          "unbond-",
+			stored: func(purses []rpc.UnbondingPurse) *rpc.StoredValue {
+				return &rpc.StoredValue{Unbonding: purses}
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			node, blocks := unbondingChain(test.protocolVersion)
+			parent, block := blocks[5], blocks[6]
+			block.Header.EraEnd.EraReport.Equivocators = []string{equivocator}
+
+			// The full unbonder left the auction during era 1,
+			// the partial unbonder is still in it.
+			node.auctions[blocks[1].Hash] = auctionOf(validator, fullUnbonder)
+			node.auctions[parent.Hash] = auctionOf(validator, partialUnbonder)
+
+			setPurses := func(stateRootHash string, publicKey string, purses ...rpc.UnbondingPurse) {
+				key := test.prefix + strings.TrimPrefix(testAccountHash(publicKey), accountHashPrefix)
+				node.setItem(stateRootHash, key, test.stored(purses))
+			}
+			setPurses(
+				parent.Header.StateRootHash,
+				fullUnbonder,
+				matured(fullUnbonder, validator, "10"),
+				matured(fullUnbonder, equivocator, "20"),
+			)
+			setPurses(parent.Header.StateRootHash, partialUnbonder, matured(partialUnbonder, validator, "30"), pending)
+			setPurses(block.Header.StateRootHash, partialUnbonder, pending)
+			for publicKey, purse := range purses {
+				node.addAccount(block.Header.StateRootHash, publicKey, purse)
+			}
+
+			want := []*RosettaTypes.AccountIdentifier{
+				UnbondingAccount(fullUnbonder, validator),
+				MainAccount(testAccountHash(fullUnbonder)),
+				UnbondingAccount(partialUnbonder, validator),
+				MainAccount(testAccountHash(partialUnbonder)),
+			}
+			wantAmounts := []string{"-10", "10", "-30", "30"}
+
+			// Each client derives the unbonders from the chain alone.
+			for i := 0; i < 2; i++ {
+				client := newTestClient(t, node, nil)
+				transaction, err := client.createUnbondPayoutsTransaction(context.Background(), block)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if transaction == nil {
+					t.Fatal("no unbond payouts transaction")
+				}
+
+				accounts := []*RosettaTypes.AccountIdentifier{}
+				amounts := []string{}
+				for _, operation := range transaction.Operations {
+					if operation.Type != UnbondPayoutOpType {
+						t.Fatalf("operation type %s, want %s", operation.Type, UnbondPayoutOpType)
+					}
+					accounts = append(accounts, operation.Account)
+					amounts = append(amounts, operation.Amount.Value)
+				}
+				if !reflect.DeepEqual(accounts, want) {
+					t.Fatalf("accounts %s, want %s", RosettaTypes.PrintStruct(accounts), RosettaTypes.PrintStruct(want))
+				}
+				if !reflect.DeepEqual(amounts, wantAmounts) {
+					t.Fatalf("amounts %v, want %v", amounts, wantAmounts)
+				}
+			}
+		})
+	}
+}
+
+func TestUnbondPayoutsTransactionNotSwitchBlock(t *testing.T) {
+	node, blocks := unbondingChain("1.5.0")
+	client := newTestClient(t, node, nil)
+
+	transaction, err := client.createUnbondPayoutsTransaction(context.Background(), blocks[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transaction != nil {
+		t.Fatalf("unbond payouts transaction %v in a block that is not a switch block", transaction)
+	}
+}
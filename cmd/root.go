@@ -43,6 +43,18 @@ func Execute() error {
 
 func init() {
 	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().StringVar(
+		&configFile,
+		"config-file",
+		"",
+		"path to a JSON configuration file",
+	)
+	runCmd.Flags().StringSliceVar(
+		&nodeURLs,
+		"node-url",
+		nil,
+		"casper-node RPC endpoint, may be repeated (in priority order)",
+	)
 	// rootCmd.AddCommand(utilsBootstrapCmd)
 }
 
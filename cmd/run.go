@@ -54,10 +54,18 @@ var (
 		Short: "Run rosetta-casper",
 		RunE:  runRunCmd,
 	}
+
+	// configFile is the optional path to a JSON
+	// configuration file.
+	configFile string
+
+	// nodeURLs are the casper-node RPC endpoints
+	// provided on the command line.
+	nodeURLs []string
 )
 
 func runRunCmd(cmd *cobra.Command, args []string) error {
-	cfg, err := configuration.LoadConfiguration()
+	cfg, err := configuration.LoadConfiguration(configFile, nodeURLs)
 	if err != nil {
 		return fmt.Errorf("%w: unable to load configuration", err)
 	}
@@ -91,11 +99,27 @@ func runRunCmd(cmd *cobra.Command, args []string) error {
 		// }
 
 		var err error
-		client, err = casper.NewClient()
+		client, err = casper.NewClient(cfg.NodeURLs, &casper.ClientOptions{
+			MaxConcurrency:      cfg.MaxConcurrency,
+			OperationBuilder:    cfg.OperationBuilder,
+			GenesisAccountsFile: cfg.GenesisAccountsFile,
+			PurseIndexFile:      cfg.PurseIndexFile,
+			FinalityMode:        cfg.FinalityMode,
+			FinalityThreshold:   cfg.FinalityThreshold,
+			EventStreamURL:      cfg.EventStreamURL,
+		})
 		if err != nil {
 			return fmt.Errorf("%w: cannot initialize casper client", err)
 		}
-		// defer client.Close()
+		defer client.Close()
+
+		if err := client.CheckGenesisAccounts(ctx); err != nil {
+			return fmt.Errorf("%w: cannot load genesis accounts", err)
+		}
+
+		g.Go(func() error {
+			return client.StreamFinalitySignatures(ctx)
+		})
 	}
 
 	router := services.NewBlockchainRouter(cfg, client, asserter)
@@ -15,10 +15,14 @@
 package configuration
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/TheArcadiaGroup/rosetta-casper/casper"
 
@@ -62,39 +66,126 @@ const (
 	// implementation.
 	PortEnv = "PORT"
 
-	// // GethEnv is an optional environment variable
-	// // used to connect rosetta-ethereum to an already
-	// // running geth node.
-	// GethEnv = "GETH"
+	// NodeURLsEnv is an optional environment variable
+	// holding a comma-separated, ordered list of casper-node
+	// RPC endpoints. The first endpoint is the primary one.
+	NodeURLsEnv = "NODE_URLS"
 
-	// // DefaultGethURL is the default URL for
-	// // a running geth node. This is used
-	// // when GethEnv is not populated.
-	// DefaultGethURL = "http://localhost:8545"
+	// ConfigFileEnv is an optional environment variable
+	// pointing to a JSON configuration file.
+	ConfigFileEnv = "CONFIG_FILE"
+
+	// MaxConcurrencyEnv is an optional environment variable
+	// setting the maximum number of deploys fetched concurrently.
+	MaxConcurrencyEnv = "MAX_CONCURRENCY"
+
+	// OperationBuilderEnv is an optional environment variable
+	// selecting how the operations of deploys are built
+	// ("transfers" or "effects").
+	OperationBuilderEnv = "OPERATION_BUILDER"
+
+	// GenesisAccountsFileEnv is an optional environment variable
+	// pointing to the accounts.toml file of the chainspec. The
+	// genesis accounts are read from the node if it is not set,
+	// which fails on nodes upgraded from the genesis protocol
+	// version, such as mainnet nodes.
+	GenesisAccountsFileEnv = "GENESIS_ACCOUNTS_FILE"
+
+	// PurseIndexFileEnv is an optional environment variable
+	// pointing to the index mapping purses to their owner
+	// accounts, DefaultPurseIndexFile if it is not set.
+	PurseIndexFileEnv = "PURSE_INDEX_FILE"
+
+	// FinalityModeEnv is an optional environment variable
+	// selecting the blocks served as current ("latest" or
+	// "finalized").
+	FinalityModeEnv = "FINALITY_MODE"
+
+	// FinalityThresholdEnv is an optional environment variable
+	// setting the share of the era validator weight that must
+	// sign a block in the "finalized" mode, as a fraction
+	// ("2/3") or a decimal ("0.67").
+	FinalityThresholdEnv = "FINALITY_THRESHOLD"
+
+	// EventStreamURLEnv is an optional environment variable
+	// holding the url of the node event stream, from which
+	// finality signatures are read in addition to the
+	// proofs of the blocks.
+	EventStreamURLEnv = "EVENT_STREAM_URL"
+
+	// DefaultNodeURL is the default URL for
+	// a running casper-node. This is used
+	// when no endpoint is configured.
+	DefaultNodeURL = "http://localhost:7777/rpc"
+
+	// DefaultPurseIndexFile is the default location
+	// of the purse index, in the DataDirectory.
+	DefaultPurseIndexFile = DataDirectory + "/purse_index"
 
 	// MiddlewareVersion is the version of rosetta-ethereum.
 	MiddlewareVersion = "0.0.4"
 )
 
+// ErrInvalidMaxConcurrency is returned when the maximum
+// number of deploys fetched concurrently is not a
+// positive integer.
+var ErrInvalidMaxConcurrency = errors.New("invalid max concurrency")
+
 // Configuration determines how
 type Configuration struct {
 	Mode                   Mode
 	Network                *types.NetworkIdentifier
 	GenesisBlockIdentifier *types.BlockIdentifier
-	// GethURL                string
-	// RemoteGeth             bool
+	NodeURLs               []string
+	MaxConcurrency         int64
+	OperationBuilder       string
+	GenesisAccountsFile    string
+	PurseIndexFile         string
+	FinalityMode           string
+	FinalityThreshold      *big.Rat
+	EventStreamURL         string
 	Port                   int
-	// GethArguments          string
 
 	// // Block Reward Data
 	// Params *params.ChainConfig
 }
 
+// fileConfiguration is the content of the optional
+// JSON configuration file.
+type fileConfiguration struct {
+	NodeURLs            []string `json:"node_urls"`
+	MaxConcurrency      int64    `json:"max_concurrency"`
+	OperationBuilder    string   `json:"operation_builder"`
+	GenesisAccountsFile string   `json:"genesis_accounts_file"`
+	PurseIndexFile      string   `json:"purse_index_file"`
+	FinalityMode        string   `json:"finality_mode"`
+	FinalityThreshold   string   `json:"finality_threshold"`
+	EventStreamURL      string   `json:"event_stream_url"`
+}
+
 // LoadConfiguration attempts to create a new Configuration
-// using the ENVs in the environment.
-func LoadConfiguration() (*Configuration, error) {
+// using the ENVs in the environment. Node endpoints are taken
+// from nodeURLs (command line flags) if any, then from NodeURLsEnv,
+// then from the configuration file (configFile or ConfigFileEnv),
+// falling back to DefaultNodeURL.
+func LoadConfiguration(configFile string, nodeURLs []string) (*Configuration, error) {
 	config := &Configuration{}
 
+	if len(configFile) == 0 {
+		configFile = os.Getenv(ConfigFileEnv)
+	}
+	fileConfig := &fileConfiguration{}
+	if len(configFile) > 0 {
+		content, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to read configuration file %s", err, configFile)
+		}
+
+		if err := json.Unmarshal(content, fileConfig); err != nil {
+			return nil, fmt.Errorf("%w: unable to parse configuration file %s", err, configFile)
+		}
+	}
+
 	modeValue := Mode(os.Getenv(ModeEnv))
 	switch modeValue {
 	case Online:
@@ -131,12 +222,88 @@ func LoadConfiguration() (*Configuration, error) {
 		return nil, fmt.Errorf("%s is not a valid network", networkValue)
 	}
 
-	// config.GethURL = DefaultGethURL
-	// envGethURL := os.Getenv(GethEnv)
-	// if len(envGethURL) > 0 {
-	// 	config.RemoteGeth = true
-	// 	config.GethURL = envGethURL
-	// }
+	switch {
+	case len(nodeURLs) > 0:
+		config.NodeURLs = parseNodeURLs(nodeURLs)
+	case len(os.Getenv(NodeURLsEnv)) > 0:
+		config.NodeURLs = parseNodeURLs(strings.Split(os.Getenv(NodeURLsEnv), ","))
+	case len(fileConfig.NodeURLs) > 0:
+		config.NodeURLs = parseNodeURLs(fileConfig.NodeURLs)
+	}
+	if len(config.NodeURLs) == 0 {
+		config.NodeURLs = []string{DefaultNodeURL}
+	}
+
+	config.MaxConcurrency = casper.DefaultMaxConcurrency
+	if fileConfig.MaxConcurrency < 0 {
+		return nil, fmt.Errorf("%w: %d must be positive", ErrInvalidMaxConcurrency, fileConfig.MaxConcurrency)
+	}
+	if fileConfig.MaxConcurrency > 0 {
+		config.MaxConcurrency = fileConfig.MaxConcurrency
+	}
+	if maxConcurrencyValue := os.Getenv(MaxConcurrencyEnv); len(maxConcurrencyValue) > 0 {
+		maxConcurrency, err := strconv.ParseInt(maxConcurrencyValue, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidMaxConcurrency, maxConcurrencyValue, err.Error())
+		}
+		if maxConcurrency <= 0 {
+			return nil, fmt.Errorf("%w: %s must be positive", ErrInvalidMaxConcurrency, maxConcurrencyValue)
+		}
+		config.MaxConcurrency = maxConcurrency
+	}
+
+	config.OperationBuilder = casper.TransfersOperationBuilder
+	if len(fileConfig.OperationBuilder) > 0 {
+		config.OperationBuilder = fileConfig.OperationBuilder
+	}
+	if operationBuilderValue := os.Getenv(OperationBuilderEnv); len(operationBuilderValue) > 0 {
+		config.OperationBuilder = operationBuilderValue
+	}
+	if !isOperationBuilder(config.OperationBuilder) {
+		return nil, fmt.Errorf("%s is not a valid operation builder", config.OperationBuilder)
+	}
+
+	config.GenesisAccountsFile = fileConfig.GenesisAccountsFile
+	if genesisAccountsFile := os.Getenv(GenesisAccountsFileEnv); len(genesisAccountsFile) > 0 {
+		config.GenesisAccountsFile = genesisAccountsFile
+	}
+
+	config.PurseIndexFile = DefaultPurseIndexFile
+	if len(fileConfig.PurseIndexFile) > 0 {
+		config.PurseIndexFile = fileConfig.PurseIndexFile
+	}
+	if purseIndexFile := os.Getenv(PurseIndexFileEnv); len(purseIndexFile) > 0 {
+		config.PurseIndexFile = purseIndexFile
+	}
+
+	config.FinalityMode = casper.LatestBlockMode
+	if len(fileConfig.FinalityMode) > 0 {
+		config.FinalityMode = fileConfig.FinalityMode
+	}
+	if finalityMode := os.Getenv(FinalityModeEnv); len(finalityMode) > 0 {
+		config.FinalityMode = finalityMode
+	}
+	if !isFinalityMode(config.FinalityMode) {
+		return nil, fmt.Errorf("%s is not a valid finality mode", config.FinalityMode)
+	}
+
+	config.FinalityThreshold = casper.DefaultFinalityThreshold
+	finalityThresholdValue := fileConfig.FinalityThreshold
+	if value := os.Getenv(FinalityThresholdEnv); len(value) > 0 {
+		finalityThresholdValue = value
+	}
+	if len(finalityThresholdValue) > 0 {
+		threshold, ok := new(big.Rat).SetString(finalityThresholdValue)
+		if !ok || threshold.Sign() <= 0 || threshold.Cmp(big.NewRat(1, 1)) > 0 {
+			return nil, fmt.Errorf("unable to parse finality threshold %s", finalityThresholdValue)
+		}
+		config.FinalityThreshold = threshold
+	}
+
+	config.EventStreamURL = fileConfig.EventStreamURL
+	if eventStreamURL := os.Getenv(EventStreamURLEnv); len(eventStreamURL) > 0 {
+		config.EventStreamURL = eventStreamURL
+	}
 
 	portValue := os.Getenv(PortEnv)
 	if len(portValue) == 0 {
@@ -151,3 +318,41 @@ func LoadConfiguration() (*Configuration, error) {
 
 	return config, nil
 }
+
+// parseNodeURLs trims the provided endpoints and drops
+// empty ones, preserving their order.
+func parseNodeURLs(urls []string) []string {
+	parsed := []string{}
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if len(url) > 0 {
+			parsed = append(parsed, url)
+		}
+	}
+
+	return parsed
+}
+
+// isOperationBuilder returns true if builder
+// is a supported operation builder.
+func isOperationBuilder(builder string) bool {
+	for _, operationBuilder := range casper.OperationBuilders {
+		if builder == operationBuilder {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isFinalityMode returns true if mode is a
+// supported finality mode.
+func isFinalityMode(mode string) bool {
+	for _, finalityMode := range casper.FinalityModes {
+		if mode == finalityMode {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configuration
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper"
+)
+
+// setEnv sets the environment variables of env for
+// the duration of the test.
+func setEnv(t *testing.T, env map[string]string) {
+	for key, value := range env {
+		previous, ok := os.LookupEnv(key)
+		if err := os.Setenv(key, value); err != nil {
+			t.Fatal(err)
+		}
+
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previous)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+}
+
+func TestLoadConfigurationMaxConcurrency(t *testing.T) {
+	tests := map[string]struct {
+		value string
+		want  int64
+		err   error
+	}{
+		"default": {
+			want: casper.DefaultMaxConcurrency,
+		},
+		"positive": {
+			value: "4",
+			want:  4,
+		},
+		"zero": {
+			value: "0",
+			err:   ErrInvalidMaxConcurrency,
+		},
+		"negative": {
+			value: "-1",
+			err:   ErrInvalidMaxConcurrency,
+		},
+		"not a number": {
+			value: "many",
+			err:   ErrInvalidMaxConcurrency,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			setEnv(t, map[string]string{
+				ModeEnv:           string(Offline),
+				NetworkEnv:        Testnet,
+				PortEnv:           "8080",
+				MaxConcurrencyEnv: test.value,
+			})
+
+			config, err := LoadConfiguration("", nil)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.MaxConcurrency != test.want {
+				t.Fatalf("max concurrency %d, want %d", config.MaxConcurrency, test.want)
+			}
+		})
+	}
+}
@@ -16,7 +16,9 @@ package services
 
 import (
 	"context"
+	"errors"
 
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
 	"github.com/TheArcadiaGroup/rosetta-casper/configuration"
 
 	"github.com/coinbase/rosetta-sdk-go/types"
@@ -53,6 +55,9 @@ func (s *AccountAPIService) AccountBalance(
 		request.AccountIdentifier,
 		request.BlockIdentifier,
 	)
+	if errors.Is(err, address.ErrInvalidAddress) {
+		return nil, wrapErr(ErrInvalidAddress, err)
+	}
 	if err != nil {
 		return nil, wrapErr(ErrRPCClient, err)
 	}
@@ -19,6 +19,7 @@ import (
 	"errors"
 
 	"github.com/TheArcadiaGroup/rosetta-casper/casper"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
 	"github.com/TheArcadiaGroup/rosetta-casper/configuration"
 
 	"github.com/coinbase/rosetta-sdk-go/types"
@@ -54,6 +55,12 @@ func (s *BlockAPIService) Block(
 	if errors.Is(err, casper.ErrBlockOrphaned) {
 		return nil, wrapErr(ErrBlockOrphaned, err)
 	}
+	if errors.Is(err, casper.ErrBlockNotFinalized) {
+		return nil, wrapErr(ErrBlockNotFinalized, err)
+	}
+	if errors.Is(err, address.ErrInvalidAddress) {
+		return nil, wrapErr(ErrInvalidAddress, err)
+	}
 	if err != nil {
 		return nil, wrapErr(ErrRPCClientBlock, err)
 	}
@@ -76,6 +83,15 @@ func (s *BlockAPIService) BlockTransaction(
 	if errors.Is(err, casper.ErrBlockOrphaned) {
 		return nil, wrapErr(ErrBlockOrphaned, err)
 	}
+	if errors.Is(err, casper.ErrBlockNotFinalized) {
+		return nil, wrapErr(ErrBlockNotFinalized, err)
+	}
+	if errors.Is(err, address.ErrInvalidAddress) {
+		return nil, wrapErr(ErrInvalidAddress, err)
+	}
+	if errors.Is(err, casper.ErrTransactionNotInBlock) {
+		return nil, wrapErr(ErrTransactionNotInBlock, err)
+	}
 	if err != nil {
 		return nil, wrapErr(ErrRPCClientTransaction, err)
 	}
@@ -16,13 +16,15 @@ package services
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 
+	"github.com/TheArcadiaGroup/rosetta-casper/casper"
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/address"
 	"github.com/TheArcadiaGroup/rosetta-casper/configuration"
-	"github.com/casper-ecosystem/casper-golang-sdk/keypair"
-	"github.com/casper-ecosystem/casper-golang-sdk/keypair/ed25519"
-	"github.com/casper-ecosystem/casper-golang-sdk/keypair/secp256k1"
 
 	"github.com/TheArcadiaGroup/rosetta-casper/casper/casper_client_sdk"
 	"github.com/coinbase/rosetta-sdk-go/types"
@@ -60,16 +62,21 @@ func (s *ConstructionAPIService) ConstructionDerive(
 	ctx context.Context,
 	request *types.ConstructionDeriveRequest,
 ) (*types.ConstructionDeriveResponse, *types.Error) {
-	resp := &types.ConstructionDeriveResponse{
-		AccountIdentifier: &types.AccountIdentifier{},
-	}
-	if request.PublicKey.CurveType == keypair.StrKeyTagEd25519 {
-		resp.AccountIdentifier.Address = ed25519.AccountHex(request.PublicKey.Bytes)
+	publicKey, err := casper.PublicKeyHex(request.PublicKey)
+	if err != nil {
+		return nil, wrapErr(ErrInvalidAddress, err)
 	}
-	if request.PublicKey.CurveType == keypair.StrKeyTagSecp256k1 {
-		resp.AccountIdentifier.Address = secp256k1.AccountHex(request.PublicKey.Bytes)
+
+	accountHash, err := casper.AccountHashFromPublicKey(publicKey)
+	if err != nil {
+		return nil, wrapErr(ErrInvalidAddress, err)
 	}
-	return resp, nil
+
+	return &types.ConstructionDeriveResponse{
+		AccountIdentifier: &types.AccountIdentifier{
+			Address: accountHash,
+		},
+	}, nil
 }
 
 // ConstructionPreprocess implements the /construction/preprocess
@@ -84,6 +91,12 @@ func (s *ConstructionAPIService) ConstructionPreprocess(
 	}
 	preProcessResp.Options[CHAIN_NAME] = request.NetworkIdentifier.Network
 	for _, operation := range request.Operations {
+		if operation.Account == nil {
+			return nil, wrapErr(ErrUnclearIntent, errors.New("operation account is missing"))
+		}
+		if _, err := address.Parse(operation.Account.Address); err != nil {
+			return nil, wrapErr(ErrInvalidAddress, err)
+		}
 		if operation.OperationIdentifier.Index == 0 {
 			preProcessResp.Options[SRC_ADDR] = operation.Account.Address
 			sender := &types.AccountIdentifier{
@@ -139,37 +152,85 @@ func (s *ConstructionAPIService) ConstructionPayloads(
 	if err != nil {
 		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
+	// Deploys are signed by the public key of the sender,
+	// SRC_ADDR only holds its account hash.
+	srcAccount, err := senderPublicKey(request.PublicKeys, request.Metadata[SRC_ADDR].(string))
+	if err != nil {
+		return nil, wrapErr(ErrInvalidAddress, err)
+	}
 	deployParams := &casper_client_sdk.DeployParams{
 		ChainName:      request.Metadata[CHAIN_NAME].(string),
 		TransferAmount: request.Metadata[TRANSFER_AMOUNT].(string),
 		// PaymentAmount:  request.Metadata[PAYMENT_AMOUNT].(string),
 		TargetAccount: request.Metadata[TARGET_ADDR].(string),
-		SrcAccount:    request.Metadata[SRC_ADDR].(string),
+		SrcAccount:    srcAccount,
 		GasPrice:      request.Metadata[GAS_PRICE].(string),
 		TransferID:    transfer_id,
 	}
-	unsignTransferJson, err := json.Marshal(casper_client_sdk.NewDeploy(*deployParams))
+	deploy, err := casper_client_sdk.NewDeploy(*deployParams)
+	if errors.Is(err, address.ErrInvalidAddress) {
+		return nil, wrapErr(ErrInvalidAddress, err)
+	}
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+	unsignTransferJson, err := json.Marshal(deploy)
 	if err != nil {
 		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
 	}
 	resp.UnsignedTransaction = string(unsignTransferJson)
-	targetAccount := &types.AccountIdentifier{
-		Address: request.Metadata[TARGET_ADDR].(string),
-		// Metadata: map[string]interface{}{
-		// 	rosettaUtil.Base16: rosettaUtil.ToChecksumAddr(transactionJson[rosettaUtil.SENDER_ADDR].(string)),
-		// },
+
+	deployHash, err := hex.DecodeString(deploy.Hash)
+	if err != nil {
+		return nil, wrapErr(ErrUnableToParseIntermediateResult, err)
+	}
+	sender, err := casper.AccountHashFromPublicKey(srcAccount)
+	if err != nil {
+		return nil, wrapErr(ErrInvalidAddress, err)
 	}
-	signingPayload := &types.SigningPayload{
-		AccountIdentifier: targetAccount,
-		// Bytes:             unsignedByte, //byte array of transaction
-		// SignatureType:     rosettaUtil.SIGNATURE_TYPE,
+	// Every required public key approves the deploy hash
+	// of the sender account.
+	for _, publicKey := range request.PublicKeys {
+		signingPayload, err := casper.SigningPayload(sender, publicKey, deployHash)
+		if err != nil {
+			return nil, wrapErr(ErrInvalidAddress, err)
+		}
+		payloads = append(payloads, signingPayload)
 	}
-	payloads = append(payloads, signingPayload)
 	resp.Payloads = payloads
 
 	return resp, nil
 }
 
+// senderPublicKey returns the tagged hex of the public key
+// of publicKeys whose account hash is the sender account.
+func senderPublicKey(publicKeys []*types.PublicKey, sender string) (string, error) {
+	senderAddress, err := address.Parse(sender)
+	if err != nil {
+		return "", err
+	}
+	senderHash, err := senderAddress.Account()
+	if err != nil {
+		return "", err
+	}
+
+	for _, publicKey := range publicKeys {
+		publicKeyHex, err := casper.PublicKeyHex(publicKey)
+		if err != nil {
+			return "", err
+		}
+		accountHash, err := casper.AccountHashFromPublicKey(publicKeyHex)
+		if err != nil {
+			return "", err
+		}
+		if accountHash == senderHash.String() {
+			return publicKeyHex, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: missing public key of sender %s", address.ErrInvalidAddress, sender)
+}
+
 // ConstructionCombine implements the /construction/combine
 // endpoint.
 func (s *ConstructionAPIService) ConstructionCombine(
@@ -15,6 +15,8 @@
 package services
 
 import (
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
 	"github.com/coinbase/rosetta-sdk-go/types"
 )
 
@@ -34,6 +36,8 @@ var (
 		ErrCallMethodInvalid,
 		ErrBlockOrphaned,
 		ErrInvalidAddress,
+		ErrBlockNotFinalized,
+		ErrTransactionNotInBlock,
 	}
 
 	// ErrUnimplemented is returned when an endpoint
@@ -152,16 +156,33 @@ var (
 		Code:    15, //nolint
 		Message: "RPCClient Transaction error",
 	}
+
+	// ErrBlockNotFinalized is returned when the finality
+	// signatures of a block do not reach the finality
+	// threshold yet.
+	ErrBlockNotFinalized = &types.Error{
+		Code:      16, //nolint
+		Message:   "Block not finalized",
+		Retriable: true,
+	}
+
+	// ErrTransactionNotInBlock is returned when the requested
+	// transaction was not executed in the requested block.
+	ErrTransactionNotInBlock = &types.Error{
+		Code:    17, //nolint
+		Message: "Transaction not in block",
+	}
 )
 
 // wrapErr adds details to the types.Error provided. We use a function
 // to do this so that we don't accidentially overrwrite the standard
-// errors.
+// errors. The returned error is retriable if the standard error is
+// or if err comes from a node call that may succeed later.
 func wrapErr(rErr *types.Error, err error) *types.Error {
 	newErr := &types.Error{
 		Code:      rErr.Code,
 		Message:   rErr.Message,
-		Retriable: rErr.Retriable,
+		Retriable: rErr.Retriable || rpc.IsRetriable(err),
 	}
 	if err != nil {
 		newErr.Details = map[string]interface{}{
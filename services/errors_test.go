@@ -0,0 +1,75 @@
+// Copyright 2020 Coinbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/TheArcadiaGroup/rosetta-casper/casper/rpc"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+func TestWrapErrRetriable(t *testing.T) {
+	tests := map[string]struct {
+		rErr      *types.Error
+		err       error
+		retriable bool
+	}{
+		"retriable node error": {
+			rErr:      ErrRPCClient,
+			err:       fmt.Errorf("get block: %w", &rpc.RPCError{Method: "chain_get_block", Retriable: true, Err: errors.New("timeout")}),
+			retriable: true,
+		},
+		"non retriable node error": {
+			rErr: ErrRPCClient,
+			err:  &rpc.RPCError{Method: "chain_get_block", Code: -32001, Err: errors.New("block not found")},
+		},
+		"other error": {
+			rErr: ErrRPCClient,
+			err:  errors.New("invalid block"),
+		},
+		"retriable standard error": {
+			rErr:      ErrBlockNotFinalized,
+			err:       errors.New("not enough finality signatures"),
+			retriable: true,
+		},
+		"no error": {
+			rErr: ErrRPCClient,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			wrapped := wrapErr(test.rErr, test.err)
+			if wrapped.Retriable != test.retriable {
+				t.Fatalf("retriable %t, want %t", wrapped.Retriable, test.retriable)
+			}
+			if wrapped.Code != test.rErr.Code || wrapped.Message != test.rErr.Message {
+				t.Fatalf("error %s, want %s", types.PrintStruct(wrapped), types.PrintStruct(test.rErr))
+			}
+			if (test.err != nil) != (wrapped.Details != nil) {
+				t.Fatalf("details %v of %v", wrapped.Details, test.err)
+			}
+		})
+	}
+
+	// The standard errors are left untouched.
+	if ErrRPCClient.Retriable {
+		t.Fatal("ErrRPCClient was made retriable")
+	}
+}
@@ -16,6 +16,7 @@ package services
 
 import (
 	"context"
+	"errors"
 
 	"github.com/TheArcadiaGroup/rosetta-casper/casper"
 	"github.com/TheArcadiaGroup/rosetta-casper/configuration"
@@ -82,6 +83,9 @@ func (s *NetworkAPIService) NetworkStatus(
 	}
 
 	currentBlock, currentTime, peers, err := s.client.Status(ctx)
+	if errors.Is(err, casper.ErrBlockNotFinalized) {
+		return nil, wrapErr(ErrBlockNotFinalized, err)
+	}
 	if err != nil {
 		return nil, wrapErr(ErrRPCClient, err)
 	}